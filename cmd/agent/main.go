@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	neturl "net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"hive/pkg/config"
 	"hive/pkg/cron"
 	"hive/pkg/dto"
+	"hive/pkg/leader"
 	"hive/pkg/mm"
 	"hive/pkg/store"
 	"hive/pkg/svrmgr"
@@ -36,6 +45,17 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
+	// token callback theo room dẫn xuất từ secret riêng, không dùng lại bearer global
+	if err := cfg.Auth.CheckRoomTokenSecret(); err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	// file region/queue cấu hình sai → dừng, không âm thầm chạy với region/queue mặc định
+	if err := cfg.Nomad.CheckRegions(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if err := cfg.Matchmaking.CheckQueues(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
 
 	// Override executable path from command line if provided
 	if executablePath != "" {
@@ -51,33 +71,92 @@ func main() {
 	store.SetTicketTTL(cfg.Matchmaking.TicketTTL) // Set TTL from config
 	store.SetAllocationTimeout(cfg.Matchmaking.AllocationTimeout)
 	store.SetTerminalTTL(cfg.Matchmaking.TerminalTTL)
+	store.SetBackfillTTL(cfg.Matchmaking.BackfillTTL)
+	store.SetLobbyIdleTTL(cfg.Matchmaking.LobbyIdleTTL)
 	if err := storeMgr.Ping(context.Background()); err != nil {
 		log.Fatal("redis not available:", err)
 	}
-	svrMgr, err := svrmgr.New(cfg.Nomad.Address)
-	if err != nil {
-		log.Fatal("Failed to create Nomad client:", err)
+	// Leader election: chỉ agent giữ lease chạy cron đồng bộ và vòng matcher
+	var elector *leader.Elector
+	var guard func(ctx context.Context) (context.Context, bool)
+	if cfg.Leader.Enabled {
+		elector = leader.New(storeMgr, "agent", cfg.Server.AgentID, cfg.Leader.LeaseTTL)
+		guard = elector.Guard
+		go elector.Run(context.Background())
 	}
-	// Set Nomad configs
-	svrMgr.SetDatacenters(cfg.Nomad.Datacenters)
-	svrMgr.SetBearerToken(cfg.Auth.BearerToken)
-	ipMappings := []svrmgr.IPMapping{}
-	for _, mapping := range cfg.Nomad.IPMappings {
-		ipMappings = append(ipMappings, svrmgr.IPMapping{
-			PrivateIP: mapping.PrivateIP,
-			PublicIP:  mapping.PublicIP,
+	// Report các lượt đồng bộ của mọi region (GET /admin/reconcile)
+	reconcileHistory := cron.NewHistory(int(cfg.Cron.ReportHistory))
+	// Mỗi region là một cụm Nomad riêng (svrmgr + cron riêng); region đầu tiên là mặc định
+	regions := []mm.Region{}
+	for i, rc := range cfg.Nomad.AllRegions() {
+		regionMgr, err := svrmgr.New(rc.Address)
+		if err != nil {
+			log.Fatalf("Failed to create Nomad client for region %s: %v", rc.Name, err)
+		}
+		regionMgr.SetDatacenters(rc.Datacenters)
+		regionMgr.SetJobOwner(cfg.Server.Owner, cfg.Server.AgentID)
+		regionMgr.SetAddressOptions(toAddressOptions(rc))
+		regions = append(regions, mm.Region{Name: rc.Name, Svr: regionMgr})
+
+		// Cron runner của region
+		nc, _ := api.NewClient(&api.Config{Address: rc.Address})
+		go cron.New(storeMgr, nc, cron.Options{
+			GraceSeconds:     cfg.Cron.GraceSeconds,
+			JobPrefix:        cfg.Cron.JobPrefix,
+			Interval:         cfg.Cron.Interval,
+			Owner:            cfg.Server.Owner,
+			HeartbeatTimeout: cfg.Cron.HeartbeatTimeout,
+			ReadyTimeout:     int64(cfg.Matchmaking.ReadyTimeout / time.Second),
+			Region:           rc.Name,
+			OwnsUnlabeled:    i == 0,
+			Guard:            guard,
+			DryRun:           cfg.Cron.DryRun,
+			History:          reconcileHistory,
+		}).Start(context.Background())
+		fmt.Fprintf(gin.DefaultWriter, "[GIN-debug] Region %s: Nomad=%s, Datacenters=%v\n", rc.Name, rc.Address, rc.Datacenters)
+	}
+	mmgr := mm.New(storeMgr, regions[0].Svr, cfg.Matchmaking.ExecutablePath)
+	mmgr.SetRegions(regions)
+	svrMgr := mmgr.ServerManager("")
+	queues := []mm.Queue{}
+	for _, q := range cfg.Matchmaking.Queues {
+		artifact := toArtifact(q.Artifact)
+		if artifact != nil {
+			if err := artifact.Validate(); err != nil {
+				log.Fatalf("queue %s: %v", q.Name, err)
+			}
+		}
+		queues = append(queues, mm.Queue{
+			Name:            q.Name,
+			CPU:             q.CPU,
+			MemoryMB:        q.MemoryMB,
+			DiskMB:          q.DiskMB,
+			Placement:       svrmgr.PlacementFromConfig(q.Placement),
+			Command:         q.Command,
+			Artifact:        artifact,
+			Teams:           q.Teams,
+			Properties:      q.Properties,
+			ReconnectWindow: time.Duration(q.ReconnectWindowSeconds) * time.Second,
+			ReadyCheck:      time.Duration(q.ReadyCheckSeconds) * time.Second,
+			DeclinePenalty:  time.Duration(q.DeclinePenaltySeconds) * time.Second,
 		})
 	}
-	svrmgr.SetIPMappingConfig(&svrmgr.IPMappingConfig{Mappings: ipMappings})
-	mmgr := mm.New(storeMgr, svrMgr, cfg.Matchmaking.ExecutablePath)
-
-	// Cron runner
-	nc, _ := api.NewClient(&api.Config{Address: cfg.Nomad.Address})
-	go cron.New(storeMgr, nc, cron.Options{
-		GraceSeconds: cfg.Cron.GraceSeconds,
-		JobPrefix:    cfg.Cron.JobPrefix,
-		Interval:     cfg.Cron.Interval,
-	}).Start(context.Background())
+	mmgr.SetQueues(queues)
+	mmgr.SetAdmissionControl(cfg.Matchmaking.AdmissionControl)
+	mmgr.SetCapacityTTL(cfg.Matchmaking.CapacityCacheTTL)
+	mmgr.SetLeaderGuard(guard)
+	mmgr.SetJoinTokens(cfg.Auth.JoinTokenKey, cfg.Auth.JoinTokenTTL)
+	mmgr.SetArtifactSources(cfg.Auth.ArtifactSources)
+	mmgr.SetRoomTokenSecret(cfg.Auth.RoomTokenSecret)
+	mmgr.SetReconnectWindow(cfg.Matchmaking.ReconnectWindow)
+	if err := mmgr.SetReadiness(mm.Readiness{
+		Mode:      cfg.Matchmaking.ReadyMode,
+		Timeout:   cfg.Matchmaking.ReadyTimeout,
+		ProbePath: cfg.Matchmaking.ReadyProbePath,
+	}); err != nil {
+		log.Fatalf("ROOM_READY_MODE: %v", err)
+	}
+	go mmgr.RunMatcher(context.Background(), cfg.Matchmaking.MatcherInterval)
 
 	r := gin.Default()
 
@@ -137,6 +216,104 @@ func main() {
 		})
 	})
 
+	// Trạng thái leader election của agent này
+	r.GET("/admin/leader", func(c *gin.Context) {
+		if elector == nil {
+			c.JSON(http.StatusOK, leader.Status{ID: cfg.Server.AgentID, IsLeader: true})
+			return
+		}
+		c.JSON(http.StatusOK, elector.Status(c))
+	})
+
+	// Report đồng bộ Redis ↔ Nomad gần nhất (mới trước)
+	r.GET("/admin/reconcile", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run": cfg.Cron.DryRun,
+			"reports": reconcileHistory.List(c.Query("region"), limit),
+		})
+	})
+
+	// Lifecycle event stream: chuyển trạng thái room + event server báo; ?after=<last_id>&wait=<s> để long-poll
+	r.GET("/admin/events", func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		wait, _ := strconv.Atoi(c.DefaultQuery("wait", "0"))
+		if wait > 30 {
+			wait = 30
+		}
+		events, last, err := storeMgr.ReadEvents(c, c.Query("after"), c.Query("room_id"), limit, time.Duration(wait)*time.Second)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, dto.EventsResponse{Events: events, LastID: last})
+	})
+
+	// Build versions & canary rollout theo queue: chỉ admin (ADMIN_TOKEN), build chạy bằng raw_exec trên node
+	adminOnly := func(c *gin.Context) {
+		if !serverAuthorized(c, func(token string) bool {
+			return cfg.Auth.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Auth.AdminToken)) == 1
+		}) {
+			c.Abort()
+		}
+	}
+	r.GET("/admin/builds", adminOnly, func(c *gin.Context) {
+		rep, err := mmgr.Builds(c, c.Query("queue"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ToErrorResponse(err))
+			return
+		}
+		c.JSON(http.StatusOK, rep)
+	})
+	r.POST("/admin/builds", adminOnly, func(c *gin.Context) {
+		var req dto.RegisterBuildRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: err.Error()})
+			return
+		}
+		build := store.ServerBuild{Queue: req.Queue, Version: req.Version, Command: req.Command}
+		if req.Artifact != nil {
+			build.Artifact = &store.BuildArtifact{Source: req.Artifact.Source, Checksum: req.Artifact.Checksum, Destination: req.Artifact.Destination, Mode: req.Artifact.Mode}
+		}
+		b, err := mmgr.RegisterBuild(c, build)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, adminBuildError(err))
+			return
+		}
+		c.JSON(http.StatusOK, b)
+	})
+	r.POST("/admin/rollouts", adminOnly, func(c *gin.Context) {
+		var req dto.SetRolloutRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: err.Error()})
+			return
+		}
+		ro, err := mmgr.SetRollout(c, store.Rollout{
+			Queue:          req.Queue,
+			Stable:         req.Stable,
+			Canary:         req.Canary,
+			CanaryPercent:  req.CanaryPercent,
+			CrashThreshold: req.CrashThreshold,
+			MinRooms:       req.MinRooms,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, adminBuildError(err))
+			return
+		}
+		c.JSON(http.StatusOK, ro)
+	})
+
+	// Fleet capacity: CPU/memory/ports còn trống theo node và datacenter
+	r.GET("/capacity", func(c *gin.Context) {
+		fleet, err := mmgr.ServerManager(c.Query("region")).Capacity()
+		if err != nil {
+			c.JSON(http.StatusBadGateway, dto.ErrorResponse{ErrorCode: dto.ErrCodeNomadError, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, fleet)
+	})
+
 	// Matchmaking APIs
 	// Submit ticket
 	r.POST("/tickets", func(c *gin.Context) {
@@ -148,8 +325,29 @@ func main() {
 			})
 			return
 		}
-		t, err := mmgr.SubmitJoinTicket(c, req.PlayerID)
+		t, err := mmgr.SubmitJoinTicket(c, mm.TicketRequest{
+			PlayerID:   req.PlayerID,
+			Queue:      req.Queue,
+			Regions:    req.Regions,
+			Latencies:  req.Latencies,
+			Attributes: req.Attributes,
+		})
 		if err != nil {
+			if errors.Is(err, mm.ErrUnknownQueue) {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnknownQueue, Error: err.Error()})
+				return
+			}
+			if errors.Is(err, mm.ErrUnknownRegion) {
+				c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnknownRegion, Error: err.Error()})
+				return
+			}
+			if errors.Is(err, mm.ErrDeclinePenalty) {
+				if d, _ := storeMgr.PlayerPenalty(c, req.PlayerID); d > 0 {
+					c.Header("Retry-After", strconv.Itoa(int(d.Round(time.Second)/time.Second)))
+				}
+				c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{ErrorCode: dto.ErrCodeDeclinePenalty, Error: err.Error()})
+				return
+			}
 			c.JSON(http.StatusOK, dto.SubmitTicketResponse{Status: "REJECTED"})
 			return
 		}
@@ -157,8 +355,8 @@ func main() {
 			TicketID: t.TicketID,
 			Status:   t.Status,
 		})
-		// best-effort: trigger a simple matcher (optional)
-		go func() { _, _ = mmgr.TryMatch(context.Background()) }()
+		// leader ghép ngay; follower chỉ enqueue, vòng matcher của leader sẽ ghép
+		mmgr.TriggerMatch(t.Queue)
 	})
 
 	// Ticket status
@@ -172,10 +370,34 @@ func main() {
 			})
 			return
 		}
-		c.JSON(http.StatusOK, dto.TicketStatusResponse{
-			Status: t.Status,
-			RoomID: t.RoomID,
-		})
+		token, exp := mmgr.IssueJoinToken(c, t)
+		resp := dto.TicketStatusResponse{
+			Status:             t.Status,
+			Queue:              t.Queue,
+			RoomID:             t.RoomID,
+			JoinToken:          token,
+			JoinTokenExpiresAt: exp,
+		}
+		// ready check: hạn accept và số player đã accept
+		if t.Status == "PROPOSED" && t.ProposalID != "" {
+			resp.AcceptDeadline = t.AcceptDeadline
+			if p, err := storeMgr.GetProposal(c, t.ProposalID); err == nil {
+				resp.AcceptedCount, resp.ProposalSize = p.Accepted(), len(p.Tickets)
+				for _, pt := range p.Tickets {
+					if pt.TicketID == t.TicketID {
+						resp.Accepted = pt.Response == store.ProposalAccepted
+					}
+				}
+			}
+		}
+		// room đã chạy (ACTIVED, kể cả ghép qua backfill) → trả luôn địa chỉ server
+		if t.RoomID != "" {
+			if st, err := storeMgr.GetRoomState(c, t.RoomID); err == nil && st.Status == "ACTIVED" {
+				resp.ServerHost, resp.ServerIP, resp.Port = st.ServerHost, st.ServerIP, st.Port
+			}
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, resp)
 	})
 
 	// Cancel ticket
@@ -188,6 +410,110 @@ func main() {
 		c.JSON(http.StatusOK, dto.CancelTicketResponse{Status: "CANCELED"})
 	})
 
+	// Ready check: player accept/decline trận được đề xuất (ticket PROPOSED)
+	respondTicket := func(accept bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var p *store.Proposal
+			var err error
+			if accept {
+				p, err = mmgr.AcceptTicket(c, c.Param("id"))
+			} else {
+				p, err = mmgr.DeclineTicket(c, c.Param("id"))
+			}
+			switch {
+			case store.IsNotFound(err):
+				c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeTicketNotFound, Error: "ticket not found"})
+				return
+			case errors.Is(err, mm.ErrNotProposed):
+				c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeNotProposed, Error: err.Error()})
+				return
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, dto.ProposalResponse{
+				Status:        p.Status,
+				AcceptedCount: p.Accepted(),
+				ProposalSize:  len(p.Tickets),
+				Deadline:      p.Deadline,
+				RoomID:        p.RoomID,
+			})
+		}
+	}
+	r.POST("/tickets/:id/accept", respondTicket(true))
+	r.POST("/tickets/:id/decline", respondTicket(false))
+
+	// --- Private rooms (lobby + join code) ---
+	r.POST("/rooms/private", func(c *gin.Context) {
+		var req dto.CreatePrivateRoomRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeMissingPlayerID, Error: "player_id required"})
+			return
+		}
+		l, token, err := mmgr.CreatePrivateRoom(c, mm.PrivateRoomRequest{
+			HostID:     req.PlayerID,
+			Queue:      req.Queue,
+			Region:     req.Region,
+			MaxPlayers: req.MaxPlayers,
+			Attributes: req.Attributes,
+		})
+		if !lobbyError(c, err) {
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusOK, dto.LobbyResponse{Lobby: l.Public(), MemberToken: token})
+		}
+	})
+
+	r.POST("/rooms/join", func(c *gin.Context) {
+		var req dto.JoinPrivateRoomRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: "code and player_id required"})
+			return
+		}
+		l, token, err := mmgr.JoinPrivateRoom(c, normalizeLobbyCode(req.Code), req.PlayerID, bearerToken(c), req.Attributes)
+		if !lobbyError(c, err) {
+			c.Header("Cache-Control", "no-store")
+			c.JSON(http.StatusOK, dto.LobbyResponse{Lobby: l.Public(), MemberToken: token})
+		}
+	})
+
+	// Trạng thái lobby (client poll): sau start có room_id; room ACTIVED → địa chỉ server,
+	// join token chỉ cấp cho member xác thực bằng member token (Authorization: Bearer) và có trong roster của room
+	r.GET("/rooms/private/:code", func(c *gin.Context) {
+		l, err := mmgr.GetLobby(c, normalizeLobbyCode(c.Param("code")))
+		if lobbyError(c, err) {
+			return
+		}
+		resp := dto.LobbyResponse{Lobby: l.Public()}
+		if l.RoomID != "" {
+			if st, err := storeMgr.GetRoomState(c, l.RoomID); err == nil {
+				resp.RoomStatus = st.Status
+				if st.Status == "ACTIVED" {
+					resp.ServerHost, resp.ServerIP, resp.Port = st.ServerHost, st.ServerIP, st.Port
+					if pid, ok := mm.LobbyMemberID(l, bearerToken(c)); ok {
+						resp.JoinToken, resp.JoinTokenExpiresAt = mmgr.ReconnectToken(st, pid)
+					}
+				}
+			}
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Host bắt đầu trận: allocate server qua svrmgr như room ghép ngẫu nhiên; host xác định bằng member token
+	r.POST("/rooms/private/:code/start", func(c *gin.Context) {
+		l, st, err := mmgr.StartPrivateRoom(c, normalizeLobbyCode(c.Param("code")), bearerToken(c))
+		if !lobbyError(c, err) {
+			c.JSON(http.StatusOK, dto.LobbyResponse{Lobby: l.Public(), RoomStatus: st.Status})
+		}
+	})
+
+	r.POST("/rooms/private/:code/leave", func(c *gin.Context) {
+		l, err := mmgr.LeavePrivateRoom(c, normalizeLobbyCode(c.Param("code")), bearerToken(c))
+		if !lobbyError(c, err) {
+			c.JSON(http.StatusOK, dto.LobbyResponse{Lobby: l.Public()})
+		}
+	})
+
 	// --- Room APIs ---
 	r.GET("/rooms/:room_id", func(c *gin.Context) {
 		rid := c.Param("room_id")
@@ -212,7 +538,8 @@ func main() {
 		})
 	})
 
-	// Reconnect lookup: tìm room ACTIVED chứa player_id
+	// Reconnect lookup: tìm room ACTIVED chứa player_id và trả địa chỉ. Join token mới (và lượt reconnect ghi vào room)
+	// chỉ dành cho caller chứng minh được là player: Authorization: Bearer <join token cũ của room đó>
 	r.GET("/reconnect/lookup", func(c *gin.Context) {
 		pid := c.Query("player_id")
 		if pid == "" {
@@ -225,21 +552,20 @@ func main() {
 			c.JSON(http.StatusInternalServerError, dto.ToErrorResponse(err))
 			return
 		}
-		found := ""
+		var found, ended *store.RoomState
 		dupCount := 0
 		for _, rid := range roomIDs {
 			st, e := storeMgr.GetRoomState(c, rid)
-			if e != nil || st == nil {
+			if e != nil || st == nil || !slices.Contains(st.Players, pid) {
 				continue
 			}
-			if st.Status != "ACTIVED" || len(st.Players) == 0 {
-				continue
-			}
-			for _, p := range st.Players {
-				if p == pid {
-					dupCount++
-					found = st.RoomID
-					break
+			switch st.Status {
+			case "ACTIVED":
+				dupCount++
+				found = st
+			case "FULFILLED", "DEAD":
+				if ended == nil || st.CreatedAt > ended.CreatedAt {
+					ended = st
 				}
 			}
 		}
@@ -247,13 +573,56 @@ func main() {
 			c.JSON(http.StatusConflict, gin.H{"error": "player_in_multiple_rooms", "player_id": pid})
 			return
 		}
-		if found == "" {
-			c.JSON(http.StatusNotFound, gin.H{"reconnectable": false, "reason": "not_found"})
+		now := time.Now().Unix()
+		bearer := bearerToken(c)
+		if found == nil {
+			// room vừa kết thúc (hết reconnect window, shutdown...) → 410 để client thôi thử lại
+			if ended != nil {
+				if mmgr.AuthenticatePlayer(ended, pid, bearer, time.Unix(now, 0)) {
+					_ = storeMgr.RecordReconnectAttempt(c, ended.RoomID, store.ReconnectAttempt{PlayerID: pid, At: now, Result: store.ReconnectRoomEnded})
+				}
+				c.JSON(http.StatusGone, dto.ReconnectLookupResponse{Reason: "room_ended", RoomID: ended.RoomID})
+				return
+			}
+			c.JSON(http.StatusNotFound, dto.ReconnectLookupResponse{Reason: "not_found"})
+			return
+		}
+		resp := dto.ReconnectLookupResponse{
+			Reconnectable: true,
+			RoomID:        found.RoomID,
+			ServerHost:    found.ServerHost,
+			ServerIP:      found.ServerIP,
+			Port:          found.Port,
+		}
+		if found.Assignment != nil {
+			resp.ReconnectWindowSeconds = found.Assignment.ReconnectWindowSeconds
+		}
+		if t := found.Telemetry; t != nil {
+			resp.Disconnected = slices.Contains(t.Disconnected, pid)
+			resp.Paused = t.Phase == "paused"
+		}
+		// chưa xác thực: chỉ trạng thái + địa chỉ, client lấy lại token qua ticket/lobby rồi hỏi lại
+		if !mmgr.AuthenticatePlayer(found, pid, bearer, time.Unix(now, 0)) {
+			resp.AuthRequired = true
+			c.JSON(http.StatusOK, resp)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"room_id": found, "reconnectable": true})
+		_ = storeMgr.RecordReconnectAttempt(c, found.RoomID, store.ReconnectAttempt{PlayerID: pid, At: now, Result: store.ReconnectOK})
+		resp.JoinToken, resp.JoinTokenExpiresAt = mmgr.ReconnectToken(found, pid)
+		c.JSON(http.StatusOK, resp)
 	})
 
+	// Token callback chỉ hợp lệ cho đúng room được cấp; token global chỉ khi bật AUTH_ACCEPT_GLOBAL_TOKEN (server cũ)
+	roomTokenValid := func(rid string) func(string) bool {
+		return func(token string) bool {
+			if mmgr.VerifyRoomToken(rid, token) {
+				return true
+			}
+			return cfg.Auth.AcceptGlobalToken && cfg.Auth.BearerToken != "" &&
+				subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Auth.BearerToken)) == 1
+		}
+	}
+
 	// Shutdown callback từ server → Agent
 	r.POST("/rooms/:room_id/shutdown", func(c *gin.Context) {
 		rid := c.Param("room_id")
@@ -262,14 +631,7 @@ func main() {
 			return
 		}
 		// Xác thực token Authorization: Bearer <token>
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnauthorized, Error: "missing authorization header"})
-			return
-		}
-		expectedToken := "Bearer " + cfg.Auth.BearerToken
-		if authHeader != expectedToken {
-			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnauthorized, Error: "invalid authorization token"})
+		if !serverAuthorized(c, roomTokenValid(rid)) {
 			return
 		}
 		var body dto.ShutdownRequest
@@ -284,49 +646,269 @@ func main() {
 			"afk_timeout":          true,
 			"game_cycle_completed": true,
 			"signal_received":      true,
+			"max_duration":         true,
 		}
 		if !validReasons[body.Reason] {
-			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("invalid reason: %s. Valid reasons: no_clients, client_disconnected, afk_timeout, game_cycle_completed, signal_received", body.Reason)})
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("invalid reason: %s. Valid reasons: no_clients, client_disconnected, afk_timeout, game_cycle_completed, signal_received, max_duration", body.Reason)})
 			return
 		}
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			key = body.IdempotencyKey
+		}
+		if body.At == 0 {
+			body.At = time.Now().Unix()
+		}
 		st, err := storeMgr.GetRoomState(c, rid)
 		if err != nil || st == nil {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
 			return
 		}
-		if st.Status != "ACTIVED" {
-			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("room status is %s, not ACTIVED", st.Status)})
+		// Retry/replay của callback đã xử lý → trả lại kết quả cũ
+		if st.Status == "FULFILLED" && key != "" && st.ShutdownKey == key {
+			c.JSON(http.StatusOK, dto.ShutdownResponse{OK: true, Duplicate: true})
 			return
 		}
-		if body.At == 0 {
-			body.At = time.Now().Unix()
+		// ACTIVED, hoặc DEAD do cron suy ra crash trong lúc agent không nhận được callback
+		if st.Status != "ACTIVED" && !cron.AcceptsLateShutdown(st, body.At) {
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: fmt.Sprintf("room status is %s, not ACTIVED", st.Status)})
+			return
 		}
-		// set FULFILLED với end_reason và graceful_at
-		st.Status = "FULFILLED"
-		st.EndReason = body.Reason
-		st.FulfilledAt = body.At
-		st.GracefulAt = body.At
-		// Details (winner/scores) nếu có
-		if body.Details != nil {
-			if v, ok := body.Details["winner"].(string); ok {
-				st.Winner = v
+		// result sai roster không chặn shutdown (room phải kết thúc), chỉ bị bỏ và báo lại trong response
+		var result *store.MatchResult
+		resultErr := ""
+		if body.Result != nil {
+			r := body.Result.ToMatchResult(time.Now().Unix())
+			if err := r.Validate(st.Players, st.Assignment); err != nil {
+				resultErr = err.Error()
+			} else {
+				result = &r
 			}
-			if m, ok := body.Details["scores"].(map[string]interface{}); ok {
-				st.Scores = map[string]int{}
-				for k, vv := range m {
-					switch n := vv.(type) {
-					case float64:
-						st.Scores[k] = int(n)
-					case int:
-						st.Scores[k] = n
-					}
-				}
+		}
+		st, err = storeMgr.TransitionRoom(c, rid, st.Status, func(s *store.RoomState) { applyShutdown(s, body, key, result) })
+		if errors.Is(err, store.ErrRoomStatusChanged) {
+			if st.Status == "FULFILLED" && key != "" && st.ShutdownKey == key {
+				c.JSON(http.StatusOK, dto.ShutdownResponse{OK: true, Duplicate: true})
+				return
 			}
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: fmt.Sprintf("room status is %s, not ACTIVED", st.Status)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
 		}
-		_ = storeMgr.SaveRoomState(c, *st)
 		// best-effort deregister job ngay khi graceful shutdown (không purge để inspect)
-		_ = svrMgr.DeregisterJob(rid, false)
-		c.JSON(http.StatusOK, gin.H{"ok": true})
+		_ = mmgr.ServerManager(st.Region).DeregisterJob(rid, false)
+		c.JSON(http.StatusOK, dto.ShutdownResponse{OK: true, ResultError: resultErr})
+	})
+
+	// Kết quả trận có kiểu: báo được khi room ACTIVED (trước shutdown, ghi đè được) hoặc ngay sau khi FULFILLED
+	r.POST("/rooms/:room_id/result", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		var body dto.RoomResultRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("invalid result: %v", err)})
+			return
+		}
+		st, err := storeMgr.SaveRoomResult(c, rid, body.ToMatchResult(time.Now().Unix()))
+		switch {
+		case store.IsNotFound(err):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+			return
+		case errors.Is(err, store.ErrInvalidResult):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidResult, Error: err.Error()})
+			return
+		case errors.Is(err, store.ErrRoomStatusChanged):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: fmt.Sprintf("room is %s", st.Status)})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dto.RoomResultResponse{OK: true, Status: st.Status})
+	})
+
+	// Event giữa trận (kick, abandon, hết round, nghi gian lận...): ghi event log của room + lifecycle stream
+	r.POST("/rooms/:room_id/events", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		var body dto.RoomEventRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("invalid event: %v", err)})
+			return
+		}
+		if err := validateServerEvent(body); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidEvent, Error: err.Error()})
+			return
+		}
+		if body.At == 0 {
+			body.At = time.Now().Unix()
+		}
+		_, err := storeMgr.AppendRoomEvent(c, rid, store.RoomEvent{Type: body.Type, Payload: body.Payload, At: body.At})
+		switch {
+		case store.IsNotFound(err):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+			return
+		case errors.Is(err, store.ErrRoomNotActive):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dto.RoomEventResponse{OK: true})
+	})
+
+	// Backfill: server xin thêm player cho room ACTIVED; matcher lấp từ ticket OPENED cùng queue
+	r.POST("/rooms/:room_id/backfill", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		var body dto.BackfillRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("invalid backfill: %v", err)})
+			return
+		}
+		bf, err := mmgr.RequestBackfill(c, rid, body.Slots, body.Team)
+		switch {
+		case store.IsNotFound(err):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+			return
+		case errors.Is(err, store.ErrRoomNotActive):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		}
+		// leader lấp ngay nếu đang có ticket chờ; follower để vòng matcher của leader xử lý
+		mmgr.TriggerBackfill(bf.Queue)
+		c.JSON(http.StatusOK, dto.BackfillResponse{Backfill: bf})
+	})
+
+	r.GET("/rooms/:room_id/backfill", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		bf, err := mmgr.GetBackfill(c, rid)
+		if !backfillError(c, err) {
+			c.JSON(http.StatusOK, dto.BackfillResponse{Backfill: bf})
+		}
+	})
+
+	r.DELETE("/rooms/:room_id/backfill", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		bf, err := mmgr.CancelBackfill(c, rid)
+		if !backfillError(c, err) {
+			c.JSON(http.StatusOK, dto.BackfillResponse{Backfill: bf})
+		}
+	})
+
+	// Assignment cho server lúc khởi động: player, team, queue, properties (server từ chối player lạ)
+	r.GET("/rooms/:room_id/assignment", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		st, err := storeMgr.GetRoomState(c, rid)
+		switch {
+		case store.IsNotFound(err):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		case st.Status != "OPENED" && st.Status != "ACTIVED":
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: fmt.Sprintf("room is %s", st.Status)})
+			return
+		}
+		resp := dto.RoomAssignmentResponse{
+			RoomID:       st.RoomID,
+			Status:       st.Status,
+			Queue:        st.Queue,
+			Region:       st.Region,
+			BuildVersion: st.BuildVersion,
+			Players:      []store.PlayerAssignment{},
+			Teams:        map[string][]string{},
+		}
+		if a := st.Assignment; a != nil {
+			resp.Players, resp.Teams, resp.Properties = a.Players, a.Teams, a.Properties
+		} else {
+			// room tạo trước khi có assignment: mỗi player một team
+			resp.Players = make([]store.PlayerAssignment, 0, len(st.Players))
+			for i, p := range st.Players {
+				team := fmt.Sprintf("team_%d", i+1)
+				resp.Players = append(resp.Players, store.PlayerAssignment{PlayerID: p, Team: team})
+				resp.Teams[team] = []string{p}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Ready callback server → agent: room OPENED chỉ ACTIVED sau khi server báo sẵn sàng
+	r.POST("/rooms/:room_id/ready", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		st, err := mmgr.MarkReady(c, rid)
+		switch {
+		case store.IsNotFound(err):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+			return
+		case errors.Is(err, store.ErrRoomStatusChanged):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: fmt.Sprintf("room is %s", st.Status)})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dto.RoomReadyResponse{OK: true, Status: st.Status})
+	})
+
+	// Heartbeat server → agent: telemetry của room ACTIVED
+	r.POST("/rooms/:room_id/heartbeat", func(c *gin.Context) {
+		rid := c.Param("room_id")
+		if !serverAuthorized(c, roomTokenValid(rid)) {
+			return
+		}
+		var body dto.RoomHeartbeatRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: fmt.Sprintf("invalid heartbeat: %v", err)})
+			return
+		}
+		_, err := storeMgr.UpdateRoomHeartbeat(c, rid, store.RoomTelemetry{
+			PlayerCount:  body.PlayerCount,
+			Players:      body.Players,
+			Phase:        body.Phase,
+			Disconnected: body.Disconnected,
+			TickRate:     body.TickRate,
+			MemoryMB:     body.MemoryMB,
+			SentAt:       body.At,
+		}, time.Now().Unix())
+		switch {
+		case store.IsNotFound(err):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+			return
+		case errors.Is(err, store.ErrRoomNotActive):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotReady, Error: err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, dto.RoomHeartbeatResponse{OK: true, NextHeartbeatSecs: cfg.Cron.HeartbeatTimeout / 3})
 	})
 
 	// legacy rooms list (giữ tạm)
@@ -357,7 +939,11 @@ func main() {
 			})
 			return
 		}
-		info, err := svrMgr.GetRoomInfo(rid)
+		regionMgr := svrMgr
+		if st, serr := storeMgr.GetRoomState(c, rid); serr == nil && st != nil {
+			regionMgr = mmgr.ServerManager(st.Region)
+		}
+		info, err := regionMgr.GetRoomInfo(rid)
 		if err != nil || info == nil || info.HostIP == "" || len(info.Ports) == 0 {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{
 				ErrorCode: dto.ErrCodeRoomNotReady,
@@ -374,7 +960,11 @@ func main() {
 				break
 			}
 		}
-		url := fmt.Sprintf("http://%s:%d/heartbeat?player_id=%s", info.HostIP, port, pid)
+		q := neturl.Values{"player_id": {pid}}
+		if tok := c.Query("token"); tok != "" {
+			q.Set("token", tok)
+		}
+		url := fmt.Sprintf("http://%s:%d/heartbeat?%s", info.HostIP, port, q.Encode())
 		client := &http.Client{Timeout: cfg.Timeout.HTTPClient}
 		resp, err := client.Get(url)
 		if err != nil {
@@ -395,3 +985,156 @@ func main() {
 
 	log.Fatal(r.Run(":" + cfg.Server.Port))
 }
+
+// applyShutdown set FULFILLED với end_reason, graceful_at và kết quả trận:
+// result có kiểu (đã validate) > kết quả đã báo qua /result > winner/scores trong details (server cũ)
+func applyShutdown(st *store.RoomState, body dto.ShutdownRequest, key string, result *store.MatchResult) {
+	st.Status = "FULFILLED"
+	st.FailReason = ""
+	st.DeadAt = 0
+	st.EndReason = body.Reason
+	st.FulfilledAt = body.At
+	st.GracefulAt = body.At
+	st.ShutdownKey = key
+	if result != nil {
+		_ = store.ApplyResult(st, *result)
+		return
+	}
+	if st.Result == nil && body.Details != nil {
+		if v, ok := body.Details["winner"].(string); ok {
+			st.Winner = v
+		}
+		if m, ok := body.Details["scores"].(map[string]interface{}); ok {
+			st.Scores = map[string]int{}
+			for k, vv := range m {
+				switch n := vv.(type) {
+				case float64:
+					st.Scores[k] = int(n)
+				case int:
+					st.Scores[k] = n
+				}
+			}
+		}
+	}
+}
+
+// eventTypePattern type event server: chữ thường, số, '_' và '.'; prefix room_ dành cho lifecycle của agent
+var eventTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_.]{0,63}$`)
+
+// validateServerEvent kiểm tra type và kích thước payload của event server báo
+func validateServerEvent(body dto.RoomEventRequest) error {
+	switch {
+	case !eventTypePattern.MatchString(body.Type):
+		return fmt.Errorf("invalid event type %q", body.Type)
+	case strings.HasPrefix(body.Type, "room_"):
+		return fmt.Errorf("event type %q is reserved", body.Type)
+	case len(body.Payload) > 8<<10:
+		return fmt.Errorf("payload too large (%d bytes, max 8192)", len(body.Payload))
+	case len(body.Payload) > 0 && !json.Valid(body.Payload):
+		return fmt.Errorf("payload is not valid JSON")
+	}
+	return nil
+}
+
+// lobbyError trả lỗi của các API private room; true khi đã trả response lỗi
+func lobbyError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case store.IsNotFound(err):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeLobbyNotFound, Error: "lobby not found or expired"})
+	case errors.Is(err, mm.ErrUnknownQueue):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnknownQueue, Error: err.Error()})
+	case errors.Is(err, mm.ErrUnknownRegion):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnknownRegion, Error: err.Error()})
+	case errors.Is(err, mm.ErrInvalidLobby):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: err.Error()})
+	case errors.Is(err, store.ErrLobbyAuth):
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnauthorized, Error: err.Error()})
+	case errors.Is(err, store.ErrNotLobbyHost):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{ErrorCode: dto.ErrCodeNotLobbyHost, Error: err.Error()})
+	case errors.Is(err, store.ErrLobbyFull):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeLobbyFull, Error: err.Error()})
+	case errors.Is(err, store.ErrLobbyClosed):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{ErrorCode: dto.ErrCodeLobbyClosed, Error: err.Error()})
+	case errors.Is(err, mm.ErrNoCapacity):
+		c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{ErrorCode: dto.ErrCodeNoCapacity, Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+	}
+	return true
+}
+
+// bearerToken token trong header Authorization: Bearer (rỗng khi không có)
+func bearerToken(c *gin.Context) string {
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token
+}
+
+// normalizeLobbyCode join code không phân biệt hoa/thường, bỏ khoảng trắng thừa
+func normalizeLobbyCode(code string) string { return strings.ToUpper(strings.TrimSpace(code)) }
+
+// backfillError trả lỗi của GET/DELETE backfill; true khi đã trả response lỗi
+func backfillError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, mm.ErrNoBackfill):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeNoBackfill, Error: err.Error()})
+	case store.IsNotFound(err):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{ErrorCode: dto.ErrCodeRoomNotFound, Error: "room not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{ErrorCode: dto.ErrCodeRedisError, Error: err.Error()})
+	}
+	return true
+}
+
+// serverAuthorized kiểm tra Authorization: Bearer <token> của callback server → agent; sai thì trả 401
+func serverAuthorized(c *gin.Context, valid func(token string) bool) bool {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnauthorized, Error: "missing authorization header"})
+		return false
+	}
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || !valid(token) {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{ErrorCode: dto.ErrCodeUnauthorized, Error: "invalid authorization token"})
+		return false
+	}
+	return true
+}
+
+// adminBuildError map lỗi build/rollout sang error code
+func adminBuildError(err error) dto.ErrorResponse {
+	switch {
+	case errors.Is(err, mm.ErrUnknownQueue):
+		return dto.ErrorResponse{ErrorCode: dto.ErrCodeUnknownQueue, Error: err.Error()}
+	case errors.Is(err, mm.ErrUnknownBuild):
+		return dto.ErrorResponse{ErrorCode: dto.ErrCodeUnknownBuild, Error: err.Error()}
+	case errors.Is(err, svrmgr.ErrInvalidArtifact):
+		return dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidArtifact, Error: err.Error()}
+	}
+	return dto.ErrorResponse{ErrorCode: dto.ErrCodeInvalidRequest, Error: err.Error()}
+}
+
+// toArtifact chuyển artifact từ config sang svrmgr (nil nếu queue dùng binary cài sẵn)
+func toArtifact(a *config.ArtifactConfig) *svrmgr.Artifact {
+	if a == nil {
+		return nil
+	}
+	out := svrmgr.Artifact(*a)
+	return &out
+}
+
+// toAddressOptions chuyển cấu hình địa chỉ public của region sang svrmgr
+func toAddressOptions(rc config.RegionConfig) svrmgr.AddressOptions {
+	opts := svrmgr.AddressOptions{
+		MetaKeys:      rc.PublicAddressMeta,
+		Attributes:    rc.PublicAddressAttributes,
+		OverridesFile: rc.NodeAddressFile,
+	}
+	for _, mapping := range rc.IPMappings {
+		opts.Mappings = append(opts.Mappings, svrmgr.IPMapping(mapping))
+	}
+	return opts
+}
@@ -24,6 +24,9 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Matchmaking.CheckQueues(); err != nil {
+		log.Fatalf("config: %v", err)
+	}
 
 	// Ensure Nomad address has fallback
 	nomadAddress := cfg.Nomad.Address
@@ -44,23 +47,19 @@ func main() {
 		datacenters = []string{"dc1"}
 	}
 	svrMgr.SetDatacenters(datacenters)
+	// Owner riêng để cron của agent (nếu dùng chung Nomad) không coi job agent_v2 là stray
+	svrMgr.SetJobOwner("agent_v2", cfg.Server.AgentID)
 
-	// Set IP mappings with fallback
-	ipMappings := []svrmgr.IPMapping{}
-	if len(cfg.Nomad.IPMappings) > 0 {
-		for _, mapping := range cfg.Nomad.IPMappings {
-			ipMappings = append(ipMappings, svrmgr.IPMapping{
-				PrivateIP: mapping.PrivateIP,
-				PublicIP:  mapping.PublicIP,
-			})
-		}
-	} else {
-		// Fallback to default IP mapping
-		ipMappings = []svrmgr.IPMapping{
-			{PrivateIP: "10.0.0.23", PublicIP: "20.205.180.232"},
-		}
+	// Địa chỉ public: node meta/attributes, override file, NOMAD_IP_MAPPINGS
+	addrOpts := svrmgr.AddressOptions{
+		MetaKeys:      cfg.Nomad.PublicAddressMeta,
+		Attributes:    cfg.Nomad.PublicAddressAttributes,
+		OverridesFile: cfg.Nomad.NodeAddressFile,
 	}
-	svrmgr.SetIPMappingConfig(&svrmgr.IPMappingConfig{Mappings: ipMappings})
+	for _, mapping := range cfg.Nomad.IPMappings {
+		addrOpts.Mappings = append(addrOpts.Mappings, svrmgr.IPMapping(mapping))
+	}
+	svrMgr.SetAddressOptions(addrOpts)
 
 	r := gin.Default()
 
@@ -75,18 +74,6 @@ func main() {
 
 	// Create room endpoint
 	r.GET("/create_room", func(c *gin.Context) {
-		// Cap số lượng job game-server đang chạy ở mức 4
-		running, err := svrMgr.CountRunningJobsByNamePrefix("game-server-")
-		if err == nil && running >= 4 {
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "fail",
-				"message": "capacity reached",
-				"running": running,
-				"limit":   4,
-			})
-			return
-		}
-
 		roomID := c.Query("room_id")
 		if roomID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -133,7 +120,38 @@ func main() {
 
 		// Start Nomad job with room_id and custom resources
 		command := "/usr/local/bin/linuxserver/MetaDOSServer.x86_64"
-		if err := svrMgr.RunGameServerV2(roomID, cpu, memoryMB, command, args); err != nil {
+		tpl := svrmgr.JobTemplate{Command: command, Args: args, CPU: cpu, MemoryMB: memoryMB}
+		// Placement/resources riêng theo game_type nếu có cấu hình trong QUEUES_FILE
+		if q, ok := cfg.Matchmaking.Queue(gameType); ok {
+			if q.CPU > 0 {
+				tpl.CPU = q.CPU
+			}
+			if q.MemoryMB > 0 {
+				tpl.MemoryMB = q.MemoryMB
+			}
+			tpl.Placement = svrmgr.PlacementFromConfig(q.Placement)
+			tpl.DiskMB = q.DiskMB
+			if q.Command != "" {
+				tpl.Command = q.Command
+			}
+			if a := toArtifact(q.Artifact); a != nil {
+				tpl.Artifacts = []svrmgr.Artifact{*a}
+			}
+		}
+		// Admission theo capacity thực của Nomad thay vì cap cứng số job
+		if fleet, cerr := svrMgr.Capacity(); cerr == nil {
+			if slots := fleet.Slots(tpl.CPU, tpl.MemoryMB, tpl.Placement); slots == 0 {
+				c.JSON(http.StatusOK, gin.H{
+					"status":    "fail",
+					"message":   "capacity reached",
+					"cpu":       tpl.CPU,
+					"memory_mb": tpl.MemoryMB,
+					"node_pool": tpl.Placement.NodePool,
+				})
+				return
+			}
+		}
+		if err := svrMgr.RunGameServerTemplate(roomID, tpl); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": fmt.Sprintf("Failed to start server: %v", err),
 			})
@@ -145,8 +163,9 @@ func main() {
 			"room_id":          roomID,
 			"game_type":        gameType,
 			"gametype_numeric": mappedGameType,
-			"cpu":              cpu,
-			"memory_mb":        memoryMB,
+			"cpu":              tpl.CPU,
+			"memory_mb":        tpl.MemoryMB,
+			"node_pool":        tpl.Placement.NodePool,
 			"args":             args,
 			"message":          "Server job started successfully",
 		})
@@ -192,11 +211,12 @@ func main() {
 		// Allocated?
 		if roomInfo.HostIP != "" && len(roomInfo.Ports) > 0 {
 			c.JSON(http.StatusOK, gin.H{
-				"room_id": roomID,
-				"status":  "allocated",
-				"host_ip": roomInfo.HostIP,
-				"ports":   roomInfo.Ports,
-				"message": "Server is allocated",
+				"room_id":  roomID,
+				"status":   "allocated",
+				"host_ip":  roomInfo.HostIP,
+				"hostname": roomInfo.Hostname,
+				"ports":    roomInfo.Ports,
+				"message":  "Server is allocated",
 			})
 			return
 		}
@@ -209,6 +229,16 @@ func main() {
 		})
 	})
 
+	// Fleet capacity
+	r.GET("/capacity", func(c *gin.Context) {
+		fleet, err := svrMgr.Capacity()
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, fleet)
+	})
+
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -219,3 +249,12 @@ func main() {
 
 	log.Fatal(r.Run(":8080"))
 }
+
+// toArtifact chuyển artifact từ config sang svrmgr (nil nếu queue dùng binary cài sẵn)
+func toArtifact(a *config.ArtifactConfig) *svrmgr.Artifact {
+	if a == nil {
+		return nil
+	}
+	out := svrmgr.Artifact(*a)
+	return &out
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,69 +16,6 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-type playerInfo struct {
-	PlayerID string `json:"player_id"`
-	State    string `json:"state"`
-	LastSeen int64  `json:"last_seen_unix"`
-}
-
-type playerStore struct {
-	mu       sync.RWMutex
-	lastSeen map[string]time.Time
-}
-
-func newPlayerStore() *playerStore { return &playerStore{lastSeen: make(map[string]time.Time)} }
-
-func (ps *playerStore) heartbeat(pid string) {
-	ps.mu.Lock()
-	ps.lastSeen[pid] = time.Now()
-	ps.mu.Unlock()
-}
-
-func (ps *playerStore) size() int {
-	ps.mu.RLock()
-	defer ps.mu.RUnlock()
-	return len(ps.lastSeen)
-}
-
-func (ps *playerStore) snapshot(now time.Time, ttl time.Duration) []playerInfo {
-	ps.mu.RLock()
-	defer ps.mu.RUnlock()
-	res := make([]playerInfo, 0, len(ps.lastSeen))
-	for id, ts := range ps.lastSeen {
-		state := "connected"
-		if now.Sub(ts) > ttl {
-			state = "disconnected"
-		}
-		res = append(res, playerInfo{PlayerID: id, State: state, LastSeen: ts.Unix()})
-	}
-	return res
-}
-
-func (ps *playerStore) anyDisconnected(now time.Time, ttl time.Duration) (bool, string) {
-	ps.mu.RLock()
-	defer ps.mu.RUnlock()
-	for id, ts := range ps.lastSeen {
-		if now.Sub(ts) > ttl {
-			return true, id
-		}
-	}
-	return false, ""
-}
-
-// countActive returns number of players with heartbeat within TTL
-func (ps *playerStore) countActive(now time.Time, ttl time.Duration) int {
-	ps.mu.RLock()
-	defer ps.mu.RUnlock()
-	active := 0
-	for _, ts := range ps.lastSeen {
-		if now.Sub(ts) <= ttl {
-			active++
-		}
-	}
-	return active
-}
-
 func ginLog(format string, args ...interface{}) { fmt.Fprintf(gin.DefaultWriter, format+"\n", args...) }
 
 func main() {
@@ -124,8 +61,10 @@ func main() {
 		c.Next()
 	})
 
-	players := newPlayerStore()
 	heartbeatTTL := 10 * time.Second
+	// Session player: mất heartbeat quá TTL → disconnected, không quay lại trong reconnect window → left
+	// (window lấy từ assignment, mặc định 60s khi chưa có)
+	players := svrsdk.NewSessionTracker(heartbeatTTL, 60*time.Second)
 	initialGrace := 20 * time.Second // bắt đầu kiểm tra sau 20s
 	var activeShutdown int32
 
@@ -135,42 +74,167 @@ func main() {
 		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
 	})
 
-	// API
-	r.GET("/heartbeat", func(c *gin.Context) {
+	// Assignment từ agent (nil khi chưa lấy được → chấp nhận mọi player)
+	var assignment atomic.Pointer[svrsdk.Assignment]
+	// Join token: agent bật JOIN_TOKEN_KEY → player phải gửi token agent cấp qua GET /tickets/:id
+	sdk := svrsdk.Init(cfg)
+	verifier := sdk.NewJoinVerifier()
+
+	// AFK: player không có input quá 60s (mọi player cùng AFK mới shutdown)
+	afk := &svrsdk.AfkSource{Timeout: 60 * time.Second, AllPlayers: true}
+	// WebSocket transport: heartbeat, join/leave và relay message giữa player trong room
+	hub := newWSHub(players, afk)
+	backfillOnLeave, _ := strconv.ParseBool(os.Getenv("HIVE_BACKFILL_ON_LEAVE"))
+	players.OnEvent = func(ev svrsdk.SessionEvent) {
+		ginLog("session %s: %s (reconnects=%d)", ev.Type, ev.Session.PlayerID, ev.Session.Reconnects)
+		switch ev.Type {
+		case svrsdk.SessionEventDisconnected, svrsdk.SessionEventLeft:
+			// player mất kết nối không tính AFK; tất cả mất kết nối → tạm dừng chờ reconnect
+			afk.RemovePlayer(ev.Session.PlayerID)
+			if ev.Type == svrsdk.SessionEventLeft {
+				hub.broadcast("leave", ev.Session.PlayerID, "left")
+				// báo agent player bỏ trận (best-effort)
+				go func(s svrsdk.Session) {
+					err := sdk.ReportEvent(context.Background(), svrsdk.EventPlayerAbandoned, map[string]any{
+						"player_id": s.PlayerID, "disconnected_at_unix": s.DisconnectedAt, "reconnects": s.Reconnects,
+					})
+					if err != nil {
+						ginLog("report %s failed: %v", svrsdk.EventPlayerAbandoned, err)
+					}
+					// HIVE_BACKFILL_ON_LEAVE: xin một player thay thế cho chỗ trống, giữ team của player vừa rời
+					if backfillOnLeave {
+						team := ""
+						if a := assignment.Load(); a != nil {
+							if p, ok := a.Player(s.PlayerID); ok {
+								team = p.Team
+							}
+						}
+						if bf, err := sdk.RequestBackfill(context.Background(), 1, team); err != nil {
+							ginLog("backfill request failed: %v", err)
+						} else {
+							ginLog("backfill %s opened: slots=%d team=%q", bf.BackfillID, bf.Slots, bf.Team)
+						}
+					}
+				}(ev.Session)
+			}
+			if players.Paused() {
+				ginLog("all players disconnected, match paused")
+			}
+		case svrsdk.SessionEventReconnected:
+			afk.ReportInput(ev.Session.PlayerID)
+		}
+	}
+
+	// authorizePlayer kiểm tra player_id, join token và assignment; sai thì trả lỗi
+	authorizePlayer := func(c *gin.Context) (string, bool) {
 		pid := c.Query("player_id")
 		if pid == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "player_id is required"})
+			return "", false
+		}
+		if verifier.Enabled() {
+			tokenPID, err := verifier.Verify(c.Query("token"))
+			if err != nil || tokenPID != pid {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid join token"})
+				return "", false
+			}
+		}
+		// hết reconnect window thì không cho vào lại
+		if s, ok := players.Get(pid); ok && s.State == svrsdk.SessionLeft {
+			c.JSON(http.StatusGone, gin.H{"error": "reconnect window expired"})
+			return "", false
+		}
+		if a := assignment.Load(); a != nil {
+			if _, ok := a.Player(pid); !ok {
+				// player lạ có thể vừa được ghép qua backfill → lấy lại assignment một lần
+				if fresh, err := sdk.FetchAssignment(c.Request.Context()); err == nil {
+					assignment.Store(fresh)
+					players.SetExpectedFromAssignment(fresh)
+					a = fresh
+				}
+				if _, ok := a.Player(pid); !ok {
+					c.JSON(http.StatusForbidden, gin.H{"error": "player not assigned to this room"})
+					return "", false
+				}
+			}
+		}
+		return pid, true
+	}
+
+	// API
+	r.GET("/heartbeat", func(c *gin.Context) {
+		pid, ok := authorizePlayer(c)
+		if !ok {
 			return
 		}
-		players.heartbeat(pid)
+		players.Heartbeat(pid)
 		ginLog("heartbeat from %s", pid)
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	})
 
+	// WebSocket: /ws?player_id=&token= (xác thực như /heartbeat)
+	r.GET("/ws", func(c *gin.Context) {
+		pid, ok := authorizePlayer(c)
+		if !ok {
+			return
+		}
+		hub.serve(c.Writer, c.Request, pid, roomID)
+	})
+
+	// Input thật của player (khác heartbeat kết nối) → reset AFK
+	r.GET("/input", func(c *gin.Context) {
+		pid, ok := authorizePlayer(c)
+		if !ok {
+			return
+		}
+		afk.ReportInput(pid)
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
 	r.GET("/players", func(c *gin.Context) {
-		list := players.snapshot(time.Now(), heartbeatTTL)
-		c.JSON(http.StatusOK, gin.H{"players": list, "room_id": roomID})
+		c.JSON(http.StatusOK, gin.H{"players": players.Snapshot(), "missing": players.Missing(), "room_id": roomID})
 	})
 
 	// SDK: build sources and final handler to notify agent and stop server
-	sdk := svrsdk.Init(cfg)
+	startedAt := time.Now()
+	sdk.Use(svrsdk.RateLimitMiddleware(5 * time.Second))
+	sdk.Use(svrsdk.LoggingMiddleware(ginLog))
+	// no_clients: chờ thêm 10s, player vào lại thì huỷ
+	sdk.Use(svrsdk.DebounceMiddleware(svrsdk.ReasonNoClients, 10*time.Second, func() bool {
+		return players.Present() == 0
+	}))
+	sdk.Use(svrsdk.EnrichDetailsMiddleware(func(ev svrsdk.ShutdownEvent) map[string]any {
+		return map[string]any{
+			"players":          players.Snapshot(),
+			"missing_players":  players.Missing(),
+			"duration_seconds": int64(time.Since(startedAt) / time.Second),
+		}
+	}))
 	sdk.UseSource(&svrsdk.SignalSource{})
-	// Chỉ shutdown khi không còn player nào (size==0) sau grace
+	// no_clients: chưa ai vào sau initial grace; client_disconnected: mọi player đã hết reconnect window
 	sdk.UseSource(&svrsdk.HeartbeatSource{
 		InitialGrace: initialGrace,
 		HeartbeatTTL: heartbeatTTL,
 		PollInterval: time.Second,
-		GetStats: func() (int, bool) {
-			now := time.Now()
-			active := players.countActive(now, heartbeatTTL)
-			return active, active == 0
-		},
+		GetStats:     players.StatsFunc(false),
 	})
+	sdk.UseSource(afk)
+	// Giới hạn cứng thời lượng trận (HIVE_MAX_MATCH_SECONDS, mặc định 30 phút)
+	maxMatch := 30 * time.Minute
+	if v, err := strconv.Atoi(os.Getenv("HIVE_MAX_MATCH_SECONDS")); err == nil && v > 0 {
+		maxMatch = time.Duration(v) * time.Second
+	}
+	sdk.UseSource(&svrsdk.MaxDurationSource{Duration: maxMatch})
 
 	srv := &http.Server{Addr: ":" + serverPort, Handler: r}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		ginLog("listen error: %v", err)
+		os.Exit(1)
+	}
 	go func() {
 		ginLog("server listening on :%s room=%s", serverPort, roomID)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			if atomic.LoadInt32(&activeShutdown) == 1 {
 				ginLog("server closed after active shutdown: %v", err)
 				return
@@ -180,12 +244,51 @@ func main() {
 		}
 	}()
 
+	// Gửi lại shutdown event của process trước còn nằm trong spool
+	if cfg.SpoolDir != "" {
+		go func() {
+			n, err := svrsdk.ReplaySpool(context.Background(), cfg.SpoolDir, &svrsdk.AgentNotifier{})
+			if n > 0 || err != nil {
+				ginLog("spool replay: sent=%d err=%v", n, err)
+			}
+		}()
+	}
+
+	// Lấy assignment rồi báo agent ready (room chỉ ACTIVED sau callback này); retry khi agent chưa phản hồi
+	go func() {
+		for i := 0; i < 5; i++ {
+			a, err := sdk.FetchAssignment(context.Background())
+			if err == nil {
+				assignment.Store(a)
+				players.SetExpectedFromAssignment(a)
+				players.SetReconnectGrace(time.Duration(a.ReconnectWindowSeconds) * time.Second)
+				ginLog("assignment: queue=%s players=%d teams=%v", a.Queue, len(a.Players), a.Teams)
+				break
+			}
+			ginLog("fetch assignment failed: %v", err)
+			time.Sleep(2 * time.Second)
+		}
+		for i := 0; i < 5; i++ {
+			err := sdk.Ready(context.Background())
+			if err == nil {
+				ginLog("ready reported to agent")
+				return
+			}
+			ginLog("ready callback failed: %v", err)
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
 	shutdownCh := make(chan struct{}, 1)
 	sdk.SetFinalHandler(func(sc *svrsdk.ShutdownContext) svrsdk.ShutdownResult {
-		// gửi notify tới Agent
-		n := &svrsdk.AgentNotifier{}
+		// gửi notify tới Agent (retry + backoff; agent vẫn không nhận → spool ra HIVE_SPOOL_DIR nếu có)
+		n := &svrsdk.AgentNotifier{SpoolDir: sc.Config.SpoolDir}
 		err := n.Notify(sc.Ctx, sc.Config, *sc.Event)
-		// báo main goroutine để shutdown HTTP server
+		if err != nil {
+			ginLog("shutdown notify failed: %v", err)
+		}
+		// báo client WebSocket rồi báo main goroutine để shutdown HTTP server
+		hub.closeAll(string(sc.Event.Reason))
 		atomic.StoreInt32(&activeShutdown, 1)
 		select {
 		case shutdownCh <- struct{}{}:
@@ -200,6 +303,20 @@ func main() {
 		}
 	}()
 
+	// Heartbeat telemetry về agent (mất heartbeat quá timeout → agent đánh DEAD heartbeat_lost)
+	stopHeartbeat := sdk.StartHeartbeat(10*time.Second, func() svrsdk.Heartbeat {
+		ids := players.Connected()
+		phase := "waiting"
+		switch {
+		case len(ids) > 0:
+			phase = "playing"
+		case players.Paused():
+			phase = "paused"
+		}
+		return svrsdk.Heartbeat{PlayerCount: len(ids), Players: ids, Disconnected: players.Disconnected(), Phase: phase}
+	})
+	defer stopHeartbeat()
+
 	// Giả lập endgame: khi đã có client, sau 5 phút có 50% khả năng kết thúc game
 	// go func() {
 	// 	rand.Seed(time.Now().UnixNano())
@@ -210,7 +327,7 @@ func main() {
 	// 		if atomic.LoadInt32(&activeShutdown) == 1 {
 	// 			return
 	// 		}
-	// 		if players.size() > 0 {
+	// 		if players.Present() > 0 {
 	// 			break
 	// 		}
 	// 		<-ticker.C
@@ -225,25 +342,26 @@ func main() {
 	// 	}
 	// 	// 50% xác suất
 	// 	if rand.Intn(2) == 0 {
-	// 		list := players.snapshot(time.Now(), heartbeatTTL)
+	// 		list := players.Snapshot()
 	// 		if len(list) == 0 {
 	// 			return
 	// 		}
-	// 		scores := map[string]int{}
-	// 		winner := ""
+	// 		res := svrsdk.MatchResult{DurationSeconds: int64(time.Since(startedAt) / time.Second)}
 	// 		best := -1
 	// 		for _, p := range list {
 	// 			s := rand.Intn(20)
-	// 			scores[p.PlayerID] = s
+	// 			res.Players = append(res.Players, svrsdk.PlayerResult{PlayerID: p.PlayerID, Score: s, Placement: 1})
 	// 			if s > best {
 	// 				best = s
-	// 				winner = p.PlayerID
+	// 				res.Winner = p.PlayerID
+	// 			}
+	// 		}
+	// 		for i := range res.Players {
+	// 			if res.Players[i].PlayerID != res.Winner {
+	// 				res.Players[i].Placement = 2
 	// 			}
 	// 		}
-	// 		_ = sdk.SendShutdownWithDetails(svrsdk.ReasonGameCycleCompleted, map[string]any{
-	// 			"winner": winner,
-	// 			"scores": scores,
-	// 		})
+	// 		_ = sdk.SendShutdownWithResult(svrsdk.ReasonGameCycleCompleted, res)
 	// 	}
 	// }()
 
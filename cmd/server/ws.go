@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"hive/pkg/svrsdk"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsMessage khung JSON dùng cho cả hai chiều của /ws
+//
+//	client → server: heartbeat | input | message (to rỗng = cả room) | leave
+//	server → client: welcome | join | disconnect | leave | message | error | shutdown
+type wsMessage struct {
+	Type     string          `json:"type"`
+	PlayerID string          `json:"player_id,omitempty"`
+	From     string          `json:"from,omitempty"`
+	To       []string        `json:"to,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	RoomID   string          `json:"room_id,omitempty"`
+	Players  []string        `json:"players,omitempty"`
+	Reason   string          `json:"reason,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	At       int64           `json:"at"`
+}
+
+const (
+	wsWriteWait    = 5 * time.Second
+	wsMaxMessage   = 64 << 10
+	wsSendBuffer   = 64
+	wsPingInterval = 5 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true }, // CORS mở như HTTP API
+}
+
+type wsConn struct {
+	pid  string
+	ws   *websocket.Conn
+	send chan wsMessage
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// push xếp msg vào hàng gửi; false khi đã đóng hoặc buffer đầy (client quá chậm)
+func (c *wsConn) push(msg wsMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// close đóng kênh gửi; writer gửi close frame rồi đóng socket
+func (c *wsConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// wsHub giữ một kết nối mỗi player và relay message trong room
+type wsHub struct {
+	mu      sync.RWMutex
+	conns   map[string]*wsConn
+	players *svrsdk.SessionTracker
+	afk     *svrsdk.AfkSource
+	closed  bool
+}
+
+func newWSHub(players *svrsdk.SessionTracker, afk *svrsdk.AfkSource) *wsHub {
+	return &wsHub{conns: map[string]*wsConn{}, players: players, afk: afk}
+}
+
+// members trả player đang có socket mở
+func (h *wsHub) members() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.conns))
+	for id := range h.conns {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// deliver gửi msg cho các player trong to (rỗng = mọi người) trừ except; client chậm (đầy buffer) bị ngắt
+func (h *wsHub) deliver(msg wsMessage, to []string, except string) {
+	h.mu.RLock()
+	targets := make([]*wsConn, 0, len(h.conns))
+	if len(to) == 0 {
+		for id, c := range h.conns {
+			if id != except {
+				targets = append(targets, c)
+			}
+		}
+	} else {
+		for _, id := range to {
+			if c, ok := h.conns[id]; ok && id != except {
+				targets = append(targets, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+	for _, c := range targets {
+		if !c.push(msg) {
+			ginLog("ws: %s send buffer full, dropping connection", c.pid)
+			c.close()
+		}
+	}
+}
+
+// broadcast gửi event hệ thống cho cả room
+func (h *wsHub) broadcast(typ, pid, reason string) {
+	h.deliver(wsMessage{Type: typ, PlayerID: pid, Reason: reason, At: time.Now().Unix()}, nil, pid)
+}
+
+// closeAll báo shutdown cho mọi client rồi đóng socket; không nhận kết nối mới nữa
+func (h *wsHub) closeAll(reason string) {
+	h.mu.Lock()
+	h.closed = true
+	conns := h.conns
+	h.conns = map[string]*wsConn{}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.push(wsMessage{Type: "shutdown", Reason: reason, At: time.Now().Unix()})
+		c.close()
+	}
+}
+
+// serve nâng cấp HTTP lên WebSocket cho player đã được authorizePlayer chấp nhận
+func (h *wsHub) serve(w http.ResponseWriter, r *http.Request, pid, roomID string) {
+	ws, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		ginLog("ws upgrade %s: %v", pid, err)
+		return
+	}
+	c := &wsConn{pid: pid, ws: ws, send: make(chan wsMessage, wsSendBuffer)}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(wsWriteWait))
+		_ = ws.Close()
+		return
+	}
+	// một player một socket: kết nối mới (reconnect) thay kết nối cũ
+	old := h.conns[pid]
+	h.conns[pid] = c
+	h.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+
+	go c.writeLoop()
+	h.players.Heartbeat(pid)
+	h.afk.ReportInput(pid)
+	c.push(wsMessage{Type: "welcome", PlayerID: pid, RoomID: roomID, Players: h.members(), At: time.Now().Unix()})
+	if old == nil {
+		h.broadcast("join", pid, "")
+	}
+	h.readLoop(c)
+}
+
+func (h *wsHub) readLoop(c *wsConn) {
+	left := false
+	defer func() {
+		h.mu.Lock()
+		current := h.conns[c.pid] == c
+		if current {
+			delete(h.conns, c.pid)
+		}
+		h.mu.Unlock()
+		c.close()
+		if !current {
+			return // bị kết nối mới thay thế
+		}
+		if left {
+			h.players.Leave(c.pid) // event leave do session OnEvent phát
+			return
+		}
+		// socket đóng bất thường → bắt đầu reconnect window
+		h.players.Disconnect(c.pid)
+		h.broadcast("disconnect", c.pid, "connection_lost")
+	}()
+
+	c.ws.SetReadLimit(wsMaxMessage)
+	deadline := func() { _ = c.ws.SetReadDeadline(time.Now().Add(2 * wsPingInterval)) }
+	deadline()
+	c.ws.SetPongHandler(func(string) error {
+		deadline()
+		h.players.Heartbeat(c.pid)
+		return nil
+	})
+	for {
+		var msg wsMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				ginLog("ws read %s: %v", c.pid, err)
+			}
+			return
+		}
+		deadline()
+		h.players.Heartbeat(c.pid)
+		switch msg.Type {
+		case "heartbeat":
+		case "input":
+			h.afk.ReportInput(c.pid)
+		case "message":
+			// relay cho room (hoặc các player trong to), message game cũng tính là input
+			h.afk.ReportInput(c.pid)
+			h.deliver(wsMessage{Type: "message", From: c.pid, Data: msg.Data, At: time.Now().Unix()}, msg.To, c.pid)
+		case "leave":
+			left = true
+			return
+		default:
+			c.push(wsMessage{Type: "error", Error: "unknown message type: " + msg.Type, At: time.Now().Unix()})
+		}
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		_ = c.ws.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				_ = c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := c.ws.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package testutil tiện ích cho kịch bản test/local, không dùng trong agent production.
+package testutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hive/pkg/svrmgr"
+)
+
+// ArtifactServer file server tối giản phục vụ build archive qua HTTP, thay cho S3/CDN
+// khi chạy local hoặc trong kịch bản test (Nomad client dev-mode tải artifact từ đây).
+type ArtifactServer struct {
+	dir     string
+	baseURL string
+	ln      net.Listener
+	srv     *http.Server
+}
+
+// NewArtifactServer phục vụ thư mục dir tại addr (ví dụ "127.0.0.1:0" để lấy port ngẫu nhiên).
+// publicHost ghi đè host trong URL trả về khi Nomad client truy cập qua địa chỉ khác (rỗng = addr thật).
+func NewArtifactServer(dir, addr, publicHost string) (*ArtifactServer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host := ln.Addr().String()
+	if publicHost != "" {
+		_, port, _ := net.SplitHostPort(host)
+		host = net.JoinHostPort(publicHost, port)
+	}
+	s := &ArtifactServer{
+		dir:     dir,
+		baseURL: "http://" + host,
+		ln:      ln,
+		srv:     &http.Server{Handler: http.FileServer(http.Dir(dir)), ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() { _ = s.srv.Serve(ln) }()
+	return s, nil
+}
+
+// URL trả địa chỉ gốc của server, ví dụ http://127.0.0.1:39213
+func (s *ArtifactServer) URL() string { return s.baseURL }
+
+// Publish ghi data thành file name trong thư mục phục vụ và trả svrmgr.Artifact kèm checksum sha256
+func (s *ArtifactServer) Publish(name string, data []byte) (svrmgr.Artifact, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return svrmgr.Artifact{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return svrmgr.Artifact{}, err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return svrmgr.Artifact{}, err
+	}
+	return s.Artifact(name)
+}
+
+// Artifact trả svrmgr.Artifact cho file đã có trong thư mục phục vụ (tính checksum từ nội dung hiện tại)
+func (s *ArtifactServer) Artifact(name string) (svrmgr.Artifact, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return svrmgr.Artifact{}, err
+	}
+	sum, err := FileChecksum(path)
+	if err != nil {
+		return svrmgr.Artifact{}, err
+	}
+	return svrmgr.Artifact{Source: s.baseURL + "/" + filepath.ToSlash(filepath.Clean(name)), Checksum: sum}, nil
+}
+
+// Close dừng server
+func (s *ArtifactServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+// path chặn name thoát ra ngoài thư mục phục vụ
+func (s *ArtifactServer) path(name string) (string, error) {
+	clean := filepath.Clean("/" + name)
+	if clean == "/" || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid artifact name: %q", name)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+// Checksum tính checksum sha256 của dữ liệu đọc từ r theo định dạng "sha256:<hex>"
+func Checksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FileChecksum tính checksum sha256 của file (dùng khi publish build)
+func FileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Checksum(f)
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -29,6 +31,9 @@ type Config struct {
 
 	// Auth config - Secrets/tokens for callbacks
 	Auth AuthConfig `json:"auth"`
+
+	// Leader config - Leader election between agents
+	Leader LeaderConfig `json:"leader"`
 }
 
 // ServerConfig holds HTTP server configuration
@@ -37,6 +42,16 @@ type ServerConfig struct {
 	// Type: string, Format: "8080", "3000", etc.
 	// Range: Valid port numbers (1-65535)
 	Port string `json:"port"`
+
+	// AgentID - Unique ID of this agent process (leader election, job ownership)
+	// Type: string, Format: "agent-1", "ip-10-0-0-5"
+	// Range: Empty = "<hostname>-<pid>"
+	AgentID string `json:"agent_id"`
+
+	// Owner - Owner tag written to job Meta; agents sharing Redis must use the same value
+	// Type: string, Format: "hive", "hive-staging"
+	// Range: Non-empty; the reconciler only stops stray jobs carrying this owner
+	Owner string `json:"owner"`
 }
 
 // RedisConfig holds Redis connection configuration
@@ -57,12 +72,87 @@ type NomadConfig struct {
 	// Type: []string, Format: ["dc1"], ["dc1", "dc2"]
 	// Range: Valid datacenter names
 
-	// IPMappings - Private to public IP address mappings
+	// IPMappings - Private to public IP address overrides
 	// Type: []IPMapping, Format: [{"private_ip": "172.26.15.163", "public_ip": "52.221.213.97"}]
-	// Range: Valid IP address pairs
+	// Range: Valid IP address pairs (empty = resolve from node meta/attributes)
 	Address     string      `json:"address"`
 	Datacenters []string    `json:"datacenters"`
 	IPMappings  []IPMapping `json:"ip_mappings"`
+
+	// PublicAddressMeta - Node meta keys holding the public IP or DNS name, checked in order
+	// Type: []string, Format: "public_ip,public_hostname"
+	PublicAddressMeta []string `json:"public_address_meta"`
+
+	// PublicAddressAttributes - Node attributes holding the public IP, checked after meta
+	// Type: []string, Format: "unique.platform.aws.public-ipv4"
+	PublicAddressAttributes []string `json:"public_address_attributes"`
+
+	// NodeAddressFile - JSON file of per-node overrides, re-read when it changes
+	// Type: string, Format: "/etc/hive/node_addresses.json" containing {"<node id|name|private ip>": "<ip|hostname>"}
+	NodeAddressFile string `json:"node_address_file"`
+
+	// Regions - Named Nomad clusters loaded from NOMAD_REGIONS_FILE
+	// Type: []RegionConfig, Format: JSON file {"regions": [{"name": "sg", "address": "http://10.0.0.1:4646", ...}]}
+	// Range: Empty means a single "default" region built from Address/Datacenters/IPMappings
+	Regions []RegionConfig `json:"regions"`
+	// regionsErr lỗi đọc/parse NOMAD_REGIONS_FILE (CheckRegions)
+	regionsErr error
+}
+
+// RegionConfig holds one Nomad cluster that rooms can be allocated into
+type RegionConfig struct {
+	// Name - Region name used by tickets (regions, latencies_ms)
+	// Type: string, Format: "sg", "us-west"
+	Name string `json:"name"`
+
+	// Address - Nomad HTTP API endpoint of this region
+	// Type: string, Format: "http://host:port"
+	Address string `json:"address"`
+
+	// Datacenters - Nomad datacenters of this region
+	// Type: []string, Format: ["dc1"]
+	Datacenters []string `json:"datacenters"`
+
+	// IPMappings - Private to public IP overrides of this region
+	// Type: []IPMapping, Format: [{"private_ip": "10.0.0.23", "public_ip": "20.205.180.232"}]
+	IPMappings []IPMapping `json:"ip_mappings"`
+
+	// PublicAddressMeta, PublicAddressAttributes, NodeAddressFile - Same as NomadConfig (empty = inherit)
+	PublicAddressMeta       []string `json:"public_address_meta"`
+	PublicAddressAttributes []string `json:"public_address_attributes"`
+	NodeAddressFile         string   `json:"node_address_file"`
+}
+
+// DefaultRegion is the region name used when NOMAD_REGIONS_FILE is not set
+const DefaultRegion = "default"
+
+// AllRegions returns configured regions, or a single default region from Address/Datacenters/IPMappings
+func (n NomadConfig) AllRegions() []RegionConfig {
+	if len(n.Regions) > 0 {
+		out := make([]RegionConfig, 0, len(n.Regions))
+		for _, r := range n.Regions {
+			if len(r.PublicAddressMeta) == 0 {
+				r.PublicAddressMeta = n.PublicAddressMeta
+			}
+			if len(r.PublicAddressAttributes) == 0 {
+				r.PublicAddressAttributes = n.PublicAddressAttributes
+			}
+			if r.NodeAddressFile == "" {
+				r.NodeAddressFile = n.NodeAddressFile
+			}
+			out = append(out, r)
+		}
+		return out
+	}
+	return []RegionConfig{{
+		Name:                    DefaultRegion,
+		Address:                 n.Address,
+		Datacenters:             n.Datacenters,
+		IPMappings:              n.IPMappings,
+		PublicAddressMeta:       n.PublicAddressMeta,
+		PublicAddressAttributes: n.PublicAddressAttributes,
+		NodeAddressFile:         n.NodeAddressFile,
+	}}
 }
 
 // IPMapping represents a private to public IP address mapping
@@ -104,6 +194,181 @@ type MatchmakingConfig struct {
 	// Type: string, Format: "/usr/local/bin/boardserver/server.x86_64"
 	// Range: Valid file paths
 	ExecutablePath string `json:"executable_path"`
+
+	// MatcherInterval - How often the background matcher retries every queue
+	// Type: time.Duration, Format: "2s", "5s"
+	// Range: 1s - 1m (recommended: 2-5s)
+	MatcherInterval time.Duration `json:"matcher_interval"`
+
+	// AdmissionControl - Hold tickets instead of creating rooms when fleet capacity is exhausted
+	// Type: bool, Format: "true", "false"
+	AdmissionControl bool `json:"admission_control"`
+
+	// CapacityCacheTTL - How long a Nomad capacity snapshot is reused for admission
+	// Type: time.Duration, Format: "5s", "10s"
+	// Range: 1s - 1m (recommended: 5s)
+	CapacityCacheTTL time.Duration `json:"capacity_cache_ttl"`
+
+	// ReadyMode - How the agent decides a room is ready before OPENED → ACTIVED
+	// Type: string, Format: "callback", "tcp", "http", "none"
+	// Range: callback = server calls svrsdk Ready(); tcp/http = agent probes server_ip:port; none = legacy (Nomad running)
+	ReadyMode string `json:"ready_mode"`
+
+	// ReadyTimeout - Max wait for readiness after the allocation has an address; then DEAD(ready_timeout)
+	// Type: time.Duration, Format: "60s", "2m"
+	// Range: 5s - ALLOCATION_TIMEOUT (recommended: 60s)
+	ReadyTimeout time.Duration `json:"ready_timeout"`
+
+	// ReadyProbePath - HTTP path probed when ReadyMode is http
+	// Type: string, Format: "/", "/healthz"
+	ReadyProbePath string `json:"ready_probe_path"`
+
+	// ReconnectWindow - How long a dropped player may return before the room ends with client_disconnected
+	// Type: time.Duration, Format: "60s", "2m"
+	// Range: 0 - 10m (0 = no reconnection, recommended: 60s); overridden per queue by reconnect_window_seconds
+	ReconnectWindow time.Duration `json:"reconnect_window"`
+
+	// BackfillTTL - How long a backfill request from a running room stays open waiting for tickets
+	// Type: time.Duration, Format: "120s", "5m"
+	// Range: 10s - 30m (recommended: 120s); servers re-request to extend
+	BackfillTTL time.Duration `json:"backfill_ttl"`
+
+	// LobbyIdleTTL - How long a private room lobby waits without activity (create/join/leave) before it expires
+	// Type: time.Duration, Format: "600s", "10m"
+	// Range: 1m - 1h (recommended: 10m)
+	LobbyIdleTTL time.Duration `json:"lobby_idle_ttl"`
+
+	// Queues - Per-queue job template settings loaded from QUEUES_FILE
+	// Type: []QueueConfig, Format: JSON file {"queues": [{"name": "ranked", ...}]}
+	// Range: Empty means only the default queue is available
+	Queues []QueueConfig `json:"queues"`
+	// queuesErr lỗi đọc/parse QUEUES_FILE (CheckQueues)
+	queuesErr error
+}
+
+// Queue returns the queue config by name
+func (m MatchmakingConfig) Queue(name string) (QueueConfig, bool) {
+	for _, q := range m.Queues {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return QueueConfig{}, false
+}
+
+// QueueConfig holds job template settings for one matchmaking queue (or agent_v2 game_type)
+type QueueConfig struct {
+	// Name - Queue name submitted with tickets, or game_type for agent_v2
+	// Type: string, Format: "ranked", "testqueue"
+	Name string `json:"name"`
+
+	// CPU - CPU reserved per game server in MHz
+	// Type: int, Format: 400, 2048
+	// Range: > 0 (0 = cmd default)
+	CPU int `json:"cpu"`
+
+	// MemoryMB - Memory reserved per game server in MB
+	// Type: int, Format: 400, 2048
+	// Range: > 0 (0 = cmd default)
+	MemoryMB int `json:"memory_mb"`
+
+	// DiskMB - Ephemeral disk per allocation in MB (holds the unpacked artifact)
+	// Type: int, Format: 300, 1024
+	// Range: > 0 (0 = Nomad default)
+	DiskMB int `json:"disk_mb"`
+
+	// Command - Server executable; relative to the task dir when Artifact is set
+	// Type: string, Format: "/usr/local/bin/boardserver/server.x86_64", "local/server/server.x86_64"
+	// Range: empty = cmd default (EXECUTABLE_PATH)
+	Command string `json:"command"`
+
+	// Artifact - Server archive fetched by Nomad for every allocation
+	// Type: *ArtifactConfig, Format: {"source": "https://cdn/server-1.2.0.tar.gz", "checksum": "sha256:..."}
+	Artifact *ArtifactConfig `json:"artifact"`
+
+	// Teams - Team names players are split into, round-robin in match order
+	// Type: []string, Format: ["red", "blue"]
+	// Range: empty = one team per player (team_1, team_2, ...)
+	Teams []string `json:"teams"`
+
+	// Properties - Custom match properties delivered to the server in the room assignment
+	// Type: map[string]string, Format: {"map": "desert", "mode": "ranked"}
+	Properties map[string]string `json:"properties"`
+
+	// ReconnectWindowSeconds - Reconnection window for rooms of this queue
+	// Type: int, Format: 30, 120
+	// Range: > 0 (0 = RECONNECT_WINDOW_SECONDS)
+	ReconnectWindowSeconds int `json:"reconnect_window_seconds"`
+
+	// ReadyCheckSeconds - Accept/decline window after a match is found; only fully accepted matches allocate
+	// Type: int, Format: 10, 20
+	// Range: 0 - 120 (0 = no ready check, allocate immediately)
+	ReadyCheckSeconds int `json:"ready_check_seconds"`
+
+	// DeclinePenaltySeconds - How long a player who declined or missed the ready check cannot queue again
+	// Type: int, Format: 30, 120
+	// Range: >= 0 (0 = 30s when ready_check_seconds > 0)
+	DeclinePenaltySeconds int `json:"decline_penalty_seconds"`
+
+	// Placement - Nomad node pool, constraints, affinities and spreads
+	Placement PlacementConfig `json:"placement"`
+}
+
+// ArtifactConfig represents a Nomad artifact stanza (checksum is required)
+type ArtifactConfig struct {
+	Source      string `json:"source"`
+	Checksum    string `json:"checksum"`
+	Destination string `json:"destination"`
+	Mode        string `json:"mode"`
+}
+
+// PlacementConfig holds Nomad placement rules for a queue
+type PlacementConfig struct {
+	// NodePool - Nomad node pool name
+	// Type: string, Format: "highcpu", "staging"
+	// Range: Existing node pool names (empty = default pool)
+	NodePool string `json:"node_pool"`
+
+	// Constraints - Hard placement rules
+	// Type: []ConstraintConfig, Format: [{"attribute": "${node.class}", "operator": "=", "value": "highcpu"}]
+	Constraints []ConstraintConfig `json:"constraints"`
+
+	// Affinities - Soft placement preferences
+	// Type: []AffinityConfig, Format: [{"attribute": "${meta.zone}", "value": "a", "weight": 50}]
+	// Range: weight -100..100
+	Affinities []AffinityConfig `json:"affinities"`
+
+	// Spreads - Spread allocations across attribute values
+	// Type: []SpreadConfig, Format: [{"attribute": "${node.datacenter}", "weight": 100}]
+	Spreads []SpreadConfig `json:"spreads"`
+}
+
+// ConstraintConfig represents a Nomad constraint (operator defaults to "=")
+type ConstraintConfig struct {
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator"`
+	Value     string `json:"value"`
+}
+
+// AffinityConfig represents a Nomad affinity
+type AffinityConfig struct {
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator"`
+	Value     string `json:"value"`
+	Weight    int8   `json:"weight"`
+}
+
+// SpreadConfig represents a Nomad spread with optional percentage targets
+type SpreadConfig struct {
+	Attribute string               `json:"attribute"`
+	Weight    int8                 `json:"weight"`
+	Targets   []SpreadTargetConfig `json:"targets"`
+}
+
+// SpreadTargetConfig represents a target percentage for one attribute value
+type SpreadTargetConfig struct {
+	Value   string `json:"value"`
+	Percent uint8  `json:"percent"`
 }
 
 // CronConfig holds background task configuration
@@ -122,6 +387,33 @@ type CronConfig struct {
 	// Type: time.Duration, Format: "10s", "30s", "1m"
 	// Range: 5s - 5m (recommended: 10-30s)
 	Interval time.Duration `json:"interval"`
+
+	// HeartbeatTimeout - Seconds without server heartbeat before an ACTIVED room is marked DEAD(heartbeat_lost)
+	// Type: int64, Format: 30, 60
+	// Range: 0 = disabled; only applies to rooms that sent at least one heartbeat
+	HeartbeatTimeout int64 `json:"heartbeat_timeout"`
+
+	// DryRun - Log and report intended actions without deregistering jobs or writing rooms
+	// Type: bool, Format: true, false
+	DryRun bool `json:"dry_run"`
+
+	// ReportHistory - Number of reconcile reports kept for GET /admin/reconcile
+	// Type: int64, Format: 50, 200
+	// Range: 1 - 1000
+	ReportHistory int64 `json:"report_history"`
+}
+
+// LeaderConfig holds leader election settings for background loops (cron, matcher)
+type LeaderConfig struct {
+	// Enabled - Only the lease holder runs cron reconciliation and the matcher loop
+	// Type: bool, Format: true, false
+	// Range: false = every agent runs them (single agent deployments)
+	Enabled bool `json:"enabled"`
+
+	// LeaseTTL - Lease lifetime; the leader renews every TTL/3, failover happens within one TTL
+	// Type: time.Duration, Format: "15s", "30s"
+	// Range: 5s - 60s (recommended: 15s)
+	LeaseTTL time.Duration `json:"lease_ttl"`
 }
 
 // TimeoutConfig holds various timeout values
@@ -144,9 +436,38 @@ type TimeoutConfig struct {
 
 // AuthConfig holds secrets/tokens used by subsystems
 type AuthConfig struct {
-	// BearerToken - token để server gửi shutdown callback về agent
+	// BearerToken - token global cũ cho callback server → agent (chỉ chấp nhận khi AcceptGlobalToken)
 	// ENV: AGENT_BEARER_TOKEN; Default: 1234abcd
 	BearerToken string `json:"bearer_token"`
+
+	// RoomTokenSecret - Secret deriving the per-room callback token HMAC(secret, room_id); shared by all agents
+	// Type: string, Format: random string >= 32 bytes
+	// Range: required; must differ from AGENT_BEARER_TOKEN (agent refuses to start otherwise)
+	RoomTokenSecret string `json:"-"`
+
+	// AcceptGlobalToken - Also accept AGENT_BEARER_TOKEN on server callbacks (servers started before per-room tokens)
+	// Type: bool, Format: "true", "false"
+	AcceptGlobalToken bool `json:"accept_global_token"`
+
+	// JoinTokenKey - HMAC key signing per-player join tokens, shared with game servers (HIVE_JOIN_KEY)
+	// Type: string, Format: random string >= 32 bytes
+	// Range: empty = join tokens disabled
+	JoinTokenKey string `json:"-"`
+
+	// JoinTokenTTL - Lifetime of a join token returned by GET /tickets/:id
+	// Type: time.Duration, Format: "300s", "10m"
+	// Range: 30s - 1h (recommended: 5m)
+	JoinTokenTTL time.Duration `json:"join_token_ttl"`
+
+	// AdminToken - Bearer token required by the build/rollout admin API (POST/GET /admin/builds, POST /admin/rollouts)
+	// Type: string, Format: random string >= 32 bytes
+	// Range: empty = build/rollout admin API disabled (401)
+	AdminToken string `json:"-"`
+
+	// ArtifactSources - URL prefixes artifacts registered through POST /admin/builds may be downloaded from
+	// Type: []string, Format: "https://cdn.example.com/builds/,https://bucket.s3.amazonaws.com/hive/"
+	// Range: empty = builds with an artifact are rejected by the admin API (QUEUES_FILE is not affected)
+	ArtifactSources []string `json:"artifact_sources"`
 }
 
 // Default values for all configuration options
@@ -159,9 +480,14 @@ var defaults = map[string]string{
 	"REDIS_URL": "localhost:6379", // Default Redis connection string
 
 	// Nomad Configuration
-	"NOMAD_ADDRESS":     "http://localhost:4646",       // Default Nomad API endpoint
-	"NOMAD_DATACENTERS": "dc1",                         // Default datacenter
-	"NOMAD_IP_MAPPINGS": "172.26.15.163:52.221.213.97", // Default IP mapping (fallback)
+	"NOMAD_ADDRESS":      "http://localhost:4646", // Default Nomad API endpoint
+	"NOMAD_DATACENTERS":  "dc1",                   // Default datacenter
+	"NOMAD_IP_MAPPINGS":  "",                      // Optional static private:public overrides
+	"NOMAD_REGIONS_FILE": "",                      // Optional JSON file with named Nomad regions
+
+	"NOMAD_PUBLIC_ADDRESS_META":       "public_ip,public_hostname", // Node meta keys with public IP/hostname
+	"NOMAD_PUBLIC_ADDRESS_ATTRIBUTES": "",                          // Node attributes with public IP
+	"NOMAD_NODE_ADDRESS_FILE":         "",                          // Per-node override JSON file
 
 	// Matchmaking Configuration
 	"TICKET_TTL_SECONDS":            "120",                                      // 2 minutes - ticket validity period
@@ -169,11 +495,24 @@ var defaults = map[string]string{
 	"ALLOCATION_POLL_DELAY_SECONDS": "2",                                        // 2 seconds - delay between allocation checks
 	"TERMINAL_TTL_SECONDS":          "60",                                       // 60 seconds - keep DEAD/FULFILLED rooms
 	"EXECUTABLE_PATH":               "/usr/local/bin/boardserver/server.x86_64", // Default executable path
+	"QUEUES_FILE":                   "",                                         // Optional JSON file with per-queue settings
+	"MATCHER_INTERVAL_SECONDS":      "2",                                        // 2 seconds - background matcher interval
+	"ADMISSION_CONTROL":             "true",                                     // hold tickets when capacity is exhausted
+	"CAPACITY_CACHE_SECONDS":        "5",                                        // 5 seconds - capacity snapshot reuse
+	"ROOM_READY_MODE":               "callback",                                 // callback|tcp|http|none
+	"ROOM_READY_TIMEOUT_SECONDS":    "60",                                       // 60 seconds - wait for server ready
+	"ROOM_READY_PROBE_PATH":         "/",                                        // HTTP probe path (mode http)
+	"RECONNECT_WINDOW_SECONDS":      "60",                                       // 60 seconds - dropped player may return
+	"BACKFILL_TTL_SECONDS":          "120",                                      // 2 minutes - open backfill waits for tickets
+	"LOBBY_IDLE_TTL_SECONDS":        "600",                                      // 10 minutes - idle private lobby expires
 
 	// Cron Configuration
-	"CRON_GRACE_SECONDS":    "60",           // 1 minute - grace period before cleanup
-	"CRON_JOB_PREFIX":       "game-server-", // Prefix for Nomad job names
-	"CRON_INTERVAL_SECONDS": "10",           // 10 seconds - consistency check interval
+	"CRON_GRACE_SECONDS":             "60",           // 1 minute - grace period before cleanup
+	"CRON_JOB_PREFIX":                "game-server-", // Prefix for Nomad job names
+	"CRON_INTERVAL_SECONDS":          "10",           // 10 seconds - consistency check interval
+	"CRON_DRY_RUN":                   "false",        // Report only, no deregister/writes
+	"CRON_HEARTBEAT_TIMEOUT_SECONDS": "30",           // Server heartbeat timeout (0 = off)
+	"CRON_REPORT_HISTORY":            "50",           // Reconcile reports kept in memory
 
 	// Timeout Configuration
 	"HTTP_CLIENT_TIMEOUT_SECONDS":    "5", // 5 seconds - HTTP client timeout
@@ -181,14 +520,56 @@ var defaults = map[string]string{
 	"SERVER_CONTEXT_TIMEOUT_SECONDS": "5", // 5 seconds - server context timeout
 
 	// Auth
-	"AGENT_BEARER_TOKEN": "1234abcd",
+	"AGENT_BEARER_TOKEN":       "1234abcd",
+	"JOIN_TOKEN_KEY":           "",      // Empty = no join tokens
+	"ROOM_TOKEN_SECRET":        "",      // Required, no usable default
+	"AUTH_ACCEPT_GLOBAL_TOKEN": "false", // Accept the global bearer on callbacks
+	"JOIN_TOKEN_TTL_SECONDS":   "300",   // 5 minutes
+	"ADMIN_TOKEN":              "",      // Empty = build/rollout admin API disabled
+	"ARTIFACT_ALLOWED_SOURCES": "",      // Empty = no artifact builds via admin API
+
+	// Leader election
+	"AGENT_ID":             "",     // Empty = <hostname>-<pid>
+	"AGENT_OWNER":          "hive", // Job Meta owner shared by agents of one deployment
+	"LEADER_ELECTION":      "true", // Only one agent runs cron/matcher loops
+	"LEADER_LEASE_SECONDS": "15",   // Lease TTL
+}
+
+// minRoomTokenSecret độ dài tối thiểu của ROOM_TOKEN_SECRET
+const minRoomTokenSecret = 32
+
+// CheckRoomTokenSecret trả lỗi khi ROOM_TOKEN_SECRET rỗng, quá ngắn, là token mặc định hoặc trùng AGENT_BEARER_TOKEN
+func (a AuthConfig) CheckRoomTokenSecret() error {
+	switch {
+	case a.RoomTokenSecret == "":
+		return fmt.Errorf("ROOM_TOKEN_SECRET is required")
+	case a.RoomTokenSecret == defaults["AGENT_BEARER_TOKEN"], a.RoomTokenSecret == a.BearerToken:
+		return fmt.Errorf("ROOM_TOKEN_SECRET must not reuse AGENT_BEARER_TOKEN")
+	case len(a.RoomTokenSecret) < minRoomTokenSecret:
+		return fmt.Errorf("ROOM_TOKEN_SECRET must be at least %d bytes", minRoomTokenSecret)
+	}
+	return nil
+}
+
+// CheckRegions trả lỗi khi NOMAD_REGIONS_FILE được cấu hình nhưng không đọc/parse được
+func (n NomadConfig) CheckRegions() error {
+	return n.regionsErr
+}
+
+// CheckQueues trả lỗi khi QUEUES_FILE được cấu hình nhưng không đọc/parse được
+func (m MatchmakingConfig) CheckQueues() error {
+	return m.queuesErr
 }
 
 // Load creates a new Config with values from environment variables or defaults
 func Load() *Config {
+	regions, regionsErr := getRegionsFile("NOMAD_REGIONS_FILE", defaults["NOMAD_REGIONS_FILE"])
+	queues, queuesErr := getQueuesFile("QUEUES_FILE", defaults["QUEUES_FILE"])
 	cfg := &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", defaults["SERVER_PORT"]),
+			Port:    getEnv("SERVER_PORT", defaults["SERVER_PORT"]),
+			AgentID: getAgentID("AGENT_ID", defaults["AGENT_ID"]),
+			Owner:   getEnv("AGENT_OWNER", defaults["AGENT_OWNER"]),
 		},
 		Redis: RedisConfig{
 			URL: getEnv("REDIS_URL", defaults["REDIS_URL"]),
@@ -197,6 +578,12 @@ func Load() *Config {
 			Address:     getEnv("NOMAD_ADDRESS", defaults["NOMAD_ADDRESS"]),
 			Datacenters: getStringSliceEnv("NOMAD_DATACENTERS", defaults["NOMAD_DATACENTERS"]),
 			IPMappings:  getIPMappingsEnv("NOMAD_IP_MAPPINGS", defaults["NOMAD_IP_MAPPINGS"]),
+
+			PublicAddressMeta:       getListEnv("NOMAD_PUBLIC_ADDRESS_META", defaults["NOMAD_PUBLIC_ADDRESS_META"]),
+			PublicAddressAttributes: getListEnv("NOMAD_PUBLIC_ADDRESS_ATTRIBUTES", defaults["NOMAD_PUBLIC_ADDRESS_ATTRIBUTES"]),
+			NodeAddressFile:         getEnv("NOMAD_NODE_ADDRESS_FILE", defaults["NOMAD_NODE_ADDRESS_FILE"]),
+			Regions:                 regions,
+			regionsErr:              regionsErr,
 		},
 		Matchmaking: MatchmakingConfig{
 			TicketTTL:           getDurationEnv("TICKET_TTL_SECONDS", defaults["TICKET_TTL_SECONDS"]) * time.Second,
@@ -204,11 +591,25 @@ func Load() *Config {
 			AllocationPollDelay: getDurationEnv("ALLOCATION_POLL_DELAY_SECONDS", defaults["ALLOCATION_POLL_DELAY_SECONDS"]) * time.Second,
 			TerminalTTL:         getDurationEnv("TERMINAL_TTL_SECONDS", defaults["TERMINAL_TTL_SECONDS"]) * time.Second,
 			ExecutablePath:      getEnv("EXECUTABLE_PATH", defaults["EXECUTABLE_PATH"]),
+			MatcherInterval:     getDurationEnv("MATCHER_INTERVAL_SECONDS", defaults["MATCHER_INTERVAL_SECONDS"]) * time.Second,
+			AdmissionControl:    getBoolEnv("ADMISSION_CONTROL", defaults["ADMISSION_CONTROL"]),
+			CapacityCacheTTL:    getDurationEnv("CAPACITY_CACHE_SECONDS", defaults["CAPACITY_CACHE_SECONDS"]) * time.Second,
+			ReadyMode:           getEnv("ROOM_READY_MODE", defaults["ROOM_READY_MODE"]),
+			ReadyTimeout:        getDurationEnv("ROOM_READY_TIMEOUT_SECONDS", defaults["ROOM_READY_TIMEOUT_SECONDS"]) * time.Second,
+			ReadyProbePath:      getEnv("ROOM_READY_PROBE_PATH", defaults["ROOM_READY_PROBE_PATH"]),
+			ReconnectWindow:     getDurationEnv("RECONNECT_WINDOW_SECONDS", defaults["RECONNECT_WINDOW_SECONDS"]) * time.Second,
+			BackfillTTL:         getDurationEnv("BACKFILL_TTL_SECONDS", defaults["BACKFILL_TTL_SECONDS"]) * time.Second,
+			LobbyIdleTTL:        getDurationEnv("LOBBY_IDLE_TTL_SECONDS", defaults["LOBBY_IDLE_TTL_SECONDS"]) * time.Second,
+			Queues:              queues,
+			queuesErr:           queuesErr,
 		},
 		Cron: CronConfig{
-			GraceSeconds: getInt64Env("CRON_GRACE_SECONDS", defaults["CRON_GRACE_SECONDS"]),
-			JobPrefix:    getEnv("CRON_JOB_PREFIX", defaults["CRON_JOB_PREFIX"]),
-			Interval:     getDurationEnv("CRON_INTERVAL_SECONDS", defaults["CRON_INTERVAL_SECONDS"]) * time.Second,
+			GraceSeconds:     getInt64Env("CRON_GRACE_SECONDS", defaults["CRON_GRACE_SECONDS"]),
+			JobPrefix:        getEnv("CRON_JOB_PREFIX", defaults["CRON_JOB_PREFIX"]),
+			Interval:         getDurationEnv("CRON_INTERVAL_SECONDS", defaults["CRON_INTERVAL_SECONDS"]) * time.Second,
+			DryRun:           getBoolEnv("CRON_DRY_RUN", defaults["CRON_DRY_RUN"]),
+			HeartbeatTimeout: getInt64Env("CRON_HEARTBEAT_TIMEOUT_SECONDS", defaults["CRON_HEARTBEAT_TIMEOUT_SECONDS"]),
+			ReportHistory:    getInt64Env("CRON_REPORT_HISTORY", defaults["CRON_REPORT_HISTORY"]),
 		},
 		Timeout: TimeoutConfig{
 			HTTPClient:    getDurationEnv("HTTP_CLIENT_TIMEOUT_SECONDS", defaults["HTTP_CLIENT_TIMEOUT_SECONDS"]) * time.Second,
@@ -216,7 +617,17 @@ func Load() *Config {
 			ServerContext: getDurationEnv("SERVER_CONTEXT_TIMEOUT_SECONDS", defaults["SERVER_CONTEXT_TIMEOUT_SECONDS"]) * time.Second,
 		},
 		Auth: AuthConfig{
-			BearerToken: getEnv("AGENT_BEARER_TOKEN", defaults["AGENT_BEARER_TOKEN"]),
+			BearerToken:       getEnv("AGENT_BEARER_TOKEN", defaults["AGENT_BEARER_TOKEN"]),
+			JoinTokenKey:      getEnv("JOIN_TOKEN_KEY", defaults["JOIN_TOKEN_KEY"]),
+			RoomTokenSecret:   getEnv("ROOM_TOKEN_SECRET", defaults["ROOM_TOKEN_SECRET"]),
+			AcceptGlobalToken: getBoolEnv("AUTH_ACCEPT_GLOBAL_TOKEN", defaults["AUTH_ACCEPT_GLOBAL_TOKEN"]),
+			JoinTokenTTL:      getDurationEnv("JOIN_TOKEN_TTL_SECONDS", defaults["JOIN_TOKEN_TTL_SECONDS"]) * time.Second,
+			AdminToken:        getEnv("ADMIN_TOKEN", defaults["ADMIN_TOKEN"]),
+			ArtifactSources:   getListEnv("ARTIFACT_ALLOWED_SOURCES", defaults["ARTIFACT_ALLOWED_SOURCES"]),
+		},
+		Leader: LeaderConfig{
+			Enabled:  getBoolEnv("LEADER_ELECTION", defaults["LEADER_ELECTION"]),
+			LeaseTTL: getDurationEnv("LEADER_LEASE_SECONDS", defaults["LEADER_LEASE_SECONDS"]) * time.Second,
 		},
 	}
 
@@ -255,6 +666,16 @@ func getDurationEnv(key, defaultValue string) time.Duration {
 	return 0
 }
 
+func getBoolEnv(key, defaultValue string) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	parsed, _ := strconv.ParseBool(defaultValue)
+	return parsed
+}
+
 func getStringSliceEnv(key, defaultValue string) []string {
 	if value := os.Getenv(key); value != "" {
 		return []string{value}
@@ -262,6 +683,29 @@ func getStringSliceEnv(key, defaultValue string) []string {
 	return []string{defaultValue}
 }
 
+// getAgentID returns AGENT_ID or "<hostname>-<pid>"
+func getAgentID(key, defaultValue string) string {
+	if id := getEnv(key, defaultValue); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "agent"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// getListEnv parses a comma-separated list, dropping empty items
+func getListEnv(key, defaultValue string) []string {
+	out := []string{}
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func getIPMappingsEnv(key, defaultValue string) []IPMapping {
 	if value := os.Getenv(key); value != "" {
 		// Parse format: "ip1:pub1,ip2:pub2"
@@ -291,3 +735,49 @@ func getIPMappingsEnv(key, defaultValue string) []IPMapping {
 	}
 	return []IPMapping{}
 }
+
+// getQueuesFile loads queue configs from a JSON file: {"queues": [...]}.
+// File được cấu hình mà không đọc/parse được hoặc không có queue nào → lỗi (không âm thầm chỉ còn queue mặc định)
+func getQueuesFile(key, defaultValue string) ([]QueueConfig, error) {
+	path := getEnv(key, defaultValue)
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s=%s: %w", key, path, err)
+	}
+	var doc struct {
+		Queues []QueueConfig `json:"queues"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s=%s: %w", key, path, err)
+	}
+	if len(doc.Queues) == 0 {
+		return nil, fmt.Errorf("%s=%s has no queues", key, path)
+	}
+	return doc.Queues, nil
+}
+
+// getRegionsFile loads region configs from a JSON file: {"regions": [...]}.
+// File được cấu hình mà không đọc/parse được hoặc không có region nào → lỗi (không âm thầm dùng region mặc định)
+func getRegionsFile(key, defaultValue string) ([]RegionConfig, error) {
+	path := getEnv(key, defaultValue)
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s=%s: %w", key, path, err)
+	}
+	var doc struct {
+		Regions []RegionConfig `json:"regions"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s=%s: %w", key, path, err)
+	}
+	if len(doc.Regions) == 0 {
+		return nil, fmt.Errorf("%s=%s has no regions", key, path)
+	}
+	return doc.Regions, nil
+}
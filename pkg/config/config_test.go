@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile ghi nội dung vào file tạm, trả đường dẫn
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetRegionsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    func(t *testing.T) string
+		want    int
+		wantErr bool
+	}{
+		{name: "not configured", path: func(*testing.T) string { return "" }},
+		{name: "valid file", path: func(t *testing.T) string {
+			return writeFile(t, `{"regions": [{"name": "sg", "address": "http://10.0.0.1:4646"}, {"name": "eu"}]}`)
+		}, want: 2},
+		{name: "missing file", path: func(t *testing.T) string { return filepath.Join(t.TempDir(), "nope.json") }, wantErr: true},
+		{name: "invalid json", path: func(t *testing.T) string { return writeFile(t, `{"regions": [`) }, wantErr: true},
+		{name: "no regions", path: func(t *testing.T) string { return writeFile(t, `{"regions": []}`) }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_REGIONS_FILE", tt.path(t))
+			got, err := getRegionsFile("TEST_REGIONS_FILE", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("regions = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestGetQueuesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    func(t *testing.T) string
+		want    int
+		wantErr bool
+	}{
+		{name: "not configured", path: func(*testing.T) string { return "" }},
+		{name: "valid file", path: func(t *testing.T) string {
+			return writeFile(t, `{"queues": [{"name": "ranked", "cpu": 500}]}`)
+		}, want: 1},
+		{name: "missing file", path: func(t *testing.T) string { return filepath.Join(t.TempDir(), "nope.json") }, wantErr: true},
+		{name: "invalid json", path: func(t *testing.T) string { return writeFile(t, `queues`) }, wantErr: true},
+		{name: "no queues", path: func(t *testing.T) string { return writeFile(t, `{}`) }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_QUEUES_FILE", tt.path(t))
+			got, err := getQueuesFile("TEST_QUEUES_FILE", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("queues = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
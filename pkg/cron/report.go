@@ -0,0 +1,100 @@
+package cron
+
+import (
+	"sync"
+)
+
+// Loại hành động của một lượt đồng bộ
+const (
+	ActionStopTerminalJob = "stop_terminal_job" // room DEAD/FULFILLED nhưng job vẫn chạy
+	ActionMarkDead        = "mark_dead"         // room ACTIVED/OPENED không còn job → DEAD
+	ActionDeleteRoom      = "delete_room"       // key room mồ côi (không job, quá grace) bị xoá
+	ActionStopStrayJob    = "stop_stray_job"    // job game server không có room ACTIVED
+)
+
+// fail_reason khi runner đánh room DEAD
+const (
+	ReasonServerCrash   = "server_crash"   // room ACTIVED không còn job chạy
+	ReasonHeartbeatLost = "heartbeat_lost" // room ACTIVED im lặng quá HeartbeatTimeout
+	ReasonAllocTimeout  = "alloc_timeout"  // room OPENED quá grace mà không có job
+	ReasonReadyTimeout  = "ready_timeout"  // job chạy nhưng server không ready kịp
+)
+
+// Action một thay đổi mà lượt đồng bộ đã làm (hoặc sẽ làm khi dry-run)
+type Action struct {
+	Kind    string `json:"kind"`
+	RoomID  string `json:"room_id,omitempty"`
+	JobID   string `json:"job_id,omitempty"`
+	Status  string `json:"status,omitempty"` // status room trước khi xử lý
+	Reason  string `json:"reason,omitempty"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"` // room đã đổi status trước khi ghi (CAS), không làm gì
+	Error   string `json:"error,omitempty"`
+}
+
+// Report kết quả một lượt syncRooms
+type Report struct {
+	Region       string   `json:"region,omitempty"`
+	DryRun       bool     `json:"dry_run"`
+	StartedAt    int64    `json:"started_at_unix"`
+	DurationMs   int64    `json:"duration_ms"`
+	RoomsScanned int      `json:"rooms_scanned"`
+	RunningJobs  int      `json:"running_jobs"`
+	Actions      []Action `json:"actions"`
+	Errors       []string `json:"errors"`
+}
+
+func (rep *Report) addError(err error) {
+	if err != nil {
+		rep.Errors = append(rep.Errors, err.Error())
+	}
+}
+
+// History ring buffer giữ N report gần nhất (dùng chung giữa các runner của nhiều region)
+type History struct {
+	mu      sync.Mutex
+	reports []Report
+	next    int
+	full    bool
+}
+
+// NewHistory tạo ring buffer dung lượng size (mặc định 50)
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = 50
+	}
+	return &History{reports: make([]Report, size)}
+}
+
+// Add ghi report, ghi đè report cũ nhất khi đầy
+func (h *History) Add(rep Report) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reports[h.next] = rep
+	h.next = (h.next + 1) % len(h.reports)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// List trả report mới nhất trước; region rỗng = mọi region, limit <= 0 = tất cả
+func (h *History) List(region string, limit int) []Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := h.next
+	if h.full {
+		n = len(h.reports)
+	}
+	out := []Report{}
+	for i := 0; i < n; i++ {
+		rep := h.reports[(h.next-1-i+len(h.reports))%len(h.reports)]
+		if region != "" && rep.Region != region {
+			continue
+		}
+		out = append(out, rep)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
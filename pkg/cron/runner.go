@@ -2,7 +2,9 @@ package cron
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"hive/pkg/store"
@@ -12,18 +14,58 @@ import (
 
 type Options struct {
 	GraceSeconds int64
-	JobPrefix    string
-	Interval     time.Duration
+	// HeartbeatTimeout: room ACTIVED đã từng heartbeat mà im lặng quá số giây này → DEAD(heartbeat_lost) dù job còn chạy (0 = tắt)
+	HeartbeatTimeout int64
+	// ReadyTimeout: room OPENED đã có allocation mà chưa ready quá ReadyTimeout + GraceSeconds → DEAD(ready_timeout) (0 = tắt)
+	ReadyTimeout int64
+	// JobPrefix: nhận diện job cũ chưa có Meta room_id (Name = JobPrefix + ID)
+	JobPrefix string
+	Interval  time.Duration
+	// Owner: chỉ dừng job stray có Meta owner trùng (rỗng = mọi job game server).
+	// Job cũ không có owner chỉ được xử lý qua room tương ứng, không bao giờ bị coi là stray.
+	Owner string
+	// Region: chỉ đồng bộ room thuộc region này với cụm Nomad của runner (rỗng = mọi room)
+	Region string
+	// OwnsUnlabeled: runner cũng xử lý room không có region (room tạo trước khi bật multi-region)
+	OwnsUnlabeled bool
+	// Guard: chỉ chạy/ghi khi trả true (leader election); ctx trả về mang fencing token cho các ghi Redis.
+	// nil = luôn chạy
+	Guard func(ctx context.Context) (context.Context, bool)
+	// DryRun: chỉ log + ghi report các hành động dự kiến, không deregister/ghi Redis
+	DryRun bool
+	// History: ring buffer nhận report mỗi lượt (nil = runner tự tạo, 50 report)
+	History *History
+}
+
+// Jobs phần Nomad Jobs API mà runner dùng (*api.Jobs thoả mãn; thay bằng fake khi test)
+type Jobs interface {
+	ListOptions(opts *api.JobListOptions, q *api.QueryOptions) ([]*api.JobListStub, *api.QueryMeta, error)
+	Allocations(jobID string, allAllocs bool, q *api.QueryOptions) ([]*api.AllocationListStub, *api.QueryMeta, error)
+	Deregister(jobID string, purge bool, q *api.WriteOptions) (string, *api.WriteMeta, error)
+}
+
+// RoomStore phần store mà runner dùng (*store.Manager thoả mãn)
+type RoomStore interface {
+	ListRooms(ctx context.Context) ([]string, error)
+	GetRoomState(ctx context.Context, roomID string) (*store.RoomState, error)
+	TransitionRoom(ctx context.Context, roomID, from string, mutate func(*store.RoomState)) (*store.RoomState, error)
+	DeleteRoomState(ctx context.Context, roomID string) error
 }
 
 type Runner struct {
-	store   *store.Manager
-	nomad   *api.Client
+	store   RoomStore
+	jobs    Jobs
 	opts    Options
+	history *History
 	stopped chan struct{}
 }
 
 func New(storeMgr *store.Manager, nomadClient *api.Client, opts Options) *Runner {
+	return NewWithJobs(storeMgr, nomadClient.Jobs(), opts)
+}
+
+// NewWithJobs tạo runner với store/Jobs tuỳ ý (fake Nomad trong test)
+func NewWithJobs(st RoomStore, jobs Jobs, opts Options) *Runner {
 	if opts.GraceSeconds <= 0 {
 		opts.GraceSeconds = 60
 	}
@@ -33,121 +75,272 @@ func New(storeMgr *store.Manager, nomadClient *api.Client, opts Options) *Runner
 	if opts.Interval <= 0 {
 		opts.Interval = 10 * time.Second
 	}
-	return &Runner{store: storeMgr, nomad: nomadClient, opts: opts, stopped: make(chan struct{})}
+	history := opts.History
+	if history == nil {
+		history = NewHistory(0)
+	}
+	return &Runner{store: st, jobs: jobs, opts: opts, history: history, stopped: make(chan struct{})}
 }
 
+// History trả ring buffer report của runner
+func (r *Runner) History() *History { return r.history }
+
 // Start chạy vòng đồng bộ nền; dừng khi ctx.Done()
 func (r *Runner) Start(ctx context.Context) {
-	jobs := r.nomad.Jobs()
 TickerLoop:
 	for {
 		select {
 		case <-ctx.Done():
 			break TickerLoop
 		case <-time.After(r.opts.Interval):
+			if _, ok := r.guarded(ctx); !ok {
+				continue
+			}
 			// Only sync Redis state to match Nomad running jobs (one-way consistency)
 			// Keep stopped jobs for log inspection
-			r.syncRooms(ctx, jobs)
+			if rep := r.SyncOnce(ctx); rep != nil {
+				r.history.Add(*rep)
+			}
 		}
 	}
 	close(r.stopped)
 }
 
-func (r *Runner) syncRooms(ctx context.Context, jobs *api.Jobs) {
+// gameJob một job game server đã ánh xạ về room
+type gameJob struct {
+	JobID   string
+	RoomID  string
+	Running bool // có allocation đang chạy và job chưa bị stop
+	Owned   bool // job do nhóm agent này tạo (Meta owner), được phép dừng khi stray
+}
+
+// SyncOnce chạy một lượt đồng bộ Redis ↔ Nomad và trả report (nil khi mất leader giữa lượt)
+func (r *Runner) SyncOnce(ctx context.Context) *Report {
+	started := time.Now()
+	rep := &Report{Region: r.opts.Region, DryRun: r.opts.DryRun, StartedAt: started.Unix(), Actions: []Action{}, Errors: []string{}}
+	defer func() { rep.DurationMs = time.Since(started).Milliseconds() }()
+
 	roomIDs, err := r.store.ListRooms(ctx)
 	if err != nil {
-		return
+		rep.addError(fmt.Errorf("list rooms: %w", err))
+		return rep
 	}
-	now := time.Now().Unix()
+	rep.RoomsScanned = len(roomIDs)
 
-	// Map để track running jobs
-	runningJobs := make(map[string]bool)
-
-	// 1. Lấy danh sách tất cả running jobs
-	list, _, err := jobs.List(nil)
-	if err == nil {
-		for _, j := range list {
-			if j == nil || j.ID == "" {
-				continue
-			}
-			allocs, _, aerr := jobs.Allocations(j.ID, false, nil)
-			if aerr != nil {
-				continue
-			}
-			for _, s := range allocs {
-				if s != nil && s.ClientStatus == "running" {
-					runningJobs[j.ID] = true
-					break
-				}
-			}
+	// 1. Ánh xạ job ↔ room từ Nomad
+	byRoom, err := r.gameJobs(rep)
+	if err != nil {
+		// Không biết job nào đang chạy → không được kết luận crash/stray trong lượt này
+		rep.addError(fmt.Errorf("list jobs: %w", err))
+		return rep
+	}
+	for _, j := range byRoom {
+		if j.Running {
+			rep.RunningJobs++
 		}
 	}
 
-	// 2. Xử lý từng room
-	for _, rid := range roomIDs {
-		st, _ := r.store.GetRoomState(ctx, rid)
+	// Danh sách Nomad có thể lấy lâu: kiểm tra lại lease trước khi ghi; ghi Redis sau đó dùng ctx mang fencing token
+	ctx, ok := r.guarded(ctx)
+	if !ok {
+		return nil
+	}
+	now := time.Now().Unix()
 
-		// Nếu room đã terminal: đảm bảo job đã dừng
-		if st != nil && (st.Status == "DEAD" || st.Status == "FULFILLED") {
-			if runningJobs[rid] {
-				// Job vẫn chạy → dừng ngay
-				_, _, _ = jobs.Deregister(rid, false, nil)
-			}
+	// 2. Room → job: terminal cleanup, crash, alloc timeout, key mồ côi
+	known := make(map[string]bool, len(roomIDs))
+	for _, rid := range roomIDs {
+		st, gerr := r.store.GetRoomState(ctx, rid)
+		if gerr != nil && !store.IsNotFound(gerr) {
+			rep.addError(fmt.Errorf("get room %s: %w", rid, gerr))
+			known[rid] = true // không chắc room còn hay không → không coi job là stray
 			continue
 		}
+		if st == nil {
+			// Index còn room nhưng key đã hết hạn
+			r.act(rep, Action{Kind: ActionDeleteRoom, RoomID: rid, Reason: "room key expired"}, func() error {
+				return r.store.DeleteRoomState(ctx, rid)
+			})
+			continue
+		}
+		known[rid] = true
+		if !r.ownsRoom(st) {
+			continue
+		}
+		job, hasJob := byRoom[rid]
+		running := hasJob && job.Running
 
-		// Kiểm tra job có tồn tại và running không
-		isRunning := runningJobs[rid]
-
-		if !isRunning {
-			// Job không chạy
-			if st == nil || now-st.CreatedAt > r.opts.GraceSeconds {
-				_ = r.store.DeleteRoomState(ctx, rid)
-				continue
+		switch st.Status {
+		case "DEAD", "FULFILLED":
+			// Room terminal mà job vẫn chạy → dừng (không purge để inspect)
+			if running {
+				r.act(rep, Action{Kind: ActionStopTerminalJob, RoomID: rid, JobID: job.JobID, Status: st.Status, Reason: "room terminal"}, func() error {
+					_, _, derr := r.jobs.Deregister(job.JobID, false, nil)
+					return derr
+				})
 			}
-
-			// ACTIVED không còn chạy: server crash -> DEAD
-			if st != nil && st.Status == "ACTIVED" {
-				_ = r.store.SaveRoomState(ctx, store.RoomState{
-					RoomID: rid, Players: st.Players, CreatedAt: st.CreatedAt,
-					Status: "DEAD", FailReason: "server_crash", DeadAt: now,
+		case "ACTIVED":
+			// Job còn chạy nhưng server ngừng heartbeat (process treo) → DEAD + dừng job
+			if running && r.heartbeatLost(st, now) {
+				r.act(rep, Action{Kind: ActionMarkDead, RoomID: rid, JobID: job.JobID, Status: st.Status, Reason: ReasonHeartbeatLost}, func() error {
+					if err := r.markDead(ctx, st, ReasonHeartbeatLost, now); err != nil {
+						return err
+					}
+					_, _, derr := r.jobs.Deregister(job.JobID, false, nil)
+					return derr
 				})
 				continue
 			}
-
-			// OPENED quá lâu: đánh dấu DEAD (alloc_timeout)
-			if st != nil && st.Status == "OPENED" && now-st.CreatedAt > r.opts.GraceSeconds {
-				_ = r.store.SaveRoomState(ctx, store.RoomState{
-					RoomID: rid, Players: st.Players, CreatedAt: st.CreatedAt,
-					Status: "DEAD", FailReason: "alloc_timeout", DeadAt: now,
+			// ACTIVED không còn job chạy: server crash → DEAD (store tính vào failure rate của build)
+			if !running {
+				r.act(rep, Action{Kind: ActionMarkDead, RoomID: rid, JobID: job.JobID, Status: st.Status, Reason: ReasonServerCrash}, func() error {
+					return r.markDead(ctx, st, ReasonServerCrash, now)
+				})
+			}
+		case "OPENED":
+			// Đang allocate: chỉ DEAD khi quá grace mà job chưa chạy
+			if !running && now-st.CreatedAt > r.opts.GraceSeconds {
+				r.act(rep, Action{Kind: ActionMarkDead, RoomID: rid, JobID: job.JobID, Status: st.Status, Reason: ReasonAllocTimeout}, func() error {
+					return r.markDead(ctx, st, ReasonAllocTimeout, now)
 				})
 				continue
 			}
+			// Job chạy nhưng server không bao giờ ready (vòng chờ của matcher mất do agent restart) → DEAD + dừng job
+			if running && r.opts.ReadyTimeout > 0 && st.AllocatedAt > 0 && now-st.AllocatedAt > r.opts.ReadyTimeout+r.opts.GraceSeconds {
+				r.act(rep, Action{Kind: ActionMarkDead, RoomID: rid, JobID: job.JobID, Status: st.Status, Reason: ReasonReadyTimeout}, func() error {
+					if err := r.markDead(ctx, st, ReasonReadyTimeout, now); err != nil {
+						return err
+					}
+					_, _, derr := r.jobs.Deregister(job.JobID, false, nil)
+					return derr
+				})
+			}
+		}
+	}
+
+	// 3. Job → room: job của mình đang chạy mà room không còn trong Redis là stray
+	for rid, job := range byRoom {
+		if !job.Running || !job.Owned || known[rid] {
+			continue
 		}
+		r.act(rep, Action{Kind: ActionStopStrayJob, RoomID: rid, JobID: job.JobID, Reason: "no room state"}, func() error {
+			_, _, derr := r.jobs.Deregister(job.JobID, false, nil)
+			return derr
+		})
 	}
+	return rep
+}
 
-	// 3. Dừng các game server job không có room tương ứng (stray jobs)
-	for jobID := range runningJobs {
-		// Chỉ xử lý game server jobs (có prefix)
-		if !strings.HasPrefix(jobID, r.opts.JobPrefix) {
+// gameJobs liệt kê job game server, ánh xạ theo Meta room_id (job cũ: Name = JobPrefix + ID)
+func (r *Runner) gameJobs(rep *Report) (map[string]gameJob, error) {
+	list, _, err := r.jobs.ListOptions(&api.JobListOptions{Fields: &api.JobListFields{Meta: true}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]gameJob{}
+	for _, j := range list {
+		if j == nil || j.ID == "" {
 			continue
 		}
-		found := false
-		for _, rid := range roomIDs {
-			if rid == jobID {
-				st, _ := r.store.GetRoomState(ctx, rid)
-				if st != nil && st.Status == "ACTIVED" {
-					found = true
-					break
-				}
+		roomID := j.Meta["room_id"]
+		if roomID == "" && j.Name == r.opts.JobPrefix+j.ID {
+			roomID = j.ID
+		}
+		if roomID == "" {
+			continue // không phải game server
+		}
+		owner := j.Meta["owner"]
+		// Job của nhóm agent khác dùng chung Nomad (hoặc job cũ không có owner) không bao giờ bị coi là stray
+		owned := r.opts.Owner == "" || owner == r.opts.Owner
+		running, rerr := r.jobRunning(j)
+		if rerr != nil {
+			rep.addError(fmt.Errorf("allocations %s: %w", j.ID, rerr))
+			running = true // không rõ → coi như đang chạy để không đánh dấu crash nhầm
+		}
+		// Trùng room_id: ưu tiên job đang chạy
+		if prev, ok := out[roomID]; ok && prev.Running && !running {
+			continue
+		}
+		out[roomID] = gameJob{JobID: j.ID, RoomID: roomID, Running: running, Owned: owned}
+	}
+	return out, nil
+}
+
+// jobRunning: job chưa stop và có allocation running (đọc JobSummary, thiếu thì hỏi allocations)
+func (r *Runner) jobRunning(j *api.JobListStub) (bool, error) {
+	if j.Stop {
+		return false, nil
+	}
+	if j.JobSummary != nil {
+		for _, tg := range j.JobSummary.Summary {
+			if tg.Running > 0 {
+				return true, nil
 			}
 		}
-		if !found {
-			// Game server job không có room ACTIVED tương ứng → dừng
-			_, _, _ = jobs.Deregister(jobID, false, nil)
+		return false, nil
+	}
+	allocs, _, err := r.jobs.Allocations(j.ID, false, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range allocs {
+		if a != nil && a.ClientStatus == "running" {
+			return true, nil
 		}
 	}
+	return false, nil
+}
+
+// act thực hiện (hoặc chỉ log khi dry-run) một hành động và ghi vào report
+func (r *Runner) act(rep *Report, a Action, fn func() error) {
+	if r.opts.DryRun {
+		a.DryRun = true
+		log.Printf("cron[%s] dry-run: %s room=%s job=%s reason=%s", r.opts.Region, a.Kind, a.RoomID, a.JobID, a.Reason)
+	} else if err := fn(); errors.Is(err, store.ErrRoomStatusChanged) {
+		a.Skipped = true // room đổi status giữa lượt: để lượt sau xử lý theo status mới
+	} else if err != nil {
+		a.Error = err.Error()
+		rep.addError(fmt.Errorf("%s room=%s job=%s: %w", a.Kind, a.RoomID, a.JobID, err))
+	}
+	rep.Actions = append(rep.Actions, a)
+}
+
+// heartbeatLost: room đã từng gửi heartbeat và im lặng quá HeartbeatTimeout
+func (r *Runner) heartbeatLost(st *store.RoomState, now int64) bool {
+	return r.opts.HeartbeatTimeout > 0 && st.LastHeartbeatAt > 0 && now-st.LastHeartbeatAt > r.opts.HeartbeatTimeout
+}
+
+// markDead chuyển room DEAD bằng CAS từ status đã đọc (giữ nguyên các field khác của room);
+// room vừa đổi status (callback ready/shutdown chen vào) → ErrRoomStatusChanged, không ghi đè
+func (r *Runner) markDead(ctx context.Context, st *store.RoomState, reason string, now int64) error {
+	_, err := r.store.TransitionRoom(ctx, st.RoomID, st.Status, func(s *store.RoomState) {
+		s.Status, s.FailReason, s.DeadAt = "DEAD", reason, now
+	})
+	return err
+}
+
+// AcceptsLateShutdown cho biết callback shutdown (kết thúc lúc at) vẫn được nhận cho room đã DEAD:
+// chỉ khi runner suy ra DEAD vì không thấy server (crash, mất heartbeat) và server thật ra đã kết thúc
+// trước dead_at — callback tới muộn, room chuyển DEAD → FULFILLED. DEAD do allocate/ready thì không.
+func AcceptsLateShutdown(st *store.RoomState, at int64) bool {
+	if st.Status != "DEAD" || at > st.DeadAt {
+		return false
+	}
+	return st.FailReason == ReasonServerCrash || st.FailReason == ReasonHeartbeatLost
 }
 
-// stopStrayJobs removed - keep stopped jobs for log inspection
-// Only sync Redis state to match Nomad running jobs (one-way consistency)
+// guarded kiểm tra guard (leader + fencing token) trước khi đồng bộ; trả ctx mang fence để ghi
+func (r *Runner) guarded(ctx context.Context) (context.Context, bool) {
+	if r.opts.Guard == nil {
+		return ctx, true
+	}
+	return r.opts.Guard(ctx)
+}
+
+// ownsRoom cho biết room thuộc cụm Nomad mà runner này đồng bộ
+func (r *Runner) ownsRoom(st *store.RoomState) bool {
+	if r.opts.Region == "" || st.Region == r.opts.Region {
+		return true
+	}
+	return st.Region == "" && r.opts.OwnsUnlabeled
+}
@@ -0,0 +1,324 @@
+package cron
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"hive/pkg/store"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeJobs Nomad Jobs API giả: job list cố định, ghi lại các lần Deregister
+type fakeJobs struct {
+	mu           sync.Mutex
+	jobs         []*api.JobListStub
+	deregistered []string
+}
+
+func (f *fakeJobs) ListOptions(*api.JobListOptions, *api.QueryOptions) ([]*api.JobListStub, *api.QueryMeta, error) {
+	return f.jobs, nil, nil
+}
+
+func (f *fakeJobs) Allocations(string, bool, *api.QueryOptions) ([]*api.AllocationListStub, *api.QueryMeta, error) {
+	return nil, nil, nil
+}
+
+func (f *fakeJobs) Deregister(jobID string, _ bool, _ *api.WriteOptions) (string, *api.WriteMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deregistered = append(f.deregistered, jobID)
+	return "", nil, nil
+}
+
+// fakeStore RoomStore giả trong bộ nhớ; index có thể chứa room đã hết hạn (không có trong rooms).
+// beforeTransition chạy trước CAS để giả lập callback đổi status giữa lượt.
+type fakeStore struct {
+	index            []string
+	rooms            map[string]*store.RoomState
+	deleted          []string
+	beforeTransition func(s *fakeStore, roomID string)
+}
+
+func (f *fakeStore) ListRooms(context.Context) ([]string, error) { return f.index, nil }
+
+func (f *fakeStore) GetRoomState(_ context.Context, roomID string) (*store.RoomState, error) {
+	st, ok := f.rooms[roomID]
+	if !ok {
+		return nil, redis.Nil
+	}
+	cp := *st
+	return &cp, nil
+}
+
+func (f *fakeStore) TransitionRoom(_ context.Context, roomID, from string, mutate func(*store.RoomState)) (*store.RoomState, error) {
+	if f.beforeTransition != nil {
+		f.beforeTransition(f, roomID)
+	}
+	st, ok := f.rooms[roomID]
+	if !ok {
+		return nil, redis.Nil
+	}
+	if st.Status != from {
+		cp := *st
+		return &cp, store.ErrRoomStatusChanged
+	}
+	mutate(st)
+	cp := *st
+	return &cp, nil
+}
+
+func (f *fakeStore) DeleteRoomState(_ context.Context, roomID string) error {
+	f.deleted = append(f.deleted, roomID)
+	return nil
+}
+
+// job tạo job game server của room; running=true → JobSummary có allocation running
+func job(roomID, owner string, running bool) *api.JobListStub {
+	tg := api.TaskGroupSummary{}
+	if running {
+		tg.Running = 1
+	} else {
+		tg.Complete = 1
+	}
+	meta := map[string]string{"room_id": roomID}
+	if owner != "" {
+		meta["owner"] = owner
+	}
+	return &api.JobListStub{
+		ID:         "game-server-" + roomID,
+		Name:       "game-server-" + roomID,
+		Meta:       meta,
+		JobSummary: &api.JobSummary{Summary: map[string]api.TaskGroupSummary{"game-server": tg}},
+	}
+}
+
+func TestSyncOnce(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name       string
+		opts       Options
+		rooms      []store.RoomState
+		expired    []string // room còn trong index nhưng key đã hết hạn
+		jobs       []*api.JobListStub
+		before     func(s *fakeStore, roomID string)
+		wantKinds  []string          // kind của các action, sắp xếp
+		wantDereg  []string          // job bị deregister, sắp xếp
+		wantStatus map[string]string // status room sau lượt
+		wantReason map[string]string // fail_reason sau lượt
+		wantSkip   bool
+	}{
+		{
+			name:      "stray job of own owner is stopped",
+			opts:      Options{Owner: "hive"},
+			jobs:      []*api.JobListStub{job("r1", "hive", true)},
+			wantKinds: []string{ActionStopStrayJob},
+			wantDereg: []string{"game-server-r1"},
+		},
+		{
+			name: "stray job of other owner or without owner is kept",
+			opts: Options{Owner: "hive"},
+			jobs: []*api.JobListStub{job("r1", "agent_v2", true), job("r2", "", true)},
+		},
+		{
+			name:       "actived room without running job is a crash",
+			rooms:      []store.RoomState{{RoomID: "r1", Status: "ACTIVED", CreatedAt: now - 600}},
+			jobs:       []*api.JobListStub{job("r1", "hive", false)},
+			wantKinds:  []string{ActionMarkDead},
+			wantStatus: map[string]string{"r1": "DEAD"},
+			wantReason: map[string]string{"r1": "server_crash"},
+		},
+		{
+			name:       "actived room with silent heartbeat is dead and its job stopped",
+			opts:       Options{HeartbeatTimeout: 30},
+			rooms:      []store.RoomState{{RoomID: "r1", Status: "ACTIVED", CreatedAt: now - 600, LastHeartbeatAt: now - 120}},
+			jobs:       []*api.JobListStub{job("r1", "hive", true)},
+			wantKinds:  []string{ActionMarkDead},
+			wantDereg:  []string{"game-server-r1"},
+			wantStatus: map[string]string{"r1": "DEAD"},
+			wantReason: map[string]string{"r1": "heartbeat_lost"},
+		},
+		{
+			name:       "healthy actived room is untouched",
+			opts:       Options{HeartbeatTimeout: 30},
+			rooms:      []store.RoomState{{RoomID: "r1", Status: "ACTIVED", CreatedAt: now - 600, LastHeartbeatAt: now}},
+			jobs:       []*api.JobListStub{job("r1", "hive", true)},
+			wantStatus: map[string]string{"r1": "ACTIVED"},
+		},
+		{
+			name: "terminal rooms with running jobs are stopped",
+			rooms: []store.RoomState{
+				{RoomID: "r1", Status: "DEAD", CreatedAt: now - 600},
+				{RoomID: "r2", Status: "FULFILLED", CreatedAt: now - 600},
+				{RoomID: "r3", Status: "FULFILLED", CreatedAt: now - 600},
+			},
+			jobs:       []*api.JobListStub{job("r1", "hive", true), job("r2", "hive", true), job("r3", "hive", false)},
+			wantKinds:  []string{ActionStopTerminalJob, ActionStopTerminalJob},
+			wantDereg:  []string{"game-server-r1", "game-server-r2"},
+			wantStatus: map[string]string{"r1": "DEAD", "r2": "FULFILLED", "r3": "FULFILLED"},
+		},
+		{
+			name:       "opened room past grace without job is alloc_timeout",
+			opts:       Options{GraceSeconds: 60},
+			rooms:      []store.RoomState{{RoomID: "r1", Status: "OPENED", CreatedAt: now - 120}, {RoomID: "r2", Status: "OPENED", CreatedAt: now - 10}},
+			wantKinds:  []string{ActionMarkDead},
+			wantStatus: map[string]string{"r1": "DEAD", "r2": "OPENED"},
+			wantReason: map[string]string{"r1": "alloc_timeout"},
+		},
+		{
+			name:       "opened room running but never ready is ready_timeout",
+			opts:       Options{GraceSeconds: 60, ReadyTimeout: 60},
+			rooms:      []store.RoomState{{RoomID: "r1", Status: "OPENED", CreatedAt: now - 300, AllocatedAt: now - 200}},
+			jobs:       []*api.JobListStub{job("r1", "hive", true)},
+			wantKinds:  []string{ActionMarkDead},
+			wantDereg:  []string{"game-server-r1"},
+			wantStatus: map[string]string{"r1": "DEAD"},
+			wantReason: map[string]string{"r1": "ready_timeout"},
+		},
+		{
+			name:      "expired room key is removed from index",
+			expired:   []string{"r1"},
+			wantKinds: []string{ActionDeleteRoom},
+		},
+		{
+			name:  "room changed status before mark dead is skipped",
+			rooms: []store.RoomState{{RoomID: "r1", Status: "ACTIVED", CreatedAt: now - 600}},
+			before: func(s *fakeStore, roomID string) {
+				s.rooms[roomID].Status = "FULFILLED" // shutdown callback chen vào giữa lượt
+			},
+			wantKinds:  []string{ActionMarkDead},
+			wantStatus: map[string]string{"r1": "FULFILLED"},
+			wantSkip:   true,
+		},
+		{
+			name: "dry run reports without writing",
+			opts: Options{Owner: "hive", DryRun: true},
+			rooms: []store.RoomState{
+				{RoomID: "r1", Status: "ACTIVED", CreatedAt: now - 600},
+				{RoomID: "r2", Status: "DEAD", CreatedAt: now - 600},
+			},
+			expired:    []string{"r4"},
+			jobs:       []*api.JobListStub{job("r2", "hive", true), job("r3", "hive", true)},
+			wantKinds:  []string{ActionDeleteRoom, ActionMarkDead, ActionStopStrayJob, ActionStopTerminalJob},
+			wantStatus: map[string]string{"r1": "ACTIVED", "r2": "DEAD"},
+		},
+		{
+			name:       "rooms of another region are ignored",
+			opts:       Options{Region: "eu"},
+			rooms:      []store.RoomState{{RoomID: "r1", Status: "ACTIVED", Region: "sg", CreatedAt: now - 600}},
+			wantStatus: map[string]string{"r1": "ACTIVED"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &fakeStore{rooms: map[string]*store.RoomState{}, beforeTransition: tt.before}
+			for i := range tt.rooms {
+				room := tt.rooms[i]
+				st.rooms[room.RoomID] = &room
+				st.index = append(st.index, room.RoomID)
+			}
+			st.index = append(st.index, tt.expired...)
+			jobs := &fakeJobs{jobs: tt.jobs}
+
+			rep := NewWithJobs(st, jobs, tt.opts).SyncOnce(context.Background())
+			if rep == nil {
+				t.Fatal("SyncOnce returned nil report")
+			}
+			if len(rep.Errors) > 0 {
+				t.Fatalf("unexpected errors: %v", rep.Errors)
+			}
+
+			kinds := []string{}
+			skipped := false
+			for _, a := range rep.Actions {
+				kinds = append(kinds, a.Kind)
+				if a.DryRun != tt.opts.DryRun {
+					t.Errorf("action %s dry_run = %v, want %v", a.Kind, a.DryRun, tt.opts.DryRun)
+				}
+				skipped = skipped || a.Skipped
+			}
+			sort.Strings(kinds)
+			assertStrings(t, "actions", kinds, tt.wantKinds)
+
+			dereg := append([]string{}, jobs.deregistered...)
+			sort.Strings(dereg)
+			assertStrings(t, "deregistered", dereg, tt.wantDereg)
+
+			if skipped != tt.wantSkip {
+				t.Errorf("skipped = %v, want %v", skipped, tt.wantSkip)
+			}
+			for rid, want := range tt.wantStatus {
+				if got := st.rooms[rid].Status; got != want {
+					t.Errorf("room %s status = %s, want %s", rid, got, want)
+				}
+			}
+			for rid, want := range tt.wantReason {
+				if got := st.rooms[rid].FailReason; got != want {
+					t.Errorf("room %s fail_reason = %s, want %s", rid, got, want)
+				}
+			}
+			if tt.opts.DryRun && len(st.deleted) > 0 {
+				t.Errorf("dry run deleted rooms %v", st.deleted)
+			}
+			if !tt.opts.DryRun {
+				assertStrings(t, "deleted", st.deleted, tt.expired)
+			}
+		})
+	}
+}
+
+func TestSyncOnceGuardLost(t *testing.T) {
+	st := &fakeStore{rooms: map[string]*store.RoomState{"r1": {RoomID: "r1", Status: "ACTIVED"}}, index: []string{"r1"}}
+	jobs := &fakeJobs{}
+	rep := NewWithJobs(st, jobs, Options{Guard: func(ctx context.Context) (context.Context, bool) { return ctx, false }}).SyncOnce(context.Background())
+	if rep != nil {
+		t.Fatalf("report = %+v, want nil when leadership is lost", rep)
+	}
+	if st.rooms["r1"].Status != "ACTIVED" || len(jobs.deregistered) > 0 {
+		t.Fatal("runner wrote without holding the lease")
+	}
+}
+
+func TestAcceptsLateShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		st   store.RoomState
+		at   int64
+		want bool
+	}{
+		{name: "crash, server ended before dead_at", st: store.RoomState{Status: "DEAD", FailReason: ReasonServerCrash, DeadAt: 100}, at: 90, want: true},
+		{name: "heartbeat lost, same second", st: store.RoomState{Status: "DEAD", FailReason: ReasonHeartbeatLost, DeadAt: 100}, at: 100, want: true},
+		{name: "server ended after dead_at", st: store.RoomState{Status: "DEAD", FailReason: ReasonServerCrash, DeadAt: 100}, at: 101},
+		{name: "alloc timeout", st: store.RoomState{Status: "DEAD", FailReason: ReasonAllocTimeout, DeadAt: 100}, at: 90},
+		{name: "ready timeout", st: store.RoomState{Status: "DEAD", FailReason: ReasonReadyTimeout, DeadAt: 100}, at: 90},
+		{name: "not dead", st: store.RoomState{Status: "FULFILLED", FailReason: ReasonServerCrash, DeadAt: 100}, at: 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AcceptsLateShutdown(&tt.st, tt.at); got != tt.want {
+				t.Fatalf("AcceptsLateShutdown = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func assertStrings(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", what, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s = %v, want %v", what, got, want)
+			return
+		}
+	}
+}
@@ -1,21 +1,171 @@
 package dto
 
-import "hive/pkg/store"
+import (
+	"encoding/json"
+
+	"hive/pkg/store"
+)
 
 // Request DTOs
 type SubmitTicketRequest struct {
-	PlayerID string `json:"player_id" binding:"required"`
+	PlayerID  string         `json:"player_id" binding:"required"`
+	Queue     string         `json:"queue,omitempty"`        // rỗng → default
+	Regions   []string       `json:"regions,omitempty"`      // region chấp nhận được; rỗng → mọi region
+	Latencies map[string]int `json:"latencies_ms,omitempty"` // region → latency client đo (ms)
+	// dữ liệu tùy ý của player (nhân vật, skin...) chuyển cho server qua assignment
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Private room: host tạo lobby có join code (POST /rooms/private)
+type CreatePrivateRoomRequest struct {
+	PlayerID   string            `json:"player_id" binding:"required"` // host
+	Queue      string            `json:"queue,omitempty"`
+	Region     string            `json:"region,omitempty"`
+	MaxPlayers int               `json:"max_players,omitempty"` // 0 → 2
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Vào lobby bằng join code (POST /rooms/join)
+type JoinPrivateRoomRequest struct {
+	Code       string            `json:"code" binding:"required"`
+	PlayerID   string            `json:"player_id" binding:"required"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type CancelTicketRequest struct {
 	// Empty body for now, could add reason later
 }
 
+// Đăng ký build version cho queue (admin)
+type RegisterBuildRequest struct {
+	Queue    string           `json:"queue"`
+	Version  string           `json:"version" binding:"required"`
+	Command  string           `json:"command" binding:"required"`
+	Artifact *ArtifactRequest `json:"artifact,omitempty"`
+}
+
+// Archive của build mà Nomad tải về mỗi allocation (checksum dạng "sha256:<hex>")
+type ArtifactRequest struct {
+	Source      string `json:"source" binding:"required"`
+	Checksum    string `json:"checksum" binding:"required"`
+	Destination string `json:"destination,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+}
+
+// Cập nhật rollout stable/canary của queue (admin)
+type SetRolloutRequest struct {
+	Queue          string  `json:"queue"`
+	Stable         string  `json:"stable" binding:"required"`
+	Canary         string  `json:"canary,omitempty"`
+	CanaryPercent  int     `json:"canary_percent"`
+	CrashThreshold float64 `json:"crash_threshold"` // failure rate 0..1 của canary, mặc định 0.2
+	MinRooms       int64   `json:"min_rooms"`       // mặc định 10
+}
+
 // Shutdown từ server → agent
 type ShutdownRequest struct {
-	Reason  string         `json:"reason" binding:"required"` // no_clients|client_disconnected|afk_timeout|game_cycle_completed|signal_received
+	Reason  string         `json:"reason" binding:"required"` // no_clients|client_disconnected|afk_timeout|game_cycle_completed|signal_received|max_duration
 	At      int64          `json:"at"`                        // optional unix ts; default now
 	Details map[string]any `json:"details,omitempty"`
+	// Result kết quả trận có kiểu (ưu tiên hơn details.winner/scores)
+	Result *RoomResultRequest `json:"result,omitempty"`
+	// giữ nguyên qua các lần retry (hoặc header Idempotency-Key); agent chỉ xử lý một lần
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+type ShutdownResponse struct {
+	OK        bool `json:"ok"`
+	Duplicate bool `json:"duplicate,omitempty"` // cùng idempotency key đã được xử lý trước đó
+	// result gửi kèm không hợp lệ nên bị bỏ (room vẫn FULFILLED)
+	ResultError string `json:"result_error,omitempty"`
+}
+
+// Assignment server lấy lúc khởi động (GET /rooms/:room_id/assignment)
+type RoomAssignmentResponse struct {
+	RoomID       string                   `json:"room_id"`
+	Status       string                   `json:"status"`
+	Queue        string                   `json:"queue,omitempty"`
+	Region       string                   `json:"region,omitempty"`
+	BuildVersion string                   `json:"build_version,omitempty"`
+	Players      []store.PlayerAssignment `json:"players"`
+	Teams        map[string][]string      `json:"teams"`
+	Properties   map[string]string        `json:"properties,omitempty"`
+}
+
+// Kết quả trận server → agent (POST /rooms/:room_id/result, hoặc field result của shutdown)
+type RoomResultRequest struct {
+	Players         []store.PlayerResult `json:"players" binding:"required"`
+	Teams           []store.TeamResult   `json:"teams,omitempty"`
+	Winner          string               `json:"winner,omitempty"` // player_id hoặc team
+	DurationSeconds int64                `json:"duration_seconds"`
+	Abandoned       []string             `json:"abandoned,omitempty"`
+}
+
+// ToMatchResult chuyển sang store.MatchResult với thời điểm nhận
+func (r RoomResultRequest) ToMatchResult(at int64) store.MatchResult {
+	return store.MatchResult{
+		Players:         r.Players,
+		Teams:           r.Teams,
+		Winner:          r.Winner,
+		DurationSeconds: r.DurationSeconds,
+		Abandoned:       r.Abandoned,
+		ReportedAt:      at,
+	}
+}
+
+type RoomResultResponse struct {
+	OK     bool   `json:"ok"`
+	Status string `json:"status"` // ACTIVED (kết quả tạm, báo lại được) hoặc FULFILLED
+}
+
+// Event giữa trận server → agent (POST /rooms/:room_id/events)
+type RoomEventRequest struct {
+	Type    string          `json:"type" binding:"required"` // player_kicked|player_abandoned|round_finished|cheating_suspected|<custom>
+	Payload json.RawMessage `json:"payload,omitempty"`       // JSON tự do, tối đa 8KB
+	At      int64           `json:"at"`                      // unix ts phía server; 0 = lúc agent nhận
+}
+
+type RoomEventResponse struct {
+	OK bool `json:"ok"`
+}
+
+// Backfill: server xin thêm player cho room ACTIVED (POST /rooms/:room_id/backfill)
+type BackfillRequest struct {
+	Slots int    `json:"slots" binding:"required,min=1"`
+	Team  string `json:"team,omitempty"` // rỗng = chia vào team ít người nhất
+}
+
+type BackfillResponse struct {
+	Backfill *store.Backfill `json:"backfill"`
+}
+
+// Lifecycle event stream (GET /admin/events)
+type EventsResponse struct {
+	Events []store.RoomEvent `json:"events"`
+	LastID string            `json:"last_id"` // truyền lại qua ?after= để đọc tiếp
+}
+
+// Kết quả ready callback: ACTIVED, hoặc OPENED nếu agent chưa thấy địa chỉ allocation (sẽ ACTIVED ngay khi có)
+type RoomReadyResponse struct {
+	OK     bool   `json:"ok"`
+	Status string `json:"status"`
+}
+
+// Heartbeat định kỳ server → agent kèm telemetry của room
+type RoomHeartbeatRequest struct {
+	PlayerCount int      `json:"player_count"`
+	Players     []string `json:"players,omitempty"` // player đang kết nối
+	// player đang mất kết nối, còn trong reconnect window
+	Disconnected []string `json:"disconnected,omitempty"`
+	Phase        string   `json:"phase,omitempty"` // ví dụ lobby, playing, ending
+	TickRate     float64  `json:"tick_rate,omitempty"`
+	MemoryMB     float64  `json:"memory_mb,omitempty"`
+	At           int64    `json:"at"` // unix ts phía server
+}
+
+type RoomHeartbeatResponse struct {
+	OK                bool  `json:"ok"`
+	NextHeartbeatSecs int64 `json:"next_heartbeat_seconds,omitempty"` // gợi ý chu kỳ; mất quá heartbeat_timeout → DEAD(heartbeat_lost)
 }
 
 // Response DTOs
@@ -26,7 +176,61 @@ type SubmitTicketResponse struct {
 
 type TicketStatusResponse struct {
 	Status string `json:"status"`
+	Queue  string `json:"queue,omitempty"`
 	RoomID string `json:"room_id,omitempty"`
+	// join token của riêng player khi room ACTIVED (JOIN_TOKEN_KEY bật); gửi cho server lúc kết nối
+	JoinToken          string `json:"join_token,omitempty"`
+	JoinTokenExpiresAt int64  `json:"join_token_expires_at_unix,omitempty"`
+	// địa chỉ server khi room đã ACTIVED (ticket được ghép vào room đang chạy qua backfill)
+	ServerHost string `json:"server_host,omitempty"`
+	ServerIP   string `json:"server_ip,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	// ready check (status PROPOSED): hạn accept và tiến độ của trận được đề xuất
+	AcceptDeadline int64 `json:"accept_deadline_unix,omitempty"`
+	Accepted       bool  `json:"accepted,omitempty"`
+	AcceptedCount  int   `json:"accepted_count,omitempty"`
+	ProposalSize   int   `json:"proposal_size,omitempty"`
+}
+
+// Kết quả POST /tickets/:id/accept|decline
+type ProposalResponse struct {
+	Status        string `json:"status"` // PENDING|ACCEPTED|DECLINED|EXPIRED
+	AcceptedCount int    `json:"accepted_count"`
+	ProposalSize  int    `json:"proposal_size"`
+	Deadline      int64  `json:"accept_deadline_unix"`
+	RoomID        string `json:"room_id,omitempty"`
+}
+
+// Lobby của private room; sau khi start có room_id, room ACTIVED thì kèm địa chỉ server và join token (member đã xác thực)
+type LobbyResponse struct {
+	Lobby *store.Lobby `json:"lobby"`
+	// member token của player, chỉ trả khi tạo/join; gửi lại qua Authorization: Bearer để poll/start/leave
+	MemberToken        string `json:"member_token,omitempty"`
+	RoomStatus         string `json:"room_status,omitempty"`
+	ServerHost         string `json:"server_host,omitempty"`
+	ServerIP           string `json:"server_ip,omitempty"`
+	Port               int    `json:"port,omitempty"`
+	JoinToken          string `json:"join_token,omitempty"`
+	JoinTokenExpiresAt int64  `json:"join_token_expires_at_unix,omitempty"`
+}
+
+// Kết quả GET /reconnect/lookup: room ACTIVED chứa player và thông tin kết nối lại
+type ReconnectLookupResponse struct {
+	Reconnectable bool   `json:"reconnectable"`
+	Reason        string `json:"reason,omitempty"` // not_found | room_ended
+	RoomID        string `json:"room_id,omitempty"`
+	ServerHost    string `json:"server_host,omitempty"`
+	ServerIP      string `json:"server_ip,omitempty"`
+	Port          int    `json:"port,omitempty"`
+	// reconnect window của room; hết window mà không quay lại → room kết thúc client_disconnected
+	ReconnectWindowSeconds int  `json:"reconnect_window_seconds,omitempty"`
+	Disconnected           bool `json:"disconnected,omitempty"` // server đang thấy player mất kết nối
+	Paused                 bool `json:"paused,omitempty"`       // mọi player đều mất kết nối, trận đang tạm dừng
+	// caller chưa gửi join token hợp lệ của room → không cấp token mới, phải xác thực lại
+	AuthRequired bool `json:"auth_required,omitempty"`
+	// join token mới cho lần kết nối lại (JOIN_TOKEN_KEY bật, caller đã xác thực)
+	JoinToken          string `json:"join_token,omitempty"`
+	JoinTokenExpiresAt int64  `json:"join_token_expires_at_unix,omitempty"`
 }
 
 type CancelTicketResponse struct {
@@ -82,15 +286,29 @@ const (
 	ErrCodeMissingPlayerID = "MISSING_PLAYER_ID"
 	ErrCodeMissingRoomID   = "MISSING_ROOM_ID"
 	ErrCodeInvalidRequest  = "INVALID_REQUEST"
+	ErrCodeUnknownQueue    = "UNKNOWN_QUEUE"
+	ErrCodeUnknownRegion   = "UNKNOWN_REGION"
+	ErrCodeUnknownBuild    = "UNKNOWN_BUILD"
+	ErrCodeInvalidArtifact = "INVALID_ARTIFACT"
+	ErrCodeInvalidResult   = "INVALID_RESULT"
+	ErrCodeInvalidEvent    = "INVALID_EVENT"
 
 	// Not found errors (404)
 	ErrCodeTicketNotFound = "TICKET_NOT_FOUND"
 	ErrCodeRoomNotFound   = "ROOM_NOT_FOUND"
 	ErrCodeRoomNotReady   = "ROOM_NOT_READY"
+	ErrCodeNoBackfill     = "NO_BACKFILL"
+	ErrCodeLobbyNotFound  = "LOBBY_NOT_FOUND"
 
 	// Business logic errors (400)
 	ErrCodeTicketRejected     = "TICKET_REJECTED"
 	ErrCodeTicketCancelFailed = "TICKET_CANCEL_FAILED"
+	ErrCodeLobbyFull          = "LOBBY_FULL"          // 409
+	ErrCodeLobbyClosed        = "LOBBY_CLOSED"        // 409: đã start hoặc host đã rời
+	ErrCodeNotLobbyHost       = "NOT_LOBBY_HOST"      // 403
+	ErrCodeNoCapacity         = "NO_CAPACITY"         // 503
+	ErrCodeNotProposed        = "TICKET_NOT_PROPOSED" // 409: không có ready check đang chờ
+	ErrCodeDeclinePenalty     = "DECLINE_PENALTY"     // 429: vừa decline/bỏ lỡ ready check
 
 	// Server errors (500)
 	ErrCodeInternalError = "INTERNAL_ERROR"
@@ -0,0 +1,86 @@
+// Package jointoken ký và xác thực join token của từng player (HMAC-SHA256, key dùng chung agent ↔ game server).
+// Token dạng <payload base64url>.<signature base64url>, server xác thực offline không cần gọi agent.
+package jointoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed join token")
+	ErrBadSignature = errors.New("invalid join token signature")
+	ErrExpired      = errors.New("join token expired")
+)
+
+// Claims nội dung token: player nào được vào room nào, đến khi nào
+type Claims struct {
+	RoomID    string `json:"rid"`
+	PlayerID  string `json:"pid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var enc = base64.RawURLEncoding
+
+func sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return enc.EncodeToString(mac.Sum(nil))
+}
+
+// Sign tạo token cho claims
+func Sign(key []byte, c Claims) string {
+	b, _ := json.Marshal(c)
+	payload := enc.EncodeToString(b)
+	return payload + "." + sign(key, payload)
+}
+
+// Issue tạo token cho player vào room, hiệu lực ttl kể từ now
+func Issue(key []byte, roomID, playerID string, ttl time.Duration, now time.Time) (string, int64) {
+	exp := now.Add(ttl).Unix()
+	return Sign(key, Claims{RoomID: roomID, PlayerID: playerID, IssuedAt: now.Unix(), ExpiresAt: exp}), exp
+}
+
+// Verify kiểm tra chữ ký và hạn của token, trả claims
+func Verify(key []byte, token string, now time.Time) (*Claims, error) {
+	return VerifyWithin(key, token, now, 0)
+}
+
+// VerifyWithin như Verify nhưng còn nhận token đã hết hạn không quá grace
+// (client rớt mạng lâu hơn TTL dùng token cũ để xin token mới trong reconnect window)
+func VerifyWithin(key []byte, token string, now time.Time, grace time.Duration) (*Claims, error) {
+	c, err := Parse(key, token)
+	if err != nil {
+		return nil, err
+	}
+	if c.ExpiresAt > 0 && now.Unix() > c.ExpiresAt+int64(grace/time.Second) {
+		return nil, ErrExpired
+	}
+	return c, nil
+}
+
+// Parse chỉ kiểm tra chữ ký (không xét hạn), trả claims
+func Parse(key []byte, token string) (*Claims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || payload == "" || sig == "" {
+		return nil, ErrMalformed
+	}
+	if !hmac.Equal([]byte(sig), []byte(sign(key, payload))) {
+		return nil, ErrBadSignature
+	}
+	b, err := enc.DecodeString(payload)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var c Claims
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrMalformed
+	}
+	return &c, nil
+}
@@ -0,0 +1,85 @@
+package jointoken
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestIssueVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tok, exp := Issue(testKey, "r1", "p1", 5*time.Minute, now)
+	if exp != now.Add(5*time.Minute).Unix() {
+		t.Fatalf("exp = %d", exp)
+	}
+	c, err := Verify(testKey, tok, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	want := Claims{RoomID: "r1", PlayerID: "p1", IssuedAt: now.Unix(), ExpiresAt: exp}
+	if *c != want {
+		t.Fatalf("claims = %+v, want %+v", *c, want)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	valid, _ := Issue(testKey, "r1", "p1", time.Minute, now)
+	payload, sig, _ := strings.Cut(valid, ".")
+	// payload khác (player p2) giữ chữ ký cũ
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"rid":"r1","pid":"p2","iat":1700000000,"exp":1700000060}`)) + "." + sig
+	tests := []struct {
+		name  string
+		key   []byte
+		token string
+		at    time.Time
+		grace time.Duration
+		want  error
+	}{
+		{name: "valid", key: testKey, token: valid, at: now},
+		{name: "valid at exp", key: testKey, token: valid, at: now.Add(time.Minute)},
+		{name: "expired", key: testKey, token: valid, at: now.Add(time.Minute + time.Second), want: ErrExpired},
+		{name: "expired within grace", key: testKey, token: valid, at: now.Add(2 * time.Minute), grace: time.Minute},
+		{name: "expired past grace", key: testKey, token: valid, at: now.Add(2*time.Minute + time.Second), grace: time.Minute, want: ErrExpired},
+		{name: "wrong key", key: []byte("another-key-another-key-another!"), token: valid, at: now, want: ErrBadSignature},
+		{name: "tampered payload", key: testKey, token: forged, at: now, want: ErrBadSignature},
+		{name: "tampered signature", key: testKey, token: payload + "." + sig[:len(sig)-2] + "AA", at: now, want: ErrBadSignature},
+		{name: "empty", key: testKey, token: "", at: now, want: ErrMalformed},
+		{name: "no separator", key: testKey, token: payload, at: now, want: ErrMalformed},
+		{name: "empty signature", key: testKey, token: payload + ".", at: now, want: ErrMalformed},
+		{name: "signed non-json payload", key: testKey, token: "bm90LWpzb24." + sign(testKey, "bm90LWpzb24"), at: now, want: ErrMalformed},
+		{name: "signed non-base64 payload", key: testKey, token: "!!!." + sign(testKey, "!!!"), at: now, want: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyWithin(tt.key, tt.token, tt.at, tt.grace)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.grace == 0 {
+				if _, err := Verify(tt.key, tt.token, tt.at); !errors.Is(err, tt.want) {
+					t.Fatalf("Verify err = %v, want %v", err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseIgnoresExpiry(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tok, _ := Issue(testKey, "r1", "p1", time.Minute, now)
+	if _, err := Verify(testKey, tok, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("Verify err = %v, want %v", err, ErrExpired)
+	}
+	c, err := Parse(testKey, tok)
+	if err != nil || c.PlayerID != "p1" {
+		t.Fatalf("Parse = %+v, %v", c, err)
+	}
+	if _, err := Parse([]byte("wrong"), tok); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("Parse with wrong key err = %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package leader
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"hive/pkg/store"
+)
+
+// Elector bầu leader giữa các agent bằng lease Redis có TTL + fencing token.
+// Leader gia hạn lease mỗi TTL/3; leader chết → lease hết hạn → agent khác tự lên (failover).
+type Elector struct {
+	store *store.Manager
+	name  string
+	id    string
+	ttl   time.Duration
+
+	mu      sync.RWMutex
+	token   int64
+	since   time.Time
+	renewAt time.Time
+}
+
+// Status trạng thái leader của agent này và lease hiện hành
+type Status struct {
+	Enabled     bool         `json:"enabled"`
+	ID          string       `json:"id"`
+	IsLeader    bool         `json:"is_leader"`
+	Token       int64        `json:"token,omitempty"`
+	LeaderSince int64        `json:"leader_since_unix,omitempty"`
+	LastRenewAt int64        `json:"last_renew_at_unix,omitempty"`
+	TTLSeconds  int64        `json:"ttl_seconds"`
+	Lease       *store.Lease `json:"lease,omitempty"`
+}
+
+// New tạo elector cho lease name với id của agent (duy nhất giữa các agent)
+func New(st *store.Manager, name, id string, ttl time.Duration) *Elector {
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	return &Elector{store: st, name: name, id: id, ttl: ttl}
+}
+
+// Run giành/gia hạn lease định kỳ; dừng khi ctx.Done() và trả lease nếu đang là leader
+func (e *Elector) Run(ctx context.Context) {
+	e.tick(ctx)
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+			e.tick(ctx)
+		}
+	}
+}
+
+func (e *Elector) tick(ctx context.Context) {
+	token, err := e.store.TryLease(ctx, e.name, e.id, e.ttl)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now()
+	if err != nil {
+		// Không gia hạn được: tự hạ khi lease chắc chắn đã hết hạn ở phía Redis
+		if e.token > 0 && now.Sub(e.renewAt) >= e.ttl {
+			log.Printf("leader: %s lost lease %s (redis: %v)", e.id, e.name, err)
+			e.token = 0
+		}
+		return
+	}
+	switch {
+	case token > 0 && e.token != token:
+		log.Printf("leader: %s acquired lease %s (token %d)", e.id, e.name, token)
+		e.token, e.since = token, now
+	case token == 0 && e.token > 0:
+		log.Printf("leader: %s lost lease %s", e.id, e.name)
+		e.token = 0
+	}
+	if token > 0 {
+		e.renewAt = now
+	}
+}
+
+func (e *Elector) resign() {
+	e.mu.Lock()
+	token := e.token
+	e.token = 0
+	e.mu.Unlock()
+	if token > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = e.store.ReleaseLease(ctx, e.name, e.id, token)
+	}
+}
+
+// IsLeader cho biết agent đang giữ lease (theo lần gia hạn gần nhất, còn trong TTL)
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.token > 0 && time.Since(e.renewAt) < e.ttl
+}
+
+// Token trả fencing token hiện tại (0 = không phải leader)
+func (e *Elector) Token() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.token
+}
+
+// Guard dùng trước thao tác ghi của leader: chỉ true khi vẫn là leader và token còn là lease hiện hành
+// trong Redis. ctx trả về mang fencing token (store.WithFence) để ghi Redis với ctx đó kiểm tra token
+// trong cùng transaction — leader mất lease sau lần kiểm tra này vẫn không ghi được.
+// Thao tác ngoài Redis (deregister job Nomad) chỉ có lần kiểm tra trước.
+func (e *Elector) Guard(ctx context.Context) (context.Context, bool) {
+	if !e.IsLeader() {
+		return ctx, false
+	}
+	token := e.Token()
+	if !e.store.CheckFence(ctx, e.name, token) {
+		return ctx, false
+	}
+	return store.WithFence(ctx, e.name, token), true
+}
+
+// Status trả trạng thái leader (cho /admin/leader)
+func (e *Elector) Status(ctx context.Context) Status {
+	e.mu.RLock()
+	st := Status{Enabled: true, ID: e.id, Token: e.token, TTLSeconds: int64(e.ttl / time.Second)}
+	if e.token > 0 {
+		st.LeaderSince = e.since.Unix()
+		st.LastRenewAt = e.renewAt.Unix()
+	}
+	e.mu.RUnlock()
+	st.IsLeader = e.IsLeader()
+	if lease, err := e.store.GetLease(ctx, e.name); err == nil {
+		st.Lease = lease
+	}
+	return st
+}
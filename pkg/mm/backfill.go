@@ -0,0 +1,156 @@
+package mm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"hive/pkg/store"
+)
+
+// RequestBackfill mở (hoặc cập nhật) backfill cho room ACTIVED: matcher sẽ lấy ticket OPENED cùng queue lấp slots chỗ.
+// team rỗng → mỗi player chia vào team đang ít người nhất.
+func (m *Manager) RequestBackfill(ctx context.Context, roomID string, slots int, team string) (*store.Backfill, error) {
+	return m.store.CreateBackfill(ctx, roomID, slots, team)
+}
+
+// ErrNoBackfill room không có backfill đang mở (chưa xin, đã đủ, đã huỷ hoặc hết hạn)
+var ErrNoBackfill = errors.New("room has no backfill")
+
+// GetBackfill trả backfill đang gắn với room
+func (m *Manager) GetBackfill(ctx context.Context, roomID string) (*store.Backfill, error) {
+	st, err := m.store.GetRoomState(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if st.BackfillID == "" {
+		return nil, ErrNoBackfill
+	}
+	bf, err := m.store.GetBackfill(ctx, st.BackfillID)
+	if store.IsNotFound(err) {
+		return nil, ErrNoBackfill // hết BACKFILL_TTL
+	}
+	return bf, err
+}
+
+// CancelBackfill huỷ backfill đang mở của room
+func (m *Manager) CancelBackfill(ctx context.Context, roomID string) (*store.Backfill, error) {
+	bf, err := m.GetBackfill(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.CloseBackfill(ctx, bf.BackfillID, "CANCELED"); err != nil {
+		return nil, err
+	}
+	bf.Status = "CANCELED"
+	return bf, nil
+}
+
+// TryBackfill lấp các backfill đang mở của queue bằng ticket OPENED (FIFO, region của room nằm trong region ticket chấp nhận).
+// Ticket được gỡ khỏi queue trước khi ghi vào room; ghi lỗi thì trả ticket về queue. Trả số player đã thêm.
+func (m *Manager) TryBackfill(ctx context.Context, queueName string) (int, error) {
+	q, ok := m.queue(queueName)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownQueue, queueName)
+	}
+	bfs, err := m.store.ListOpenBackfills(ctx, q.Name)
+	if err != nil || len(bfs) == 0 {
+		return 0, err
+	}
+	added := 0
+	for _, bf := range bfs {
+		tickets, err := m.store.ListOpenedTicketsInQueue(ctx, q.Name)
+		if err != nil {
+			return added, err
+		}
+		if len(tickets) == 0 {
+			break
+		}
+		st, err := m.store.GetRoomState(ctx, bf.RoomID)
+		if err != nil || st.Status != "ACTIVED" {
+			_ = m.store.CloseBackfill(ctx, bf.BackfillID, "CANCELED") // room đã kết thúc/hết hạn
+			continue
+		}
+		picked := m.pickBackfill(bf, st, tickets)
+		if len(picked) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(picked))
+		for _, t := range picked {
+			ids = append(ids, t.TicketID)
+		}
+		if err := m.store.TakeTickets(ctx, q.Name, ids...); err != nil {
+			continue // ticket vừa bị ghép/huỷ, thử lại vòng sau
+		}
+		players := backfillAssignments(q, bf, st.Assignment, picked)
+		if _, _, fillErr := m.store.FillBackfill(ctx, bf.BackfillID, players); fillErr != nil {
+			// trả ticket về đầu queue theo thứ tự cũ
+			if err := m.store.RequeueTickets(ctx, q.Name, ids...); err != nil {
+				return added, err
+			}
+			if errors.Is(fillErr, store.ErrBackfillClosed) {
+				continue
+			}
+			return added, fillErr
+		}
+		for _, t := range picked {
+			_ = m.store.MarkMatched(ctx, t.TicketID, bf.RoomID)
+		}
+		added += len(picked)
+	}
+	return added, nil
+}
+
+// pickBackfill chọn tối đa bf.Slots ticket FIFO chấp nhận region của room và chưa có trong room
+func (m *Manager) pickBackfill(bf store.Backfill, st *store.RoomState, tickets []store.Ticket) []store.Ticket {
+	inRoom := map[string]bool{}
+	for _, p := range st.Players {
+		inRoom[p] = true
+	}
+	out := []store.Ticket{}
+	for _, t := range tickets {
+		if len(out) == bf.Slots {
+			break
+		}
+		if inRoom[t.PlayerID] || (bf.Region != "" && len(t.Regions) > 0 && !contains(t.Regions, bf.Region)) {
+			continue
+		}
+		inRoom[t.PlayerID] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// backfillAssignments chia player bổ sung vào bf.Team; rỗng → team ít người nhất trong q.Teams,
+// queue không cấu hình team thì mỗi player một team mới (team_N tiếp theo) như buildAssignment
+func backfillAssignments(q Queue, bf store.Backfill, a *store.RoomAssignment, tickets []store.Ticket) []store.PlayerAssignment {
+	size := map[string]int{}
+	if a != nil {
+		for t, ids := range a.Teams {
+			size[t] = len(ids)
+		}
+	}
+	out := make([]store.PlayerAssignment, 0, len(tickets))
+	for _, t := range tickets {
+		team := bf.Team
+		switch {
+		case team != "":
+		case len(q.Teams) > 0:
+			team = q.Teams[0]
+			for _, name := range q.Teams[1:] {
+				if size[name] < size[team] {
+					team = name
+				}
+			}
+		default:
+			for n := len(size) + 1; ; n++ {
+				if team = fmt.Sprintf("team_%d", n); size[team] == 0 {
+					break
+				}
+			}
+		}
+		size[team]++
+		out = append(out, store.PlayerAssignment{PlayerID: t.PlayerID, TicketID: t.TicketID, Team: team, Attributes: t.Attributes})
+	}
+	return out
+}
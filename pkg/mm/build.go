@@ -0,0 +1,151 @@
+package mm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"hive/pkg/store"
+	"hive/pkg/svrmgr"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnknownBuild trả về khi rollout tham chiếu version chưa đăng ký
+var ErrUnknownBuild = errors.New("unknown build")
+
+// SetArtifactSources đặt các URL prefix artifact của build đăng ký qua RegisterBuild được phép tải về (rỗng = cấm artifact)
+func (m *Manager) SetArtifactSources(prefixes []string) { m.artifactSources = prefixes }
+
+// RegisterBuild đăng ký một build version cho queue; artifact phải nằm trong allowlist SetArtifactSources
+func (m *Manager) RegisterBuild(ctx context.Context, b store.ServerBuild) (*store.ServerBuild, error) {
+	if _, ok := m.queue(b.Queue); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQueue, b.Queue)
+	}
+	if b.Queue == "" {
+		b.Queue = store.DefaultQueue
+	}
+	if b.Version == "" || b.Command == "" {
+		return nil, fmt.Errorf("version and command required")
+	}
+	if b.Artifact != nil {
+		a := svrmgr.Artifact(*b.Artifact)
+		if err := a.Validate(); err != nil {
+			return nil, err
+		}
+		if err := a.CheckSource(m.artifactSources); err != nil {
+			return nil, err
+		}
+	}
+	b.CreatedAt = time.Now().Unix()
+	if err := m.store.SaveBuild(ctx, b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SetRollout cập nhật stable/canary của queue; version phải đã đăng ký
+func (m *Manager) SetRollout(ctx context.Context, r store.Rollout) (*store.Rollout, error) {
+	if _, ok := m.queue(r.Queue); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQueue, r.Queue)
+	}
+	if r.Queue == "" {
+		r.Queue = store.DefaultQueue
+	}
+	for _, v := range []string{r.Stable, r.Canary} {
+		if v == "" {
+			continue
+		}
+		if _, err := m.store.GetBuild(ctx, r.Queue, v); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownBuild, v)
+		}
+	}
+	if r.CanaryPercent < 0 || r.CanaryPercent > 100 {
+		return nil, fmt.Errorf("canary_percent must be 0..100")
+	}
+	if r.CrashThreshold <= 0 {
+		r.CrashThreshold = 0.2
+	}
+	if r.MinRooms <= 0 {
+		r.MinRooms = 10
+	}
+	r.RolledBack, r.RollbackReason, r.RolledBackAt = "", "", 0
+	r.RolloutID = uuid.New().String() // thống kê canary bắt đầu lại từ 0 cho rollout mới
+	r.UpdatedAt = time.Now().Unix()
+	if err := m.store.SaveRollout(ctx, r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// pickBuild chọn build cho room mới theo rollout của queue, trả kèm rollout_id; ok=false nếu queue chưa có rollout
+// (khi đó dùng executablePath như cũ). Canary vượt ngưỡng failure sẽ bị rollback tại đây.
+func (m *Manager) pickBuild(ctx context.Context, queue string) (*store.ServerBuild, string, bool) {
+	r, err := m.store.GetRollout(ctx, queue)
+	if err != nil {
+		return nil, "", false
+	}
+	if r.Canary != "" {
+		m.evaluateCanary(ctx, r)
+	}
+	version := r.Stable
+	if r.Canary != "" && rand.Intn(100) < r.CanaryPercent {
+		version = r.Canary
+	}
+	if version == "" {
+		return nil, "", false
+	}
+	b, err := m.store.GetBuild(ctx, queue, version)
+	if err != nil {
+		return nil, "", false
+	}
+	return b, r.RolloutID, true
+}
+
+// evaluateCanary rollback canary khi tỉ lệ room DEAD của canary trong rollout hiện tại vượt CrashThreshold sau MinRooms room
+func (m *Manager) evaluateCanary(ctx context.Context, r *store.Rollout) {
+	stats, err := m.store.GetBuildStats(ctx, r.Queue, r.Canary, r.RolloutID)
+	if err != nil || stats.Rooms < r.MinRooms || stats.Rate <= r.CrashThreshold {
+		return
+	}
+	r.RolledBack = r.Canary
+	r.RollbackReason = fmt.Sprintf("failure_rate %.2f > %.2f after %d rooms", stats.Rate, r.CrashThreshold, stats.Rooms)
+	r.RolledBackAt = time.Now().Unix()
+	r.Canary = ""
+	r.CanaryPercent = 0
+	r.UpdatedAt = r.RolledBackAt
+	_ = m.store.SaveRollout(ctx, *r)
+}
+
+// BuildReport thông tin build + rollout + thống kê failure của rollout hiện tại (cho admin API)
+type BuildReport struct {
+	Queue   string              `json:"queue"`
+	Rollout *store.Rollout      `json:"rollout,omitempty"`
+	Builds  []store.ServerBuild `json:"builds"`
+	Stats   []store.BuildStats  `json:"stats"`
+}
+
+// Builds trả báo cáo build của queue
+func (m *Manager) Builds(ctx context.Context, queue string) (*BuildReport, error) {
+	if queue == "" {
+		queue = store.DefaultQueue
+	}
+	builds, err := m.store.ListBuilds(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+	rep := &BuildReport{Queue: queue, Builds: builds, Stats: []store.BuildStats{}}
+	r, err := m.store.GetRollout(ctx, queue)
+	if err != nil {
+		return rep, nil
+	}
+	rep.Rollout = r
+	for _, b := range builds {
+		if st, err := m.store.GetBuildStats(ctx, queue, b.Version, r.RolloutID); err == nil {
+			rep.Stats = append(rep.Stats, st)
+		}
+	}
+	return rep, nil
+}
@@ -0,0 +1,38 @@
+package mm
+
+import (
+	"context"
+	"time"
+
+	"hive/pkg/jointoken"
+	"hive/pkg/store"
+)
+
+// SetJoinTokens bật join token theo player: key ký token (truyền cho server qua env HIVE_JOIN_KEY), ttl hiệu lực token
+func (m *Manager) SetJoinTokens(key string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	m.joinKey, m.joinTTL = key, ttl
+}
+
+// IssueJoinToken cấp token cho player của ticket khi room đã ACTIVED; rỗng khi chưa bật hoặc room chưa sẵn sàng
+func (m *Manager) IssueJoinToken(ctx context.Context, t *store.Ticket) (string, int64) {
+	if m.joinKey == "" || t.RoomID == "" || t.Status != "MATCHED" {
+		return "", 0
+	}
+	st, err := m.store.GetRoomState(ctx, t.RoomID)
+	if err != nil || st.Status != "ACTIVED" || !contains(st.Players, t.PlayerID) {
+		return "", 0
+	}
+	return jointoken.Issue([]byte(m.joinKey), st.RoomID, t.PlayerID, m.joinTTL, time.Now())
+}
+
+// jobEnv biến môi trường của job game server: room id, token callback riêng của room, join key
+func (m *Manager) jobEnv(roomID string) map[string]string {
+	env := map[string]string{"HIVE_ROOM_ID": roomID, "HIVE_TOKEN": m.RoomToken(roomID)}
+	if m.joinKey != "" {
+		env["HIVE_JOIN_KEY"] = m.joinKey
+	}
+	return env
+}
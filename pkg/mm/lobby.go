@@ -0,0 +1,230 @@
+package mm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"hive/pkg/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLobbyPlayers = 2
+	maxLobbyPlayers     = 64
+)
+
+// ErrInvalidLobby tham số tạo private room không hợp lệ (max_players)
+var ErrInvalidLobby = errors.New("invalid lobby")
+
+// PrivateRoomRequest dữ liệu host gửi khi tạo private room
+type PrivateRoomRequest struct {
+	HostID     string
+	Queue      string // rỗng → default; resources/teams/properties lấy theo queue
+	Region     string // rỗng → region đầu tiên còn capacity lúc start
+	MaxPlayers int    // 0 → 2
+	Attributes map[string]string
+}
+
+// newMemberToken sinh member token ngẫu nhiên, trả token (chỉ đưa cho player một lần) và hash lưu trong lobby
+func newMemberToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashMemberToken(token), nil
+}
+
+func hashMemberToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LobbyMemberID trả player_id của member sở hữu token; false khi token sai hoặc rỗng
+func LobbyMemberID(l *store.Lobby, token string) (string, bool) {
+	if l == nil || token == "" {
+		return "", false
+	}
+	h := hashMemberToken(token)
+	for _, p := range l.Members {
+		if p.TokenHash != "" && subtle.ConstantTimeCompare([]byte(p.TokenHash), []byte(h)) == 1 {
+			return p.PlayerID, true
+		}
+	}
+	return "", false
+}
+
+// CreatePrivateRoom tạo lobby WAITING với join code, host là member đầu tiên; chưa allocate server.
+// Trả kèm member token của host (dùng cho poll/start/leave).
+func (m *Manager) CreatePrivateRoom(ctx context.Context, req PrivateRoomRequest) (*store.Lobby, string, error) {
+	q, ok := m.queue(req.Queue)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownQueue, req.Queue)
+	}
+	if req.Region != "" && m.region(req.Region) == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownRegion, req.Region)
+	}
+	if req.MaxPlayers == 0 {
+		req.MaxPlayers = defaultLobbyPlayers
+	}
+	if req.MaxPlayers < 1 || req.MaxPlayers > maxLobbyPlayers {
+		return nil, "", fmt.Errorf("%w: max_players must be 1-%d", ErrInvalidLobby, maxLobbyPlayers)
+	}
+	token, hash, err := newMemberToken()
+	if err != nil {
+		return nil, "", err
+	}
+	l, err := m.store.CreateLobby(ctx, store.Lobby{
+		HostID:     req.HostID,
+		Queue:      q.Name,
+		Region:     req.Region,
+		MaxPlayers: req.MaxPlayers,
+		Members:    []store.LobbyMember{{PlayerID: req.HostID, Attributes: req.Attributes, JoinedAt: time.Now().Unix(), TokenHash: hash}},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return l, token, nil
+}
+
+// GetLobby trả lobby theo join code
+func (m *Manager) GetLobby(ctx context.Context, code string) (*store.Lobby, error) {
+	return m.store.GetLobby(ctx, code)
+}
+
+// JoinPrivateRoom thêm player vào lobby WAITING, trả member token mới của player.
+// player_id đã là member thì phải gửi đúng member token (token) và chỉ cập nhật attributes.
+func (m *Manager) JoinPrivateRoom(ctx context.Context, code, playerID, token string, attrs map[string]string) (*store.Lobby, string, error) {
+	newToken, hash, err := newMemberToken()
+	if err != nil {
+		return nil, "", err
+	}
+	l, err := m.store.UpdateLobby(ctx, code, func(l *store.Lobby) error {
+		if l.Status != "WAITING" {
+			return store.ErrLobbyClosed
+		}
+		if _, ok := l.Member(playerID); ok {
+			if pid, ok := LobbyMemberID(l, token); !ok || pid != playerID {
+				return store.ErrLobbyAuth
+			}
+			for i := range l.Members {
+				if l.Members[i].PlayerID == playerID {
+					l.Members[i].Attributes = attrs
+				}
+			}
+			newToken = token
+			return nil
+		}
+		if len(l.Members) >= l.MaxPlayers {
+			return store.ErrLobbyFull
+		}
+		l.Members = append(l.Members, store.LobbyMember{PlayerID: playerID, Attributes: attrs, JoinedAt: time.Now().Unix(), TokenHash: hash})
+		return nil
+	})
+	if err != nil {
+		return l, "", err
+	}
+	return l, newToken, nil
+}
+
+// LeavePrivateRoom gỡ member sở hữu token khỏi lobby WAITING; host rời thì lobby CLOSED
+func (m *Manager) LeavePrivateRoom(ctx context.Context, code, token string) (*store.Lobby, error) {
+	return m.store.UpdateLobby(ctx, code, func(l *store.Lobby) error {
+		playerID, ok := LobbyMemberID(l, token)
+		if !ok {
+			return store.ErrLobbyAuth
+		}
+		if l.Status != "WAITING" {
+			return store.ErrLobbyClosed
+		}
+		if playerID == l.HostID {
+			l.Status = "CLOSED"
+			return nil
+		}
+		for i, p := range l.Members {
+			if p.PlayerID == playerID {
+				l.Members = append(l.Members[:i], l.Members[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// StartPrivateRoom host (xác thực bằng member token) bắt đầu trận: chọn region còn capacity, chuyển lobby STARTED rồi tạo room OPENED
+// và allocate server như room ghép ngẫu nhiên (assignment theo thứ tự vào lobby)
+func (m *Manager) StartPrivateRoom(ctx context.Context, code, token string) (*store.Lobby, *store.RoomState, error) {
+	l, err := m.store.GetLobby(ctx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	playerID, ok := LobbyMemberID(l, token)
+	if !ok {
+		return l, nil, store.ErrLobbyAuth
+	}
+	if l.HostID != playerID {
+		return l, nil, store.ErrNotLobbyHost
+	}
+	if l.Status != "WAITING" {
+		return l, nil, store.ErrLobbyClosed
+	}
+	q, ok := m.queue(l.Queue)
+	if !ok {
+		return l, nil, fmt.Errorf("%w: %s", ErrUnknownQueue, l.Queue)
+	}
+	candidates := m.acceptableRegions()
+	if l.Region != "" {
+		candidates = []*region{m.region(l.Region)}
+	}
+	var chosen *region
+	for _, r := range candidates {
+		if r != nil && m.admit(r, q) {
+			chosen = r
+			break
+		}
+	}
+	if chosen == nil {
+		return l, nil, fmt.Errorf("%w: %s", ErrNoCapacity, q.Name)
+	}
+	roomID := uuid.New().String()
+	l, err = m.store.UpdateLobby(ctx, code, func(cur *store.Lobby) error {
+		switch {
+		case cur.HostID != playerID:
+			return store.ErrNotLobbyHost
+		case cur.Status != "WAITING":
+			return store.ErrLobbyClosed
+		}
+		cur.Status, cur.RoomID, cur.StartedAt = "STARTED", roomID, time.Now().Unix()
+		return nil
+	})
+	if err != nil {
+		return l, nil, err
+	}
+	tickets := make([]store.Ticket, 0, len(l.Members))
+	for _, p := range l.Members {
+		tickets = append(tickets, store.Ticket{PlayerID: p.PlayerID, Queue: q.Name, Attributes: p.Attributes})
+	}
+	st, err := m.openRoom(ctx, q, chosen, roomID, l.Code, tickets...)
+	if err != nil {
+		// không tạo được room → lobby về WAITING để host start lại
+		if back, rerr := m.store.UpdateLobby(context.Background(), code, func(cur *store.Lobby) error {
+			if cur.Status != "STARTED" || cur.RoomID != roomID {
+				return store.ErrLobbyClosed
+			}
+			cur.Status, cur.RoomID, cur.StartedAt = "WAITING", "", 0
+			return nil
+		}); rerr == nil {
+			l = back
+		}
+		return l, nil, err
+	}
+	return l, st, nil
+}
@@ -2,6 +2,8 @@ package mm
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"hive/pkg/store"
@@ -10,27 +12,211 @@ import (
 	"github.com/google/uuid"
 )
 
+// Queue cấu hình riêng của một queue: resources và placement cho job game server
+type Queue struct {
+	Name      string
+	CPU       int
+	MemoryMB  int
+	DiskMB    int
+	Placement svrmgr.Placement
+	Command   string           // rỗng = executablePath
+	Artifact  *svrmgr.Artifact // archive server tải về mỗi allocation thay vì binary cài sẵn
+	// Teams tên team, player chia lần lượt theo thứ tự ghép; rỗng → mỗi player một team (team_1, team_2...)
+	Teams []string
+	// Properties custom match properties gửi cho server trong assignment (map, mode...)
+	Properties map[string]string
+	// ReconnectWindow thời gian player rớt mạng được quay lại (0 = mặc định của Manager)
+	ReconnectWindow time.Duration
+	// ReadyCheck > 0 → ghép xong ticket chuyển PROPOSED, mọi player phải accept trong thời gian này mới allocate
+	ReadyCheck time.Duration
+	// DeclinePenalty thời gian player decline/không accept kịp bị chặn tạo ticket mới (0 = 30s)
+	DeclinePenalty time.Duration
+}
+
+// ErrUnknownQueue trả về khi ticket chỉ định queue chưa được cấu hình
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// ErrNoCapacity trả về khi fleet không còn chỗ cho resource profile của queue; ticket được giữ lại trong queue
+var ErrNoCapacity = errors.New("no capacity for queue")
+
+// defaultQueue dùng khi queue không được cấu hình (giữ resources cũ 400MHz/400MB)
+var defaultQueue = Queue{Name: store.DefaultQueue, CPU: 400, MemoryMB: 400}
+
 type Manager struct {
 	store          *store.Manager
-	svr            *svrmgr.Manager
+	regions        []*region
 	allocTimeout   time.Duration
 	pollInterval   time.Duration
 	executablePath string
+	queues         map[string]Queue
+
+	// admission control theo capacity của fleet
+	admission   bool
+	capacityTTL time.Duration
+	guard       func(ctx context.Context) (context.Context, bool)
+	ready       Readiness
+
+	// join token theo player (rỗng = tắt)
+	joinKey string
+	joinTTL time.Duration
+	// secret dẫn xuất token callback theo room
+	roomSecret string
+	// reconnect window mặc định cho queue không tự cấu hình
+	reconnectWindow time.Duration
+	// URL prefix được phép làm artifact source khi đăng ký build qua admin API
+	artifactSources []string
 }
 
+// New khởi tạo matchmaker với một region mặc định (svrMgr); dùng SetRegions cho nhiều cụm Nomad
 func New(storeMgr *store.Manager, svrMgr *svrmgr.Manager, executablePath string) *Manager {
 	return &Manager{
 		store:          storeMgr,
-		svr:            svrMgr,
+		regions:        []*region{{Region: Region{Name: DefaultRegion, Svr: svrMgr}}},
 		allocTimeout:   2 * time.Minute,
 		pollInterval:   2 * time.Second,
 		executablePath: executablePath,
+		queues:         map[string]Queue{},
+		admission:      true,
+		capacityTTL:    5 * time.Second,
+		ready:          Readiness{Mode: ReadyCallback, Timeout: 60 * time.Second, ProbePath: "/"},
+	}
+}
+
+// SetAdmissionControl bật/tắt việc giữ ticket khi fleet hết capacity
+func (m *Manager) SetAdmissionControl(enabled bool) { m.admission = enabled }
+
+// SetCapacityTTL đặt thời gian dùng lại snapshot capacity trước khi hỏi lại Nomad
+func (m *Manager) SetCapacityTTL(ttl time.Duration) { m.capacityTTL = ttl }
+
+// SetLeaderGuard chỉ cho RunMatcher/TriggerMatch/TriggerBackfill chạy khi guard trả true (leader election);
+// ghi Redis của matcher dùng ctx guard trả về (mang fencing token). nil = luôn chạy
+func (m *Manager) SetLeaderGuard(guard func(ctx context.Context) (context.Context, bool)) {
+	m.guard = guard
+}
+
+// leading kiểm tra guard; trả ctx mang fencing token để ghi
+func (m *Manager) leading(ctx context.Context) (context.Context, bool) {
+	if m.guard == nil {
+		return ctx, true
+	}
+	return m.guard(ctx)
+}
+
+// TriggerMatch ghép ngay queue ở nền nếu agent là leader; follower chỉ enqueue, để vòng matcher của leader ghép
+func (m *Manager) TriggerMatch(queueName string) {
+	ctx, ok := m.leading(context.Background())
+	if !ok {
+		return
+	}
+	go func() { _, _ = m.TryMatch(ctx, queueName) }()
+}
+
+// TriggerBackfill lấp backfill của queue ở nền nếu agent là leader (như TriggerMatch)
+func (m *Manager) TriggerBackfill(queueName string) {
+	ctx, ok := m.leading(context.Background())
+	if !ok {
+		return
+	}
+	go func() { _, _ = m.TryBackfill(ctx, queueName) }()
+}
+
+// QueueNames trả tên các queue đang phục vụ (luôn gồm default)
+func (m *Manager) QueueNames() []string {
+	names := []string{store.DefaultQueue}
+	for name := range m.queues {
+		if name != store.DefaultQueue {
+			names = append(names, name)
+		}
 	}
+	return names
 }
 
-// SubmitJoinTicket: tạo ticket OPENED cho player
-func (m *Manager) SubmitJoinTicket(ctx context.Context, playerID string) (*store.Ticket, error) {
-	return m.store.CreateTicket(ctx, playerID)
+// RunMatcher chạy vòng ghép định kỳ cho mọi queue (để xử lý ticket bị giữ khi hết capacity); dừng khi ctx.Done()
+func (m *Manager) RunMatcher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fenced, ok := m.leading(ctx)
+			if !ok {
+				continue
+			}
+			// ready check quá hạn: trả player đã accept về queue trước khi ghép tiếp
+			m.ExpireProposals(fenced)
+			for _, name := range m.QueueNames() {
+				// lấp room đang chạy trước khi mở room mới
+				_, _ = m.TryBackfill(fenced, name)
+				// ghép hết các cặp đang chờ cho tới khi hết ticket hoặc hết capacity
+				for {
+					if _, err := m.TryMatch(fenced, name); err != nil {
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// SetQueues đăng ký các queue hợp lệ; CPU/MemoryMB = 0 sẽ lấy theo queue mặc định
+func (m *Manager) SetQueues(queues []Queue) {
+	m.queues = map[string]Queue{}
+	for _, q := range queues {
+		if q.Name == "" {
+			continue
+		}
+		if q.CPU <= 0 {
+			q.CPU = defaultQueue.CPU
+		}
+		if q.MemoryMB <= 0 {
+			q.MemoryMB = defaultQueue.MemoryMB
+		}
+		m.queues[q.Name] = q
+	}
+}
+
+// queue trả cấu hình của queue theo tên; ok=false nếu queue không tồn tại
+func (m *Manager) queue(name string) (Queue, bool) {
+	if name == "" {
+		name = store.DefaultQueue
+	}
+	if q, ok := m.queues[name]; ok {
+		return q, true
+	}
+	if name == store.DefaultQueue {
+		return defaultQueue, true
+	}
+	return Queue{}, false
+}
+
+// TicketRequest dữ liệu client gửi khi join
+type TicketRequest struct {
+	PlayerID   string
+	Queue      string            // rỗng → default
+	Regions    []string          // region chấp nhận được; rỗng → mọi region
+	Latencies  map[string]int    // region → latency (ms) client tự đo, dùng để chọn region
+	Attributes map[string]string // dữ liệu của player chuyển cho server qua assignment
+}
+
+// SubmitJoinTicket: tạo ticket OPENED cho player trong queue
+func (m *Manager) SubmitJoinTicket(ctx context.Context, req TicketRequest) (*store.Ticket, error) {
+	if _, ok := m.queue(req.Queue); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQueue, req.Queue)
+	}
+	for _, name := range req.Regions {
+		if m.region(name) == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRegion, name)
+		}
+	}
+	if err := m.checkPenalty(ctx, req.PlayerID); err != nil {
+		return nil, err
+	}
+	return m.store.CreateTicket(ctx, store.Ticket{PlayerID: req.PlayerID, Queue: req.Queue, Regions: req.Regions, Latencies: req.Latencies, Attributes: req.Attributes})
 }
 
 // GetTicket: trả ticket theo id
@@ -43,44 +229,125 @@ func (m *Manager) CancelTicket(ctx context.Context, ticketID string) error {
 	return m.store.CancelTicket(ctx, ticketID)
 }
 
-// TryMatch: ghép 2 ticket và tạo room OPENED, allocate server async
-func (m *Manager) TryMatch(ctx context.Context) (*store.RoomState, error) {
-	t1, t2, err := m.store.TryMatchPair(ctx)
+// TryMatch: ghép 2 ticket cùng queue có region chung, chọn region và tạo room OPENED, allocate server async.
+// Queue bật ready check → tạo proposal thay vì room, trả room nil.
+func (m *Manager) TryMatch(ctx context.Context, queueName string) (*store.RoomState, error) {
+	q, ok := m.queue(queueName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQueue, queueName)
+	}
+	// Chỉ ghép khi còn đủ 2 ticket, tránh giữ chỗ capacity vô ích
+	if n, err := m.store.CountOpenedTickets(ctx, q.Name); err != nil || n < 2 {
+		return nil, fmt.Errorf("not enough tickets in queue %s", q.Name)
+	}
+	tickets, err := m.store.ListOpenedTicketsInQueue(ctx, q.Name)
 	if err != nil {
 		return nil, err
 	}
+	t1, t2, candidates, found := m.pickPair(tickets)
+	if !found {
+		return nil, fmt.Errorf("no compatible pair in queue %s", q.Name)
+	}
+	// region tốt nhất còn capacity cho resource profile của queue
+	var chosen *region
+	for _, r := range candidates {
+		if m.admit(r, q) {
+			chosen = r
+			break
+		}
+	}
+	if chosen == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoCapacity, q.Name)
+	}
+	if err := m.store.TakeTickets(ctx, q.Name, t1.TicketID, t2.TicketID); err != nil {
+		return nil, err
+	}
+	if q.ReadyCheck > 0 {
+		// chờ player accept (POST /tickets/:id/accept); room được tạo khi proposal ACCEPTED
+		return nil, m.propose(ctx, q, chosen, t1, t2)
+	}
 	roomID := uuid.New().String()
-	players := []string{t1.PlayerID, t2.PlayerID}
+	st, err := m.openRoom(ctx, q, chosen, roomID, "", t1, t2)
+	if err != nil {
+		// không lưu được room (mất lease giữa chừng, lỗi Redis) → trả ticket về queue
+		_ = m.store.RequeueTickets(context.Background(), q.Name, t1.TicketID, t2.TicketID)
+		return nil, err
+	}
 	// mark matched
 	_ = m.store.MarkMatched(ctx, t1.TicketID, roomID)
 	_ = m.store.MarkMatched(ctx, t2.TicketID, roomID)
+	return st, nil
+}
+
+// openRoom lưu room OPENED (assignment từ tickets) và allocate server async trong region đã chọn;
+// dùng chung cho ghép ngẫu nhiên và private room (lobbyCode != ""). Lỗi lưu room (vd. store.ErrFenced) → không allocate.
+func (m *Manager) openRoom(ctx context.Context, q Queue, chosen *region, roomID, lobbyCode string, tickets ...store.Ticket) (*store.RoomState, error) {
+	regionName := chosen.Name
+	svr := chosen.Svr
+	players := make([]string, 0, len(tickets))
+	for _, t := range tickets {
+		players = append(players, t.PlayerID)
+	}
+	// chọn build theo rollout của queue (không có rollout → executablePath)
+	command := m.executablePath
+	if q.Command != "" {
+		command = q.Command
+	}
+	artifact := q.Artifact
+	buildVersion, rolloutID := "", ""
+	if b, rid, ok := m.pickBuild(ctx, q.Name); ok {
+		command = b.Command
+		buildVersion, rolloutID = b.Version, rid
+		artifact = nil
+		if b.Artifact != nil {
+			a := svrmgr.Artifact(*b.Artifact)
+			artifact = &a
+		}
+	}
 	// save OPENED room
 	createdAt := time.Now().Unix()
-	_ = m.store.SaveRoomState(ctx, store.RoomState{RoomID: roomID, Players: players, CreatedAt: createdAt, Status: "OPENED"})
+	if q.ReconnectWindow <= 0 {
+		q.ReconnectWindow = m.reconnectWindow
+	}
+	assignment := buildAssignment(q, tickets...)
+	if err := m.store.SaveRoomState(ctx, store.RoomState{RoomID: roomID, Players: players, Queue: q.Name, Region: regionName, BuildVersion: buildVersion, RolloutID: rolloutID, CreatedAt: createdAt, Status: "OPENED", Assignment: assignment, LobbyCode: lobbyCode}); err != nil {
+		return nil, err
+	}
 	// allocate async
-	go func(rid string, plist []string, created int64) {
-		// allocate job với command mới
-		command := m.executablePath
+	go func(rid string) {
 		// command := "/usr/local/bin/tanknarok/TanknarokServer"
-		//args := []string{"-port", "${NOMAD_PORT_http}", "-serverId", rid, "-token", "1234abcd", "-nographics", "-batchmode", "-agentUrl", "https://agent.zensoftstudio.com"}
 		args := []string{
 			"-serverId", rid,
-			"-token", "1234abcd",
+			"-token", m.RoomToken(rid),
 			"-nographics",
 			"-batchmode",
 			"-agentUrl", "https://agent.zensoftstudio.com",
 			"-serverPort", "${NOMAD_PORT_http}",
 		}
 
-		if err := m.svr.RunGameServerV2(rid, 400, 400, command, args); err != nil {
-			// Plan có thể fail ở đây → DEAD ngay với lý do
-			_ = m.store.SaveRoomState(context.Background(), store.RoomState{RoomID: rid, Players: plist, CreatedAt: created, Status: "DEAD", FailReason: err.Error()})
+		tpl := svrmgr.JobTemplate{
+			Command:   command,
+			Args:      args,
+			CPU:       q.CPU,
+			MemoryMB:  q.MemoryMB,
+			DiskMB:    q.DiskMB,
+			Placement: q.Placement,
+			Meta:      map[string]string{"queue": q.Name, "region": regionName, "build_version": buildVersion},
+			Env:       m.jobEnv(rid),
+			Token:     m.RoomToken(rid),
+		}
+		if artifact != nil {
+			tpl.Artifacts = []svrmgr.Artifact{*artifact}
+		}
+		if err := svr.RunGameServerTemplate(rid, tpl); err != nil {
+			// Plan có thể fail ở đây (thiếu tài nguyên hoặc constraint không khớp) → DEAD ngay với lý do
+			_ = m.failOpened(rid, err.Error())
 			return
 		}
 		// double-check allocation readiness within allocTimeout
 		deadline := time.Now().Add(m.allocTimeout)
 		for time.Now().Before(deadline) {
-			info, e := m.svr.GetRoomInfo(rid)
+			info, e := svr.GetRoomInfo(rid)
 			if e == nil && info != nil && info.HostIP != "" && len(info.Ports) > 0 {
 				// choose port
 				port := 0
@@ -95,52 +362,51 @@ func (m *Manager) TryMatch(ctx context.Context) (*store.RoomState, error) {
 					}
 				}
 				if port > 0 {
-					// Trước khi ACTIVED, enforce uniqueness: không cho phép player nằm ở 2 ACTIVED rooms
-					conflict := false
-					if ids, lerr := m.store.ListRooms(context.Background()); lerr == nil {
-						for _, oid := range ids {
-							if oid == rid {
-								continue
-							}
-							if ost, ge := m.store.GetRoomState(context.Background(), oid); ge == nil && ost != nil && ost.Status == "ACTIVED" {
-								for _, op := range ost.Players {
-									for _, np := range plist {
-										if op == np {
-											conflict = true
-											break
-										}
-									}
-								}
-							}
-						}
+					// Có địa chỉ: room vẫn OPENED, chờ server ready (callback/probe) mới ACTIVED
+					if _, err := m.store.TransitionRoom(context.Background(), rid, "OPENED", func(s *store.RoomState) {
+						s.AllocationID = info.AllocationID
+						s.ServerIP = info.HostIP
+						s.ServerHost = info.Hostname
+						s.Port = port
+						s.AllocatedAt = time.Now().Unix()
+					}); err != nil {
+						return // room đã bị DEAD (cron) hoặc key hết hạn
 					}
-					if conflict {
-						// Đánh dấu phòng mới DEAD để tránh trùng player
-						_ = m.store.SaveRoomState(context.Background(), store.RoomState{RoomID: rid, Players: plist, CreatedAt: created, Status: "DEAD", FailReason: "duplicate_player_active"})
-						_ = m.svr.DeregisterJob(rid, false)
-						return
-					}
-					// Server is ready when Nomad job is running and we have IP/port
-					_ = m.store.SaveRoomState(context.Background(), store.RoomState{
-						RoomID:       rid,
-						AllocationID: info.AllocationID,
-						ServerIP:     info.HostIP,
-						Port:         port,
-						Players:      plist,
-						CreatedAt:    created,
-						Status:       "ACTIVED",
-					})
+					m.awaitReady(rid, svr)
 					return
 				}
 			}
 			time.Sleep(m.pollInterval)
 		}
-		// timeout → DEAD và dừng job (không purge để có thể inspect sau)
-		_ = m.store.SaveRoomState(context.Background(), store.RoomState{RoomID: rid, Players: plist, CreatedAt: created, Status: "DEAD", FailReason: "alloc_timeout"})
-		_ = m.svr.DeregisterJob(rid, false)
-	}(roomID, players, createdAt)
+		// timeout → DEAD và dừng job (không purge để có thể inspect sau); room đã đổi status thì để nguyên
+		if err := m.failOpened(rid, "alloc_timeout"); err == nil || store.IsNotFound(err) {
+			_ = svr.DeregisterJob(rid, false)
+		}
+	}(roomID)
 
-	return &store.RoomState{RoomID: roomID, Players: players, CreatedAt: createdAt, Status: "OPENED"}, nil
+	return &store.RoomState{RoomID: roomID, Players: players, Queue: q.Name, Region: regionName, BuildVersion: buildVersion, RolloutID: rolloutID, CreatedAt: createdAt, Status: "OPENED", Assignment: assignment, LobbyCode: lobbyCode}, nil
 }
 
-// probeReady function removed - we trust Nomad job status instead
+// failOpened chuyển room OPENED → DEAD(reason) bằng CAS, giữ assignment/telemetry của room;
+// room đã rời OPENED (ready → ACTIVED, shutdown, cron) → store.ErrRoomStatusChanged, không ghi đè
+func (m *Manager) failOpened(rid, reason string) error {
+	now := time.Now().Unix()
+	_, err := m.store.TransitionRoom(context.Background(), rid, "OPENED", func(s *store.RoomState) {
+		s.Status, s.FailReason, s.DeadAt = "DEAD", reason, now
+	})
+	return err
+}
+
+// buildAssignment chia player vào team theo thứ tự ghép và gắn properties của queue
+func buildAssignment(q Queue, tickets ...store.Ticket) *store.RoomAssignment {
+	a := &store.RoomAssignment{Teams: map[string][]string{}, Properties: q.Properties, ReconnectWindowSeconds: int(q.ReconnectWindow / time.Second)}
+	for i, t := range tickets {
+		team := fmt.Sprintf("team_%d", i+1)
+		if len(q.Teams) > 0 {
+			team = q.Teams[i%len(q.Teams)]
+		}
+		a.Players = append(a.Players, store.PlayerAssignment{PlayerID: t.PlayerID, TicketID: t.TicketID, Team: team, Attributes: t.Attributes})
+		a.Teams[team] = append(a.Teams[team], t.PlayerID)
+	}
+	return a
+}
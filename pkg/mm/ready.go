@@ -0,0 +1,182 @@
+package mm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"hive/pkg/store"
+	"hive/pkg/svrmgr"
+)
+
+// Cách agent xác định server đã sẵn sàng trước khi chuyển room OPENED → ACTIVED
+const (
+	ReadyCallback = "callback" // server gọi svrsdk Ready() → POST /rooms/:room_id/ready
+	ReadyTCP      = "tcp"      // agent TCP connect tới server_ip:port
+	ReadyHTTP     = "http"     // agent GET http://server_ip:port<ProbePath> trả 2xx
+	ReadyNone     = "none"     // ACTIVED ngay khi Nomad chạy + có port (hành vi cũ)
+)
+
+// ErrInvalidReadyMode trả về khi mode readiness không hợp lệ
+var ErrInvalidReadyMode = errors.New("invalid ready mode")
+
+// Readiness cấu hình bước chờ server ready sau khi có allocation
+type Readiness struct {
+	Mode      string
+	Timeout   time.Duration // quá hạn mà chưa ready → DEAD(ready_timeout)
+	ProbePath string        // chỉ dùng cho mode http
+}
+
+// SetReadiness cấu hình readiness; mode rỗng = callback
+func (m *Manager) SetReadiness(r Readiness) error {
+	switch r.Mode {
+	case "":
+		r.Mode = ReadyCallback
+	case ReadyCallback, ReadyTCP, ReadyHTTP, ReadyNone:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidReadyMode, r.Mode)
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = 60 * time.Second
+	}
+	if r.ProbePath == "" {
+		r.ProbePath = "/"
+	}
+	m.ready = r
+	return nil
+}
+
+// MarkReady xử lý callback ready của server: ghi ready_at; nếu allocation đã có địa chỉ thì ACTIVED ngay,
+// chưa có thì vòng allocate sẽ ACTIVED khi thấy địa chỉ. Gọi lại khi đã ACTIVED là idempotent.
+func (m *Manager) MarkReady(ctx context.Context, roomID string) (*store.RoomState, error) {
+	now := time.Now().Unix()
+	st, err := m.store.TransitionRoom(ctx, roomID, "OPENED", func(s *store.RoomState) {
+		if s.ReadyAt == 0 {
+			s.ReadyAt = now
+		}
+	})
+	if errors.Is(err, store.ErrRoomStatusChanged) && st.Status == "ACTIVED" {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if st.Port == 0 {
+		return st, nil
+	}
+	return m.activate(ctx, roomID)
+}
+
+// awaitReady chờ server ready sau khi room đã có địa chỉ; hết Timeout → DEAD(ready_timeout) và dừng job
+func (m *Manager) awaitReady(rid string, svr *svrmgr.Manager) {
+	ctx := context.Background()
+	deadline := time.Now().Add(m.ready.Timeout)
+	for {
+		st, err := m.store.GetRoomState(ctx, rid)
+		if err != nil || st.Status != "OPENED" {
+			return // key hết hạn, đã ACTIVED bởi callback hoặc bị DEAD
+		}
+		ready := st.ReadyAt > 0
+		if !ready {
+			switch m.ready.Mode {
+			case ReadyNone:
+				ready = true
+			case ReadyTCP, ReadyHTTP:
+				ready = probeReady(m.ready, st.ServerIP, st.Port)
+			}
+		}
+		if ready {
+			_, _ = m.activate(ctx, rid)
+			return
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(m.pollInterval)
+	}
+	if err := m.failOpened(rid, "ready_timeout"); err == nil {
+		_ = svr.DeregisterJob(rid, false)
+	}
+}
+
+// activate chuyển OPENED → ACTIVED; player đã ở room ACTIVED khác → DEAD(duplicate_player_active)
+func (m *Manager) activate(ctx context.Context, rid string) (*store.RoomState, error) {
+	cur, err := m.store.GetRoomState(ctx, rid)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if m.playerConflict(ctx, rid, cur.Players) {
+		st, err := m.store.TransitionRoom(ctx, rid, "OPENED", func(s *store.RoomState) {
+			s.Status, s.FailReason, s.DeadAt = "DEAD", "duplicate_player_active", now
+		})
+		if err == nil {
+			if r := m.region(st.Region); r != nil {
+				_ = r.Svr.DeregisterJob(rid, false)
+			}
+		}
+		return st, err
+	}
+	st, err := m.store.TransitionRoom(ctx, rid, "OPENED", func(s *store.RoomState) {
+		s.Status = "ACTIVED"
+		if s.ReadyAt == 0 {
+			s.ReadyAt = now
+		}
+	})
+	if errors.Is(err, store.ErrRoomStatusChanged) && st.Status == "ACTIVED" {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// playerConflict: có player của room đang ở một room ACTIVED khác
+func (m *Manager) playerConflict(ctx context.Context, rid string, players []string) bool {
+	ids, err := m.store.ListRooms(ctx)
+	if err != nil {
+		return false
+	}
+	for _, oid := range ids {
+		if oid == rid {
+			continue
+		}
+		ost, err := m.store.GetRoomState(ctx, oid)
+		if err != nil || ost == nil || ost.Status != "ACTIVED" {
+			continue
+		}
+		for _, op := range ost.Players {
+			if contains(players, op) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// probeReady kiểm tra server bằng TCP connect hoặc HTTP GET (timeout ngắn)
+func probeReady(r Readiness, host string, port int) bool {
+	if host == "" || port == 0 {
+		return false
+	}
+	addr := net.JoinHostPort(host, fmt.Sprint(port))
+	if r.Mode == ReadyTCP {
+		conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}
+	hc := &http.Client{Timeout: 2 * time.Second}
+	resp, err := hc.Get("http://" + addr + r.ProbePath)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
@@ -0,0 +1,145 @@
+package mm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"hive/pkg/store"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotProposed ticket không ở trạng thái PROPOSED (queue không bật ready check, đã trả lời xong hoặc hết hạn)
+var ErrNotProposed = errors.New("ticket is not proposed")
+
+// ErrDeclinePenalty player vừa decline/bỏ lỡ ready check, chưa được vào queue lại
+var ErrDeclinePenalty = errors.New("decline penalty active")
+
+// defaultDeclinePenalty phạt mặc định khi queue bật ready check mà không đặt DeclinePenalty
+const defaultDeclinePenalty = 30 * time.Second
+
+// propose tạo proposal cho các ticket đã gỡ khỏi queue; trận chỉ allocate khi mọi player accept trước deadline
+func (m *Manager) propose(ctx context.Context, q Queue, chosen *region, tickets ...store.Ticket) error {
+	_, err := m.store.CreateProposal(ctx, q.Name, chosen.Name, tickets, time.Now().Add(q.ReadyCheck))
+	if err != nil {
+		ids := make([]string, 0, len(tickets))
+		for _, t := range tickets {
+			ids = append(ids, t.TicketID)
+		}
+		_ = m.store.ReturnTickets(ctx, q.Name, ids...)
+	}
+	return err
+}
+
+// AcceptTicket player accept trận được đề xuất; ticket cuối cùng accept → allocate room như TryMatch
+func (m *Manager) AcceptTicket(ctx context.Context, ticketID string) (*store.Proposal, error) {
+	return m.respond(ctx, ticketID, true)
+}
+
+// DeclineTicket player từ chối trận: player khác về đầu queue, người decline bị phạt
+func (m *Manager) DeclineTicket(ctx context.Context, ticketID string) (*store.Proposal, error) {
+	return m.respond(ctx, ticketID, false)
+}
+
+func (m *Manager) respond(ctx context.Context, ticketID string, accept bool) (*store.Proposal, error) {
+	t, err := m.store.GetTicket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != "PROPOSED" || t.ProposalID == "" {
+		return nil, fmt.Errorf("%w: status=%s", ErrNotProposed, t.Status)
+	}
+	p, err := m.store.RespondProposal(ctx, t.ProposalID, ticketID, accept)
+	if errors.Is(err, store.ErrProposalClosed) {
+		return p, fmt.Errorf("%w: proposal %s", ErrNotProposed, p.Status)
+	}
+	if err != nil {
+		return p, err
+	}
+	m.resolveProposal(ctx, p)
+	return p, nil
+}
+
+// ExpireProposals đóng các proposal quá deadline (gọi trong RunMatcher); trả số proposal đã hết hạn
+func (m *Manager) ExpireProposals(ctx context.Context) int {
+	ids, err := m.store.ListPendingProposals(ctx)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	now := time.Now()
+	for _, id := range ids {
+		p, expired, err := m.store.ExpireProposal(ctx, id, now)
+		if err != nil || !expired {
+			continue
+		}
+		m.resolveProposal(ctx, p)
+		n++
+	}
+	return n
+}
+
+// resolveProposal xử lý proposal vừa rời PENDING (đúng một lần, do caller thắng WATCH):
+// ACCEPTED → tạo room và allocate; DECLINED/EXPIRED → player đã accept (và chưa trả lời khi có người decline)
+// về đầu queue, người decline hoặc không trả lời kịp bị phạt
+func (m *Manager) resolveProposal(ctx context.Context, p *store.Proposal) {
+	q, ok := m.queue(p.Queue)
+	if !ok {
+		q = defaultQueue
+	}
+	switch p.Status {
+	case "ACCEPTED":
+		tickets := make([]store.Ticket, 0, len(p.Tickets))
+		for _, pt := range p.Tickets {
+			t, err := m.store.GetTicket(ctx, pt.TicketID)
+			if err != nil {
+				t = &store.Ticket{TicketID: pt.TicketID, PlayerID: pt.PlayerID, Queue: p.Queue}
+			}
+			tickets = append(tickets, *t)
+		}
+		chosen := m.region(p.Region)
+		if chosen == nil {
+			chosen = m.regions[0]
+		}
+		roomID := uuid.New().String()
+		if _, err := m.openRoom(ctx, q, chosen, roomID, "", tickets...); err != nil {
+			// không lưu được room (mất lease, lỗi Redis) → ticket về đầu queue như khi proposal hết hạn
+			ids := make([]string, 0, len(tickets))
+			for _, t := range tickets {
+				ids = append(ids, t.TicketID)
+			}
+			_ = m.store.ReturnTickets(context.Background(), p.Queue, ids...)
+			return
+		}
+		_ = m.store.SetProposalRoom(ctx, p, roomID)
+		for _, t := range tickets {
+			_ = m.store.MarkMatched(ctx, t.TicketID, roomID)
+		}
+	case "DECLINED", "EXPIRED":
+		penalty := q.DeclinePenalty
+		if penalty <= 0 {
+			penalty = defaultDeclinePenalty
+		}
+		back := []string{}
+		for _, pt := range p.Tickets {
+			switch {
+			case pt.Response == store.ProposalAccepted, pt.Response == "" && p.Status == "DECLINED":
+				back = append(back, pt.TicketID)
+			default:
+				_ = m.store.DeclineTicket(ctx, pt.TicketID, penalty)
+			}
+		}
+		_ = m.store.ReturnTickets(ctx, p.Queue, back...)
+	}
+}
+
+// checkPenalty trả ErrDeclinePenalty khi player còn bị phạt
+func (m *Manager) checkPenalty(ctx context.Context, playerID string) error {
+	d, err := m.store.PlayerPenalty(ctx, playerID)
+	if err != nil || d <= 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: retry in %ds", ErrDeclinePenalty, int(d.Round(time.Second)/time.Second))
+}
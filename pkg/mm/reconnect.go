@@ -0,0 +1,43 @@
+package mm
+
+import (
+	"time"
+
+	"hive/pkg/jointoken"
+	"hive/pkg/store"
+)
+
+// SetReconnectWindow đặt reconnect window mặc định cho queue không cấu hình riêng (0 = không cho reconnect)
+func (m *Manager) SetReconnectWindow(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	m.reconnectWindow = d
+}
+
+// ReconnectToken cấp join token mới cho player của room ACTIVED (reconnect không đi qua ticket); rỗng khi chưa bật
+func (m *Manager) ReconnectToken(st *store.RoomState, playerID string) (string, int64) {
+	if m.joinKey == "" || st == nil || st.Status != "ACTIVED" || !contains(st.Players, playerID) {
+		return "", 0
+	}
+	return jointoken.Issue([]byte(m.joinKey), st.RoomID, playerID, m.joinTTL, time.Now())
+}
+
+// AuthenticatePlayer xác thực player bằng join token agent đã cấp cho đúng player và room.
+// Token hết hạn chỉ còn được nhận trong reconnect window của room (client rớt mạng lâu hơn JOIN_TOKEN_TTL);
+// cũ hơn → false, token lộ không đổi được token mới mãi. false khi chưa bật join token.
+func (m *Manager) AuthenticatePlayer(st *store.RoomState, playerID, token string, now time.Time) bool {
+	if m.joinKey == "" || st == nil || token == "" {
+		return false
+	}
+	c, err := jointoken.VerifyWithin([]byte(m.joinKey), token, now, m.roomReconnectWindow(st))
+	return err == nil && c.RoomID == st.RoomID && c.PlayerID == playerID
+}
+
+// roomReconnectWindow reconnect window của room (theo assignment của queue, mặc định SetReconnectWindow)
+func (m *Manager) roomReconnectWindow(st *store.RoomState) time.Duration {
+	if st.Assignment != nil && st.Assignment.ReconnectWindowSeconds > 0 {
+		return time.Duration(st.Assignment.ReconnectWindowSeconds) * time.Second
+	}
+	return m.reconnectWindow
+}
@@ -0,0 +1,52 @@
+package mm
+
+import (
+	"testing"
+	"time"
+
+	"hive/pkg/jointoken"
+	"hive/pkg/store"
+)
+
+func TestAuthenticatePlayer(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+	issued := time.Unix(1_700_000_000, 0)
+	tok, exp := jointoken.Issue([]byte(key), "r1", "p1", time.Minute, issued)
+	expAt := time.Unix(exp, 0)
+	room := &store.RoomState{RoomID: "r1", Status: "ACTIVED", Players: []string{"p1", "p2"}}
+	withWindow := &store.RoomState{RoomID: "r1", Status: "ACTIVED", Assignment: &store.RoomAssignment{ReconnectWindowSeconds: 300}}
+
+	tests := []struct {
+		name     string
+		joinKey  string
+		st       *store.RoomState
+		playerID string
+		token    string
+		at       time.Time
+		want     bool
+	}{
+		{name: "fresh token", joinKey: key, st: room, playerID: "p1", token: tok, at: issued, want: true},
+		{name: "expired within default window", joinKey: key, st: room, playerID: "p1", token: tok, at: expAt.Add(60 * time.Second), want: true},
+		{name: "expired past default window", joinKey: key, st: room, playerID: "p1", token: tok, at: expAt.Add(61 * time.Second)},
+		{name: "queue window from assignment", joinKey: key, st: withWindow, playerID: "p1", token: tok, at: expAt.Add(5 * time.Minute), want: true},
+		{name: "past queue window", joinKey: key, st: withWindow, playerID: "p1", token: tok, at: expAt.Add(5*time.Minute + time.Second)},
+		{name: "other player", joinKey: key, st: room, playerID: "p2", token: tok, at: issued},
+		{name: "other room", joinKey: key, st: &store.RoomState{RoomID: "r2"}, playerID: "p1", token: tok, at: issued},
+		{name: "bad signature", joinKey: key, st: room, playerID: "p1", token: tok + "x", at: issued},
+		{name: "no token", joinKey: key, st: room, playerID: "p1", at: issued},
+		{name: "join tokens disabled", st: room, playerID: "p1", token: tok, at: issued},
+		{name: "no room", joinKey: key, playerID: "p1", token: tok, at: issued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(nil, nil, "")
+			m.SetReconnectWindow(time.Minute)
+			if tt.joinKey != "" {
+				m.SetJoinTokens(tt.joinKey, time.Minute)
+			}
+			if got := m.AuthenticatePlayer(tt.st, tt.playerID, tt.token, tt.at); got != tt.want {
+				t.Fatalf("AuthenticatePlayer = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
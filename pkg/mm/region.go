@@ -0,0 +1,155 @@
+package mm
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"hive/pkg/store"
+	"hive/pkg/svrmgr"
+)
+
+// DefaultRegion tên region khi matchmaker chỉ có một cụm Nomad
+const DefaultRegion = "default"
+
+// ErrUnknownRegion trả về khi ticket khai báo region không tồn tại
+var ErrUnknownRegion = errors.New("unknown region")
+
+// Region một cụm Nomad (svrmgr riêng) mà matchmaker có thể allocate room vào
+type Region struct {
+	Name string
+	Svr  *svrmgr.Manager
+}
+
+// region giữ thêm snapshot capacity phục vụ admission
+type region struct {
+	Region
+	mu         sync.Mutex
+	capacity   *svrmgr.FleetCapacity
+	capacityAt time.Time
+}
+
+// SetRegions thay danh sách region; region đầu tiên là region mặc định
+func (m *Manager) SetRegions(regions []Region) {
+	list := make([]*region, 0, len(regions))
+	for _, r := range regions {
+		if r.Name == "" || r.Svr == nil {
+			continue
+		}
+		list = append(list, &region{Region: r})
+	}
+	if len(list) == 0 {
+		return
+	}
+	m.regions = list
+}
+
+// ServerManager trả svrmgr của region (rỗng/không tồn tại → region mặc định)
+func (m *Manager) ServerManager(name string) *svrmgr.Manager {
+	if r := m.region(name); r != nil {
+		return r.Svr
+	}
+	return m.regions[0].Svr
+}
+
+// RegionNames trả tên các region theo thứ tự cấu hình
+func (m *Manager) RegionNames() []string {
+	names := make([]string, 0, len(m.regions))
+	for _, r := range m.regions {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func (m *Manager) region(name string) *region {
+	for _, r := range m.regions {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// admit kiểm tra và giữ chỗ tài nguyên cho một room của queue trong region.
+// Lỗi khi đọc capacity → cho qua (Plan vẫn là chốt chặn cuối).
+func (m *Manager) admit(r *region, q Queue) bool {
+	if !m.admission {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.capacity == nil || time.Since(r.capacityAt) > m.capacityTTL {
+		fleet, err := r.Svr.Capacity()
+		if err != nil {
+			return true
+		}
+		r.capacity = fleet
+		r.capacityAt = time.Now()
+	}
+	return r.capacity.Reserve(q.CPU, q.MemoryMB, q.Placement)
+}
+
+// acceptableRegions giao các region mà mọi ticket chấp nhận (ticket không khai báo = mọi region)
+func (m *Manager) acceptableRegions(tickets ...store.Ticket) []*region {
+	out := []*region{}
+	for _, r := range m.regions {
+		ok := true
+		for _, t := range tickets {
+			if len(t.Regions) > 0 && !contains(t.Regions, r.Name) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// rankRegions sắp xếp region theo latency xấu nhất giữa các player (thấp trước).
+// Player không gửi latency cho region thì không tính; region không ai đo được xếp sau, giữ thứ tự cấu hình.
+func rankRegions(regions []*region, tickets ...store.Ticket) []*region {
+	worst := make(map[string]int, len(regions))
+	for _, r := range regions {
+		w := -1
+		for _, t := range tickets {
+			if ms, ok := t.Latencies[r.Name]; ok && ms > w {
+				w = ms
+			}
+		}
+		if w < 0 {
+			w = math.MaxInt
+		}
+		worst[r.Name] = w
+	}
+	out := append([]*region(nil), regions...)
+	sort.SliceStable(out, func(i, j int) bool { return worst[out[i].Name] < worst[out[j].Name] })
+	return out
+}
+
+// pickPair chọn cặp ticket sớm nhất (FIFO) có ít nhất một region chung
+func (m *Manager) pickPair(tickets []store.Ticket) (store.Ticket, store.Ticket, []*region, bool) {
+	for i := 0; i < len(tickets); i++ {
+		for j := i + 1; j < len(tickets); j++ {
+			if tickets[i].PlayerID == tickets[j].PlayerID {
+				continue
+			}
+			if regions := m.acceptableRegions(tickets[i], tickets[j]); len(regions) > 0 {
+				return tickets[i], tickets[j], rankRegions(regions, tickets[i], tickets[j]), true
+			}
+		}
+	}
+	return store.Ticket{}, store.Ticket{}, nil, false
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
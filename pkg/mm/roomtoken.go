@@ -0,0 +1,26 @@
+package mm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SetRoomTokenSecret đặt secret dẫn xuất token callback theo room; các agent dùng chung Redis phải cùng secret
+func (m *Manager) SetRoomTokenSecret(secret string) { m.roomSecret = secret }
+
+// RoomToken token riêng của room = HMAC-SHA256(secret, room_id); server nhận qua job env HIVE_TOKEN / arg -token.
+// Không lưu Redis: agent nào cũng tự tính lại được để xác thực.
+func (m *Manager) RoomToken(roomID string) string {
+	mac := hmac.New(sha256.New, []byte(m.roomSecret))
+	mac.Write([]byte("room:" + roomID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRoomToken token chỉ hợp lệ cho đúng room được cấp
+func (m *Manager) VerifyRoomToken(roomID, token string) bool {
+	if m.roomSecret == "" || roomID == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(m.RoomToken(roomID)))
+}
@@ -0,0 +1,18 @@
+package store
+
+// PlayerAssignment một player được ghép vào room: team và attributes từ ticket
+type PlayerAssignment struct {
+	PlayerID   string            `json:"player_id"`
+	TicketID   string            `json:"-"` // không lưu/trả ra: ai có ticket_id lấy được join token qua GET /tickets/:id
+	Team       string            `json:"team"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// RoomAssignment thông tin server cần khi khởi động: ai được vào, chia team thế nào, cấu hình trận
+type RoomAssignment struct {
+	Players    []PlayerAssignment  `json:"players"`
+	Teams      map[string][]string `json:"teams"`                // team → player_id
+	Properties map[string]string   `json:"properties,omitempty"` // custom match properties của queue
+	// ReconnectWindowSeconds player rớt mạng được quay lại trong bao lâu (0 = không cho reconnect)
+	ReconnectWindowSeconds int `json:"reconnect_window_seconds,omitempty"`
+}
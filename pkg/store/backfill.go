@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrBackfillClosed backfill không còn OPENED (đã đủ, bị huỷ/hết hạn) hoặc room không còn ACTIVED
+var ErrBackfillClosed = errors.New("backfill closed")
+
+// Backfill yêu cầu bổ sung player cho room ACTIVED: matcher lấy ticket OPENED cùng queue lấp Slots chỗ trống
+type Backfill struct {
+	BackfillID string   `json:"backfill_id"`
+	RoomID     string   `json:"room_id"`
+	Queue      string   `json:"queue"`
+	Region     string   `json:"region,omitempty"`
+	Team       string   `json:"team,omitempty"` // rỗng = chia vào team ít người nhất
+	Slots      int      `json:"slots"`          // chỗ còn trống
+	Filled     []string `json:"filled,omitempty"`
+	Status     string   `json:"status"` // OPENED|FILLED|CANCELED
+	CreatedAt  int64    `json:"created_at_unix"`
+	UpdatedAt  int64    `json:"updated_at_unix,omitempty"`
+}
+
+// backfillTTL thời gian backfill OPENED chờ được lấp; set từ config
+var backfillTTL = 120 * time.Second
+
+// SetBackfillTTL sets how long a backfill stays open
+func SetBackfillTTL(ttl time.Duration) { backfillTTL = ttl }
+
+func backfillKey(id string) string      { return "mm:backfill:" + id }
+func backfillsIndexKey(q string) string { return "mm:backfills:" + q } // SET backfill_id theo queue
+
+// CreateBackfill mở backfill cho room ACTIVED (mỗi room một backfill, gọi lại thì thay số slot/team của backfill đang mở)
+func (m *Manager) CreateBackfill(ctx context.Context, roomID string, slots int, team string) (*Backfill, error) {
+	if slots <= 0 {
+		return nil, fmt.Errorf("slots must be > 0")
+	}
+	rkey := roomKey(roomID)
+	var out *Backfill
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		st, err := getRoomTx(ctx, tx, roomID)
+		if err != nil {
+			return err
+		}
+		if st.Status != "ACTIVED" {
+			return ErrRoomNotActive
+		}
+		now := time.Now().Unix()
+		bf := &Backfill{BackfillID: uuid.New().String(), RoomID: roomID, Queue: st.Queue, Region: st.Region, CreatedAt: now}
+		if st.BackfillID != "" {
+			if cur, err := m.GetBackfill(ctx, st.BackfillID); err == nil && cur.Status == "OPENED" {
+				bf = cur
+			}
+		}
+		if bf.Queue == "" {
+			bf.Queue = DefaultQueue
+		}
+		bf.Slots, bf.Team, bf.Status, bf.UpdatedAt = slots, team, "OPENED", now
+		st.BackfillID = bf.BackfillID
+		rb, _ := json.Marshal(st)
+		bb, _ := json.Marshal(bf)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, rkey, string(rb), redis.SetArgs{KeepTTL: true})
+			pipe.Set(ctx, backfillKey(bf.BackfillID), string(bb), backfillTTL)
+			pipe.SAdd(ctx, backfillsIndexKey(bf.Queue), bf.BackfillID)
+			return nil
+		})
+		out = bf
+		return err
+	}, rkey)
+	return out, err
+}
+
+// GetBackfill đọc backfill theo id
+func (m *Manager) GetBackfill(ctx context.Context, id string) (*Backfill, error) {
+	v, err := m.redis.Get(ctx, backfillKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var bf Backfill
+	if err := json.Unmarshal([]byte(v), &bf); err != nil {
+		return nil, err
+	}
+	return &bf, nil
+}
+
+// ListOpenBackfills trả backfill OPENED của queue (cũ trước); id hết hạn được gỡ khỏi index
+func (m *Manager) ListOpenBackfills(ctx context.Context, queue string) ([]Backfill, error) {
+	if queue == "" {
+		queue = DefaultQueue
+	}
+	ids, err := m.redis.SMembers(ctx, backfillsIndexKey(queue)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := []Backfill{}
+	for _, id := range ids {
+		bf, err := m.GetBackfill(ctx, id)
+		if err != nil || bf.Status != "OPENED" {
+			_ = m.redis.SRem(ctx, backfillsIndexKey(queue), id).Err()
+			continue
+		}
+		out = append(out, *bf)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out, nil
+}
+
+// CloseBackfill chuyển backfill sang status (CANCELED) và gỡ khỏi room/index
+func (m *Manager) CloseBackfill(ctx context.Context, id, status string) error {
+	bf, err := m.GetBackfill(ctx, id)
+	if err != nil {
+		return err
+	}
+	bf.Status, bf.UpdatedAt = status, time.Now().Unix()
+	b, _ := json.Marshal(bf)
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, backfillKey(id), string(b), terminalTTL)
+	pipe.SRem(ctx, backfillsIndexKey(bf.Queue), id)
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return err
+	}
+	// gỡ liên kết trên room (nếu vẫn trỏ tới backfill này)
+	rkey := roomKey(bf.RoomID)
+	return m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		st, err := getRoomTx(ctx, tx, bf.RoomID)
+		if err != nil || st.BackfillID != id {
+			return nil
+		}
+		st.BackfillID = ""
+		rb, _ := json.Marshal(st)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, rkey, string(rb), redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		return err
+	}, rkey)
+}
+
+// FillBackfill thêm players vào room trong một transaction (WATCH room + backfill): room phải ACTIVED, backfill OPENED
+// và còn đủ slot. Room.Players và Assignment (players, teams) được cập nhật cùng lúc; hết slot → backfill FILLED.
+func (m *Manager) FillBackfill(ctx context.Context, id string, players []PlayerAssignment) (*RoomState, *Backfill, error) {
+	bkey := backfillKey(id)
+	var outRoom *RoomState
+	var outBf *Backfill
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, bkey).Result()
+		if err != nil {
+			return err
+		}
+		var bf Backfill
+		if err := json.Unmarshal([]byte(v), &bf); err != nil {
+			return err
+		}
+		if bf.Status != "OPENED" || len(players) > bf.Slots {
+			return ErrBackfillClosed
+		}
+		rkey := roomKey(bf.RoomID)
+		if err := tx.Watch(ctx, rkey).Err(); err != nil {
+			return err
+		}
+		st, err := getRoomTx(ctx, tx, bf.RoomID)
+		if err != nil {
+			return err
+		}
+		if st.Status != "ACTIVED" || st.BackfillID != id {
+			return ErrBackfillClosed
+		}
+		if st.Assignment == nil {
+			st.Assignment = &RoomAssignment{Teams: map[string][]string{}}
+		}
+		if st.Assignment.Teams == nil {
+			st.Assignment.Teams = map[string][]string{}
+		}
+		for _, p := range players {
+			for _, cur := range st.Players {
+				if cur == p.PlayerID {
+					return fmt.Errorf("player %s already in room", p.PlayerID)
+				}
+			}
+			st.Players = append(st.Players, p.PlayerID)
+			st.Assignment.Players = append(st.Assignment.Players, p)
+			st.Assignment.Teams[p.Team] = append(st.Assignment.Teams[p.Team], p.PlayerID)
+			bf.Filled = append(bf.Filled, p.PlayerID)
+		}
+		bf.Slots -= len(players)
+		bf.UpdatedAt = time.Now().Unix()
+		var bfTTL time.Duration = redis.KeepTTL
+		if bf.Slots == 0 {
+			bf.Status = "FILLED"
+			st.BackfillID = ""
+			bfTTL = terminalTTL
+		}
+		rb, _ := json.Marshal(st)
+		bb, _ := json.Marshal(bf)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, rkey, string(rb), redis.SetArgs{KeepTTL: true})
+			pipe.Set(ctx, bkey, string(bb), bfTTL)
+			if bf.Status != "OPENED" {
+				pipe.SRem(ctx, backfillsIndexKey(bf.Queue), id)
+			}
+			return nil
+		})
+		outRoom, outBf = st, &bf
+		return err
+	}, bkey)
+	return outRoom, outBf, err
+}
+
+// getRoomTx đọc room state trong transaction WATCH
+func getRoomTx(ctx context.Context, tx *redis.Tx, roomID string) (*RoomState, error) {
+	v, err := tx.Get(ctx, roomKey(roomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var st RoomState
+	if err := json.Unmarshal([]byte(v), &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
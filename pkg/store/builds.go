@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ServerBuild một phiên bản game server đã đăng ký cho queue (game type)
+type ServerBuild struct {
+	Queue     string         `json:"queue"`
+	Version   string         `json:"version"`
+	Command   string         `json:"command"`
+	Artifact  *BuildArtifact `json:"artifact,omitempty"` // nil = binary cài sẵn trên node
+	CreatedAt int64          `json:"created_at_unix"`
+}
+
+// BuildArtifact archive của build được Nomad tải về mỗi allocation (cùng field với svrmgr.Artifact)
+type BuildArtifact struct {
+	Source      string `json:"source"`
+	Checksum    string `json:"checksum"`
+	Destination string `json:"destination,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+}
+
+// Rollout chính sách rollout của queue: build stable + canary nhận CanaryPercent% room mới
+type Rollout struct {
+	Queue          string  `json:"queue"`
+	RolloutID      string  `json:"rollout_id"` // đổi mỗi lần đặt rollout; thống kê build tính riêng theo rollout
+	Stable         string  `json:"stable"`
+	Canary         string  `json:"canary,omitempty"`
+	CanaryPercent  int     `json:"canary_percent"`
+	CrashThreshold float64 `json:"crash_threshold"` // failure rate (0..1) của canary để auto rollback
+	MinRooms       int64   `json:"min_rooms"`       // số room tối thiểu của canary trước khi đánh giá
+	RolledBack     string  `json:"rolled_back,omitempty"`
+	RollbackReason string  `json:"rollback_reason,omitempty"`
+	RolledBackAt   int64   `json:"rolled_back_at_unix,omitempty"`
+	UpdatedAt      int64   `json:"updated_at_unix"`
+}
+
+// BuildStats thống kê room của một build trong một rollout: số room đã allocate và số room DEAD
+// vì lỗi build (BuildFailureReasons: crash, mất heartbeat, không ready)
+type BuildStats struct {
+	Version   string  `json:"version"`
+	RolloutID string  `json:"rollout_id"`
+	Rooms     int64   `json:"rooms"`
+	Failures  int64   `json:"failures"`
+	Rate      float64 `json:"failure_rate"`
+}
+
+// buildStatsTTL giữ thống kê của rollout cũ một thời gian để xem lại, gia hạn mỗi lần có room mới
+const buildStatsTTL = 7 * 24 * time.Hour
+
+func buildsKey(queue string) string  { return "mm:builds:" + queue }
+func rolloutKey(queue string) string { return "mm:rollout:" + queue }
+
+// buildStatsKey SET room_id theo build + rollout (kind: rooms|failed); SET nên ghi lại cùng room không đếm trùng
+func buildStatsKey(queue, version, rolloutID, kind string) string {
+	return "mm:buildstats:" + queue + ":" + version + ":" + rolloutID + ":" + kind
+}
+
+// SaveBuild đăng ký (hoặc ghi đè) một build của queue
+func (m *Manager) SaveBuild(ctx context.Context, b ServerBuild) error {
+	raw, _ := json.Marshal(b)
+	return m.redis.HSet(ctx, buildsKey(b.Queue), b.Version, string(raw)).Err()
+}
+
+// GetBuild trả build theo version
+func (m *Manager) GetBuild(ctx context.Context, queue, version string) (*ServerBuild, error) {
+	v, err := m.redis.HGet(ctx, buildsKey(queue), version).Result()
+	if err != nil {
+		return nil, fmt.Errorf("build %s/%s not found: %w", queue, version, err)
+	}
+	var b ServerBuild
+	if err := json.Unmarshal([]byte(v), &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBuilds trả các build của queue theo thời gian đăng ký
+func (m *Manager) ListBuilds(ctx context.Context, queue string) ([]ServerBuild, error) {
+	all, err := m.redis.HGetAll(ctx, buildsKey(queue)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ServerBuild, 0, len(all))
+	for _, v := range all {
+		var b ServerBuild
+		if json.Unmarshal([]byte(v), &b) == nil {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out, nil
+}
+
+// SaveRollout lưu chính sách rollout của queue
+func (m *Manager) SaveRollout(ctx context.Context, r Rollout) error {
+	raw, _ := json.Marshal(r)
+	return m.redis.Set(ctx, rolloutKey(r.Queue), string(raw), 0).Err()
+}
+
+// GetRollout trả rollout của queue (redis.Nil nếu chưa cấu hình)
+func (m *Manager) GetRollout(ctx context.Context, queue string) (*Rollout, error) {
+	v, err := m.redis.Get(ctx, rolloutKey(queue)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var r Rollout
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		return nil, err
+	}
+	if r.RolloutID == "" {
+		r.RolloutID = strconv.FormatInt(r.UpdatedAt, 10) // rollout lưu trước khi có rollout_id
+	}
+	return &r, nil
+}
+
+// BuildFailureReasons các fail_reason do chính game server (build) gây ra; chỉ room DEAD với các lý do này
+// tính là failure của canary. DEAD vì hạ tầng (plan bị từ chối, alloc_timeout, duplicate_player_active...)
+// không làm rollback build.
+var BuildFailureReasons = []string{"server_crash", "heartbeat_lost", "ready_timeout"}
+
+// IsBuildFailure cho biết room DEAD vì lỗi của build đang chạy
+func IsBuildFailure(st *RoomState) bool {
+	return st.Status == "DEAD" && slices.Contains(BuildFailureReasons, st.FailReason)
+}
+
+// recordBuildOutcome ghi room vào thống kê build của rollout trong cùng pipeline với lần ghi room:
+// room mới (OPENED) tính vào rooms, room DEAD vì lỗi build (IsBuildFailure) tính vào failed.
+// Room không thuộc rollout thì bỏ qua.
+func recordBuildOutcome(ctx context.Context, pipe redis.Pipeliner, st *RoomState) {
+	if st.BuildVersion == "" || st.RolloutID == "" {
+		return
+	}
+	rooms := buildStatsKey(st.Queue, st.BuildVersion, st.RolloutID, "rooms")
+	pipe.SAdd(ctx, rooms, st.RoomID)
+	pipe.Expire(ctx, rooms, buildStatsTTL)
+	if IsBuildFailure(st) {
+		failed := buildStatsKey(st.Queue, st.BuildVersion, st.RolloutID, "failed")
+		pipe.SAdd(ctx, failed, st.RoomID)
+		pipe.Expire(ctx, failed, buildStatsTTL)
+	}
+}
+
+// GetBuildStats trả thống kê room/failure của build trong rollout
+func (m *Manager) GetBuildStats(ctx context.Context, queue, version, rolloutID string) (BuildStats, error) {
+	st := BuildStats{Version: version, RolloutID: rolloutID}
+	pipe := m.redis.Pipeline()
+	rooms := pipe.SCard(ctx, buildStatsKey(queue, version, rolloutID, "rooms"))
+	failed := pipe.SCard(ctx, buildStatsKey(queue, version, rolloutID, "failed"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return st, err
+	}
+	st.Rooms, st.Failures = rooms.Val(), failed.Val()
+	if st.Rooms > 0 {
+		st.Rate = float64(st.Failures) / float64(st.Rooms)
+	}
+	return st, nil
+}
@@ -0,0 +1,30 @@
+package store
+
+import "testing"
+
+func TestIsBuildFailure(t *testing.T) {
+	tests := []struct {
+		status string
+		reason string
+		want   bool
+	}{
+		{status: "DEAD", reason: "server_crash", want: true},
+		{status: "DEAD", reason: "heartbeat_lost", want: true},
+		{status: "DEAD", reason: "ready_timeout", want: true},
+		{status: "DEAD", reason: "alloc_timeout"},
+		{status: "DEAD", reason: "duplicate_player_active"},
+		{status: "DEAD", reason: "nomad plan rejected: insufficient_resources: memory (3 nodes)"},
+		{status: "DEAD", reason: "nomad plan error: connection refused"},
+		{status: "DEAD", reason: ""},
+		{status: "FULFILLED", reason: "server_crash"},
+		{status: "OPENED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status+"/"+tt.reason, func(t *testing.T) {
+			st := &RoomState{Status: tt.status, FailReason: tt.reason}
+			if got := IsBuildFailure(st); got != tt.want {
+				t.Fatalf("IsBuildFailure(%s, %q) = %v, want %v", tt.status, tt.reason, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Nguồn của event
+const (
+	EventSourceAgent  = "agent"  // chuyển trạng thái room
+	EventSourceServer = "server" // game server báo giữa trận (POST /rooms/:room_id/events)
+)
+
+const (
+	eventsStreamKey   = "mm:events"
+	eventsStreamMax   = 10000 // MAXLEN ~ của stream lifecycle
+	maxRoomEventLog   = 50    // số event server gần nhất giữ trong room state
+	eventsReadDefault = 100
+)
+
+// RoomEvent một event trong lifecycle stream (mm:events) và event log của room
+type RoomEvent struct {
+	ID      string          `json:"id,omitempty"` // id trong Redis stream
+	RoomID  string          `json:"room_id"`
+	Type    string          `json:"type"` // room_opened|room_actived|room_fulfilled|room_dead hoặc type server báo
+	Source  string          `json:"source"`
+	Status  string          `json:"status,omitempty"` // status room sau event
+	Reason  string          `json:"reason,omitempty"` // fail_reason/end_reason khi room kết thúc
+	Payload json.RawMessage `json:"payload,omitempty"`
+	At      int64           `json:"at_unix"`
+}
+
+// lifecycleEvent event agent phát khi room đổi trạng thái
+func lifecycleEvent(st *RoomState) RoomEvent {
+	reason := st.FailReason
+	if st.EndReason != "" {
+		reason = st.EndReason
+	}
+	return RoomEvent{
+		RoomID: st.RoomID,
+		Type:   "room_" + strings.ToLower(st.Status),
+		Source: EventSourceAgent,
+		Status: st.Status,
+		Reason: reason,
+		At:     time.Now().Unix(),
+	}
+}
+
+// publishEvent thêm event vào stream trong cùng pipeline/transaction với thay đổi room
+func publishEvent(ctx context.Context, pipe redis.Pipeliner, ev RoomEvent) {
+	b, _ := json.Marshal(ev)
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventsStreamKey,
+		MaxLen: eventsStreamMax,
+		Approx: true,
+		Values: map[string]any{"event": string(b)},
+	})
+}
+
+// AppendRoomEvent ghi event server báo vào event log của room ACTIVED và lifecycle stream
+func (m *Manager) AppendRoomEvent(ctx context.Context, roomID string, ev RoomEvent) (*RoomState, error) {
+	key := roomKey(roomID)
+	var out *RoomState
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var st RoomState
+		if err := json.Unmarshal([]byte(v), &st); err != nil {
+			return err
+		}
+		out = &st
+		if st.Status != "ACTIVED" {
+			return ErrRoomNotActive
+		}
+		ev.RoomID, ev.Source, ev.Status = roomID, EventSourceServer, st.Status
+		st.Events = append(st.Events, ev)
+		if n := len(st.Events); n > maxRoomEventLog {
+			st.Events = st.Events[n-maxRoomEventLog:]
+		}
+		b, _ := json.Marshal(st)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, string(b), redis.SetArgs{KeepTTL: true})
+			publishEvent(ctx, pipe, ev)
+			return nil
+		})
+		return err
+	}, key)
+	return out, err
+}
+
+// ReadEvents đọc lifecycle stream sau id after ("" = từ đầu); wait > 0 → chờ tối đa wait khi chưa có event mới (long-poll).
+// roomID != "" lọc theo room; trả thêm id cuối đã đọc để lần sau đọc tiếp.
+func (m *Manager) ReadEvents(ctx context.Context, after, roomID string, limit int, wait time.Duration) ([]RoomEvent, string, error) {
+	if after == "" {
+		after = "0-0"
+	}
+	if limit <= 0 {
+		limit = eventsReadDefault
+	}
+	block := time.Duration(-1) // không BLOCK
+	if wait > 0 {
+		block = wait
+	}
+	res, err := m.redis.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{eventsStreamKey, after},
+		Count:   int64(limit),
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return []RoomEvent{}, after, nil
+	}
+	if err != nil {
+		return nil, after, err
+	}
+	out := []RoomEvent{}
+	last := after
+	for _, s := range res {
+		for _, msg := range s.Messages {
+			last = msg.ID
+			raw, _ := msg.Values["event"].(string)
+			var ev RoomEvent
+			if json.Unmarshal([]byte(raw), &ev) != nil {
+				continue
+			}
+			if roomID != "" && ev.RoomID != roomID {
+				continue
+			}
+			ev.ID = msg.ID
+			out = append(out, ev)
+		}
+	}
+	return out, last, nil
+}
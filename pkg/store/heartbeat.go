@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrRoomNotActive trả về khi heartbeat tới cho room không ở trạng thái ACTIVED
+var ErrRoomNotActive = errors.New("room not ACTIVED")
+
+// RoomTelemetry số liệu server tự báo qua heartbeat
+type RoomTelemetry struct {
+	PlayerCount int      `json:"player_count"`
+	Players     []string `json:"players,omitempty"` // player đang kết nối
+	// player mất kết nối còn trong reconnect window
+	Disconnected []string `json:"disconnected,omitempty"`
+	Phase        string   `json:"phase,omitempty"` // ví dụ lobby, playing, ending
+	TickRate     float64  `json:"tick_rate,omitempty"`
+	MemoryMB     float64  `json:"memory_mb,omitempty"`
+	SentAt       int64    `json:"sent_at_unix,omitempty"` // giờ phía server
+}
+
+// UpdateRoomHeartbeat ghi telemetry + last_heartbeat vào room ACTIVED.
+// Dùng WATCH để không ghi đè nếu room vừa chuyển trạng thái (shutdown, cron DEAD).
+func (m *Manager) UpdateRoomHeartbeat(ctx context.Context, roomID string, t RoomTelemetry, at int64) (*RoomState, error) {
+	key := roomKey(roomID)
+	var out *RoomState
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var st RoomState
+		if err := json.Unmarshal([]byte(v), &st); err != nil {
+			return err
+		}
+		if st.Status != "ACTIVED" {
+			return ErrRoomNotActive
+		}
+		st.Telemetry = &t
+		st.LastHeartbeatAt = at
+		b, _ := json.Marshal(st)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, string(b), redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		out = &st
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
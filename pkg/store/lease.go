@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lease trạng thái lease leader trong Redis
+type Lease struct {
+	Name       string `json:"name"`
+	Holder     string `json:"holder,omitempty"`
+	Token      int64  `json:"token,omitempty"` // fencing token, tăng mỗi lần đổi holder
+	AcquiredAt int64  `json:"acquired_at_unix,omitempty"`
+	ExpiresAt  int64  `json:"expires_at_unix,omitempty"`
+}
+
+func leaseKey(name string) string      { return "mm:lease:" + name }
+func leaseTokenKey(name string) string { return "mm:lease:" + name + ":token" }
+
+// tryLeaseScript: chưa có holder → cấp token mới; holder hiện tại gia hạn giữ token; holder khác → 0
+var tryLeaseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  local tok = redis.call('INCR', KEYS[2])
+  redis.call('HSET', KEYS[1], 'holder', ARGV[1], 'token', tok, 'acquired_at', ARGV[3])
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return tok
+end
+if redis.call('HGET', KEYS[1], 'holder') == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return tonumber(redis.call('HGET', KEYS[1], 'token'))
+end
+return 0
+`)
+
+// releaseLeaseScript chỉ xoá lease khi holder và token khớp
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'holder') == ARGV[1] and redis.call('HGET', KEYS[1], 'token') == ARGV[2] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// TryLease giành hoặc gia hạn lease name cho holder trong ttl; trả fencing token (0 = holder khác đang giữ)
+func (m *Manager) TryLease(ctx context.Context, name, holder string, ttl time.Duration) (int64, error) {
+	return tryLeaseScript.Run(ctx, m.redis, []string{leaseKey(name), leaseTokenKey(name)},
+		holder, ttl.Milliseconds(), time.Now().Unix()).Int64()
+}
+
+// ReleaseLease trả lease để agent khác lên leader ngay, không chờ hết TTL
+func (m *Manager) ReleaseLease(ctx context.Context, name, holder string, token int64) error {
+	return releaseLeaseScript.Run(ctx, m.redis, []string{leaseKey(name)}, holder, strconv.FormatInt(token, 10)).Err()
+}
+
+// GetLease đọc holder/token/thời hạn hiện tại (Holder rỗng = chưa có leader)
+func (m *Manager) GetLease(ctx context.Context, name string) (*Lease, error) {
+	l := &Lease{Name: name}
+	all, err := m.redis.HGetAll(ctx, leaseKey(name)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return l, nil
+	}
+	l.Holder = all["holder"]
+	l.Token, _ = strconv.ParseInt(all["token"], 10, 64)
+	l.AcquiredAt, _ = strconv.ParseInt(all["acquired_at"], 10, 64)
+	if pttl, err := m.redis.PTTL(ctx, leaseKey(name)).Result(); err == nil && pttl > 0 {
+		l.ExpiresAt = time.Now().Add(pttl).Unix()
+	}
+	return l, nil
+}
+
+// CheckFence xác nhận token vẫn là lease hiện hành (chặn leader cũ ghi sau khi đã mất lease)
+func (m *Manager) CheckFence(ctx context.Context, name string, token int64) bool {
+	if token <= 0 {
+		return false
+	}
+	v, err := m.redis.HGet(ctx, leaseKey(name), "token").Int64()
+	return err == nil && v == token
+}
+
+// ErrFenced trả về khi ghi với fencing token không còn là lease hiện hành (leader cũ)
+var ErrFenced = errors.New("fencing token is no longer the current lease")
+
+type fenceCtxKey struct{}
+
+type fence struct {
+	name  string
+	token int64
+}
+
+// WithFence gắn fencing token của lease name vào ctx. Các ghi room state với ctx này
+// (SaveRoomState, TransitionRoom, DeleteRoomState) kiểm tra token trong cùng transaction với lệnh ghi.
+func WithFence(ctx context.Context, name string, token int64) context.Context {
+	return context.WithValue(ctx, fenceCtxKey{}, fence{name: name, token: token})
+}
+
+// watchFenced chạy fn trong WATCH keys; ctx có fence → WATCH thêm bộ đếm token của lease và
+// kiểm tra token trong transaction: leader mới INCR token làm EXEC thất bại, token khác → ErrFenced.
+// Bộ đếm chỉ đổi khi đổi holder nên việc gia hạn lease không làm transaction thất bại.
+func (m *Manager) watchFenced(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	f, ok := ctx.Value(fenceCtxKey{}).(fence)
+	if !ok {
+		return m.redis.Watch(ctx, fn, keys...)
+	}
+	tokenKey := leaseTokenKey(f.name)
+	return m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, tokenKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if f.token <= 0 || v != f.token {
+			return ErrFenced
+		}
+		return fn(tx)
+	}, append(keys, tokenKey)...)
+}
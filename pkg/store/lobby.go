@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lỗi lobby của private room
+var (
+	ErrLobbyFull    = errors.New("lobby is full")
+	ErrLobbyClosed  = errors.New("lobby is not waiting") // đã start hoặc đã đóng
+	ErrNotLobbyHost = errors.New("only the host can do this")
+	ErrLobbyAuth    = errors.New("invalid lobby member token")
+)
+
+// LobbyMember một player trong lobby (attributes chuyển cho server qua assignment như ticket)
+type LobbyMember struct {
+	PlayerID   string            `json:"player_id"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	JoinedAt   int64             `json:"joined_at_unix"`
+	TokenHash  string            `json:"token_sha256,omitempty"` // sha256 của member token; bỏ khi trả ra ngoài (Public)
+}
+
+// Lobby phòng chờ của private room: host tạo, người khác vào bằng Code, host start → allocate room
+type Lobby struct {
+	Code       string        `json:"code"`
+	HostID     string        `json:"host_id"`
+	Queue      string        `json:"queue"`
+	Region     string        `json:"region,omitempty"` // rỗng = region đầu tiên còn capacity
+	MaxPlayers int           `json:"max_players"`
+	Members    []LobbyMember `json:"members"`
+	Status     string        `json:"status"` // WAITING|STARTED|CLOSED
+	RoomID     string        `json:"room_id,omitempty"`
+	CreatedAt  int64         `json:"created_at_unix"`
+	UpdatedAt  int64         `json:"updated_at_unix"`
+	StartedAt  int64         `json:"started_at_unix,omitempty"`
+}
+
+// Member trả member theo player_id
+func (l *Lobby) Member(pid string) (LobbyMember, bool) {
+	for _, p := range l.Members {
+		if p.PlayerID == pid {
+			return p, true
+		}
+	}
+	return LobbyMember{}, false
+}
+
+// Public bản sao lobby không kèm hash member token (trả cho client)
+func (l *Lobby) Public() *Lobby {
+	if l == nil {
+		return nil
+	}
+	out := *l
+	out.Members = make([]LobbyMember, len(l.Members))
+	for i, p := range l.Members {
+		p.TokenHash = ""
+		out.Members[i] = p
+	}
+	return &out
+}
+
+// lobbyIdleTTL lobby WAITING không có hoạt động (join/leave/start) quá thời gian này thì hết hạn; set từ config
+var lobbyIdleTTL = 10 * time.Minute
+
+// SetLobbyIdleTTL sets how long an idle lobby is kept
+func SetLobbyIdleTTL(ttl time.Duration) { lobbyIdleTTL = ttl }
+
+const (
+	lobbyCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // bỏ 0/O, 1/I dễ nhầm
+	lobbyCodeLen      = 6
+)
+
+func lobbyKey(code string) string { return "mm:lobby:" + code }
+
+// lobbyTTL TTL theo trạng thái: WAITING gia hạn mỗi lần có hoạt động; STARTED như room OPENED vừa tạo,
+// sau đó đi theo TTL của room (syncLobbyTTL); CLOSED giữ như room terminal
+func lobbyTTL(status string) time.Duration {
+	switch status {
+	case "WAITING":
+		return lobbyIdleTTL
+	case "STARTED":
+		return roomTTL("OPENED")
+	}
+	return terminalTTL
+}
+
+// syncLobbyTTL cho lobby STARTED sống cùng room của nó (ghi trong cùng pipeline với room):
+// room OPENED → TTL allocate, ACTIVED → không hết hạn, DEAD/FULFILLED → TTL terminal.
+// Member cần lobby để lấy join token tới khi room kết thúc.
+func syncLobbyTTL(ctx context.Context, pipe redis.Pipeliner, st *RoomState) {
+	if st.LobbyCode == "" {
+		return
+	}
+	if ttl := roomTTL(st.Status); ttl > 0 {
+		pipe.Expire(ctx, lobbyKey(st.LobbyCode), ttl)
+	} else {
+		pipe.Persist(ctx, lobbyKey(st.LobbyCode))
+	}
+}
+
+func newLobbyCode() (string, error) {
+	b := make([]byte, lobbyCodeLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = lobbyCodeAlphabet[int(b[i])%len(lobbyCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// CreateLobby tạo lobby WAITING với code ngẫu nhiên chưa dùng; host là member đầu tiên
+func (m *Manager) CreateLobby(ctx context.Context, l Lobby) (*Lobby, error) {
+	now := time.Now().Unix()
+	l.Status, l.CreatedAt, l.UpdatedAt = "WAITING", now, now
+	if l.Queue == "" {
+		l.Queue = DefaultQueue
+	}
+	for i := 0; i < 5; i++ {
+		code, err := newLobbyCode()
+		if err != nil {
+			return nil, err
+		}
+		l.Code = code
+		b, _ := json.Marshal(l)
+		ok, err := m.redis.SetNX(ctx, lobbyKey(code), string(b), lobbyIdleTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &l, nil
+		}
+	}
+	return nil, fmt.Errorf("could not allocate lobby code")
+}
+
+// GetLobby đọc lobby theo code (IsNotFound khi không có hoặc đã hết hạn)
+func (m *Manager) GetLobby(ctx context.Context, code string) (*Lobby, error) {
+	v, err := m.redis.Get(ctx, lobbyKey(code)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var l Lobby
+	if err := json.Unmarshal([]byte(v), &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// UpdateLobby đọc lobby, áp mutate và ghi lại trong WATCH (join/leave/start đồng thời không ghi đè nhau).
+// mutate trả lỗi → không ghi, trả lobby hiện tại kèm lỗi. TTL được đặt lại theo status mới.
+func (m *Manager) UpdateLobby(ctx context.Context, code string, mutate func(*Lobby) error) (*Lobby, error) {
+	key := lobbyKey(code)
+	var out *Lobby
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var l Lobby
+		if err := json.Unmarshal([]byte(v), &l); err != nil {
+			return err
+		}
+		out = &l
+		if err := mutate(&l); err != nil {
+			return err
+		}
+		l.UpdatedAt = time.Now().Unix()
+		b, _ := json.Marshal(l)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, string(b), lobbyTTL(l.Status))
+			return nil
+		})
+		return err
+	}, key)
+	return out, err
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrProposalClosed proposal không còn PENDING (đã đủ accept, có người decline hoặc hết hạn)
+var ErrProposalClosed = errors.New("match proposal closed")
+
+// Phản hồi của một ticket trong proposal
+const (
+	ProposalAccepted = "accepted"
+	ProposalDeclined = "declined"
+)
+
+// ProposalTicket một ticket trong trận được đề xuất; Response rỗng = chưa trả lời
+type ProposalTicket struct {
+	TicketID string `json:"ticket_id"`
+	PlayerID string `json:"player_id"`
+	Response string `json:"response,omitempty"` // accepted|declined
+}
+
+// Proposal trận được đề xuất khi queue bật ready check: mọi player accept trước Deadline mới allocate
+type Proposal struct {
+	ProposalID string           `json:"proposal_id"`
+	Queue      string           `json:"queue"`
+	Region     string           `json:"region"`
+	Tickets    []ProposalTicket `json:"tickets"`
+	Status     string           `json:"status"` // PENDING|ACCEPTED|DECLINED|EXPIRED
+	RoomID     string           `json:"room_id,omitempty"`
+	Deadline   int64            `json:"deadline_unix"`
+	CreatedAt  int64            `json:"created_at_unix"`
+}
+
+// Accepted số ticket đã accept
+func (p *Proposal) Accepted() int {
+	n := 0
+	for _, t := range p.Tickets {
+		if t.Response == ProposalAccepted {
+			n++
+		}
+	}
+	return n
+}
+
+const proposalsIndexKey = "mm:proposals" // SET proposal_id đang PENDING
+
+func proposalKey(id string) string { return "mm:proposal:" + id }
+func penaltyKey(pid string) string { return "mm:penalty:" + pid }
+
+// CreateProposal tạo proposal PENDING cho các ticket đã TakeTickets và chuyển chúng sang PROPOSED
+func (m *Manager) CreateProposal(ctx context.Context, queue, region string, tickets []Ticket, deadline time.Time) (*Proposal, error) {
+	p := &Proposal{ProposalID: uuid.New().String(), Queue: queue, Region: region, Status: "PENDING", Deadline: deadline.Unix(), CreatedAt: time.Now().Unix()}
+	for _, t := range tickets {
+		p.Tickets = append(p.Tickets, ProposalTicket{TicketID: t.TicketID, PlayerID: t.PlayerID})
+	}
+	b, _ := json.Marshal(p)
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, proposalKey(p.ProposalID), string(b), time.Until(deadline)+terminalTTL)
+	pipe.SAdd(ctx, proposalsIndexKey, p.ProposalID)
+	for _, t := range tickets {
+		t.Status, t.ProposalID, t.AcceptDeadline = "PROPOSED", p.ProposalID, p.Deadline
+		tb, _ := json.Marshal(t)
+		pipe.Set(ctx, ticketKeyPrefix+t.TicketID, string(tb), ticketTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return p, err
+}
+
+// GetProposal đọc proposal theo id
+func (m *Manager) GetProposal(ctx context.Context, id string) (*Proposal, error) {
+	v, err := m.redis.Get(ctx, proposalKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var p Proposal
+	if err := json.Unmarshal([]byte(v), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPendingProposals trả id các proposal còn PENDING
+func (m *Manager) ListPendingProposals(ctx context.Context) ([]string, error) {
+	return m.redis.SMembers(ctx, proposalsIndexKey).Result()
+}
+
+// updateProposal WATCH proposal, chỉ áp mutate khi còn PENDING; trả state sau khi ghi (hoặc hiện tại kèm ErrProposalClosed)
+func (m *Manager) updateProposal(ctx context.Context, id string, mutate func(*Proposal)) (*Proposal, error) {
+	key := proposalKey(id)
+	var out *Proposal
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var p Proposal
+		if err := json.Unmarshal([]byte(v), &p); err != nil {
+			return err
+		}
+		out = &p
+		if p.Status != "PENDING" {
+			return ErrProposalClosed
+		}
+		mutate(&p)
+		b, _ := json.Marshal(p)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, string(b), redis.SetArgs{KeepTTL: true})
+			if p.Status != "PENDING" {
+				pipe.SRem(ctx, proposalsIndexKey, id)
+			}
+			return nil
+		})
+		return err
+	}, key)
+	return out, err
+}
+
+// RespondProposal ghi accept/decline của ticket: decline → DECLINED, mọi ticket accept → ACCEPTED.
+// Chỉ một caller thấy proposal chuyển khỏi PENDING nên bước allocate/trả ticket chạy đúng một lần.
+func (m *Manager) RespondProposal(ctx context.Context, id, ticketID string, accept bool) (*Proposal, error) {
+	return m.updateProposal(ctx, id, func(p *Proposal) {
+		for i := range p.Tickets {
+			if p.Tickets[i].TicketID != ticketID {
+				continue
+			}
+			if accept {
+				p.Tickets[i].Response = ProposalAccepted
+			} else {
+				p.Tickets[i].Response = ProposalDeclined
+			}
+		}
+		switch {
+		case !accept:
+			p.Status = "DECLINED"
+		case p.Accepted() == len(p.Tickets):
+			p.Status = "ACCEPTED"
+		}
+	})
+}
+
+// ExpireProposal chuyển proposal PENDING quá deadline sang EXPIRED; ok=false nếu chưa tới hạn hoặc đã đóng
+func (m *Manager) ExpireProposal(ctx context.Context, id string, now time.Time) (*Proposal, bool, error) {
+	expired := false
+	p, err := m.updateProposal(ctx, id, func(p *Proposal) {
+		if now.Unix() >= p.Deadline {
+			p.Status, expired = "EXPIRED", true
+		}
+	})
+	if errors.Is(err, ErrProposalClosed) || IsNotFound(err) {
+		_ = m.redis.SRem(ctx, proposalsIndexKey, id).Err()
+		return p, false, nil
+	}
+	return p, expired, err
+}
+
+// SetProposalRoom ghi room_id của proposal ACCEPTED (client thấy qua ticket)
+func (m *Manager) SetProposalRoom(ctx context.Context, p *Proposal, roomID string) error {
+	p.RoomID = roomID
+	b, _ := json.Marshal(p)
+	return m.redis.SetArgs(ctx, proposalKey(p.ProposalID), string(b), redis.SetArgs{KeepTTL: true}).Err()
+}
+
+// ReturnTickets trả ticket PROPOSED về OPENED ở đầu queue (giữ thứ tự FIFO ban đầu)
+func (m *Manager) ReturnTickets(ctx context.Context, queue string, ticketIDs ...string) error {
+	back := []string{}
+	for _, tid := range ticketIDs {
+		t, err := m.GetTicket(ctx, tid)
+		if err != nil {
+			continue // ticket hết hạn: bỏ
+		}
+		t.Status, t.ProposalID, t.AcceptDeadline = "OPENED", "", 0
+		if err := m.setTicket(ctx, t); err != nil {
+			return err
+		}
+		back = append(back, tid)
+	}
+	return m.RequeueTickets(ctx, queue, back...)
+}
+
+// DeclineTicket đóng ticket DECLINED và phạt player không được tạo ticket mới trong penalty
+func (m *Manager) DeclineTicket(ctx context.Context, ticketID string, penalty time.Duration) error {
+	t, err := m.GetTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	t.Status, t.ProposalID, t.AcceptDeadline = "DECLINED", "", 0
+	b, _ := json.Marshal(t)
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, ticketKeyPrefix+ticketID, string(b), terminalTTL)
+	pipe.SRem(ctx, playersPending, t.PlayerID)
+	if penalty > 0 {
+		pipe.Set(ctx, penaltyKey(t.PlayerID), ticketID, penalty)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// PlayerPenalty trả thời gian phạt còn lại của player (0 = không bị phạt)
+func (m *Manager) PlayerPenalty(ctx context.Context, playerID string) (time.Duration, error) {
+	d, err := m.redis.TTL(ctx, penaltyKey(playerID)).Result()
+	if err != nil || d < 0 {
+		return 0, err
+	}
+	return d, nil
+}
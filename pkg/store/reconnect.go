@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Kết quả một lượt reconnect lookup
+const (
+	ReconnectOK        = "ok"
+	ReconnectRoomEnded = "room_ended"
+)
+
+// maxReconnectAttempts số lượt reconnect gần nhất giữ trong room state
+const maxReconnectAttempts = 20
+
+// ReconnectAttempt một lượt player hỏi lại room để kết nối lại
+type ReconnectAttempt struct {
+	PlayerID string `json:"player_id"`
+	At       int64  `json:"at_unix"`
+	Result   string `json:"result"`
+}
+
+// RecordReconnectAttempt ghi lượt reconnect vào room (mọi trạng thái, giữ TTL hiện tại)
+func (m *Manager) RecordReconnectAttempt(ctx context.Context, roomID string, a ReconnectAttempt) error {
+	key := roomKey(roomID)
+	return m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var st RoomState
+		if err := json.Unmarshal([]byte(v), &st); err != nil {
+			return err
+		}
+		st.ReconnectCount++
+		st.ReconnectAttempts = append(st.ReconnectAttempts, a)
+		if n := len(st.ReconnectAttempts); n > maxReconnectAttempts {
+			st.ReconnectAttempts = st.ReconnectAttempts[n-maxReconnectAttempts:]
+		}
+		b, _ := json.Marshal(st)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, string(b), redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		return err
+	}, key)
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidResult kết quả trận không khớp roster/assignment của room
+var ErrInvalidResult = errors.New("invalid match result")
+
+// PlayerResult kết quả một player
+type PlayerResult struct {
+	PlayerID  string             `json:"player_id"`
+	Team      string             `json:"team,omitempty"`
+	Placement int                `json:"placement"` // 1 = nhất; cùng hạng được phép (hoà)
+	Score     int                `json:"score"`
+	Stats     map[string]float64 `json:"stats,omitempty"` // kills, deaths, accuracy...
+}
+
+// TeamResult kết quả một team
+type TeamResult struct {
+	Team      string `json:"team"`
+	Placement int    `json:"placement"`
+	Score     int    `json:"score"`
+}
+
+// MatchResult kết quả trận server báo qua POST /rooms/:room_id/result hoặc kèm shutdown
+type MatchResult struct {
+	Players         []PlayerResult `json:"players"`
+	Teams           []TeamResult   `json:"teams,omitempty"`
+	Winner          string         `json:"winner,omitempty"` // player_id hoặc tên team
+	DurationSeconds int64          `json:"duration_seconds"`
+	Abandoned       []string       `json:"abandoned,omitempty"` // player bỏ trận
+	ReportedAt      int64          `json:"reported_at_unix,omitempty"`
+}
+
+// Validate kiểm tra kết quả với roster (players) và assignment (team của từng player) của room
+func (r *MatchResult) Validate(roster []string, a *RoomAssignment) error {
+	if len(r.Players) == 0 {
+		return fmt.Errorf("%w: players is empty", ErrInvalidResult)
+	}
+	if r.DurationSeconds < 0 {
+		return fmt.Errorf("%w: duration_seconds < 0", ErrInvalidResult)
+	}
+	inRoster := map[string]bool{}
+	for _, p := range roster {
+		inRoster[p] = true
+	}
+	playerTeam := map[string]string{}
+	teams := map[string]bool{}
+	if a != nil {
+		for _, p := range a.Players {
+			playerTeam[p.PlayerID] = p.Team
+		}
+		for t := range a.Teams {
+			teams[t] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, p := range r.Players {
+		switch {
+		case !inRoster[p.PlayerID]:
+			return fmt.Errorf("%w: player %q not in room", ErrInvalidResult, p.PlayerID)
+		case seen[p.PlayerID]:
+			return fmt.Errorf("%w: player %q reported twice", ErrInvalidResult, p.PlayerID)
+		case p.Placement < 1:
+			return fmt.Errorf("%w: player %q placement must be >= 1", ErrInvalidResult, p.PlayerID)
+		case p.Team != "" && playerTeam[p.PlayerID] != "" && p.Team != playerTeam[p.PlayerID]:
+			return fmt.Errorf("%w: player %q is on team %q, not %q", ErrInvalidResult, p.PlayerID, playerTeam[p.PlayerID], p.Team)
+		}
+		seen[p.PlayerID] = true
+	}
+	seenTeam := map[string]bool{}
+	for _, t := range r.Teams {
+		switch {
+		case len(teams) > 0 && !teams[t.Team]:
+			return fmt.Errorf("%w: team %q not in assignment", ErrInvalidResult, t.Team)
+		case seenTeam[t.Team]:
+			return fmt.Errorf("%w: team %q reported twice", ErrInvalidResult, t.Team)
+		case t.Placement < 1:
+			return fmt.Errorf("%w: team %q placement must be >= 1", ErrInvalidResult, t.Team)
+		}
+		seenTeam[t.Team] = true
+	}
+	for _, p := range r.Abandoned {
+		if !inRoster[p] {
+			return fmt.Errorf("%w: abandoned player %q not in room", ErrInvalidResult, p)
+		}
+	}
+	if r.Winner != "" && !inRoster[r.Winner] && !seenTeam[r.Winner] && !teams[r.Winner] {
+		return fmt.Errorf("%w: winner %q is neither a player nor a team of the room", ErrInvalidResult, r.Winner)
+	}
+	return nil
+}
+
+// applyResult ghi result và các field cũ winner/scores (UI, client cũ)
+func applyResult(st *RoomState, r MatchResult) {
+	st.Result = &r
+	st.Winner = r.Winner
+	st.Scores = make(map[string]int, len(r.Players))
+	for _, p := range r.Players {
+		st.Scores[p.PlayerID] = p.Score
+	}
+}
+
+// SaveRoomResult validate rồi ghi kết quả vào room ACTIVED (báo trước shutdown, ghi đè được)
+// hoặc FULFILLED (kết quả tới ngay sau shutdown); trạng thái khác → ErrRoomStatusChanged kèm state hiện tại.
+func (m *Manager) SaveRoomResult(ctx context.Context, roomID string, r MatchResult) (*RoomState, error) {
+	key := roomKey(roomID)
+	var out *RoomState
+	err := m.redis.Watch(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var st RoomState
+		if err := json.Unmarshal([]byte(v), &st); err != nil {
+			return err
+		}
+		out = &st
+		if st.Status != "ACTIVED" && st.Status != "FULFILLED" {
+			return ErrRoomStatusChanged
+		}
+		if err := r.Validate(st.Players, st.Assignment); err != nil {
+			return err
+		}
+		applyResult(&st, r)
+		b, _ := json.Marshal(st)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SetArgs(ctx, key, string(b), redis.SetArgs{KeepTTL: true})
+			return nil
+		})
+		return err
+	}, key)
+	return out, err
+}
+
+// ApplyResult validate và gắn kết quả vào state đang xử lý (dùng trong TransitionRoom của shutdown)
+func ApplyResult(st *RoomState, r MatchResult) error {
+	if err := r.Validate(st.Players, st.Assignment); err != nil {
+		return err
+	}
+	applyResult(st, r)
+	return nil
+}
@@ -3,7 +3,9 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,8 +16,14 @@ type RoomState struct {
 	RoomID       string         `json:"room_id"`
 	AllocationID string         `json:"allocation_id"`
 	ServerIP     string         `json:"server_ip"`
+	ServerHost   string         `json:"server_host,omitempty"` // DNS name của node nếu có (ưu tiên hơn ServerIP khi connect)
 	Port         int            `json:"port"`
 	Players      []string       `json:"players"`
+	Queue        string         `json:"queue,omitempty"`
+	Region       string         `json:"region,omitempty"`
+	BuildVersion string         `json:"build_version,omitempty"`
+	RolloutID    string         `json:"rollout_id,omitempty"` // rollout đã chọn build (thống kê canary)
+	LobbyCode    string         `json:"lobby_code,omitempty"` // private room: join code của lobby tạo ra room
 	CreatedAt    int64          `json:"created_at_unix"`
 	Status       string         `json:"status,omitempty"`
 	FailReason   string         `json:"fail_reason,omitempty"`
@@ -23,8 +31,30 @@ type RoomState struct {
 	FulfilledAt  int64          `json:"fulfilled_at_unix,omitempty"`
 	DeadAt       int64          `json:"dead_at_unix,omitempty"`
 	GracefulAt   int64          `json:"graceful_at_unix,omitempty"`
+	ShutdownKey  string         `json:"shutdown_key,omitempty"`      // idempotency key của shutdown callback đã xử lý
+	AllocatedAt  int64          `json:"allocated_at_unix,omitempty"` // Nomad allocation chạy + có port, chờ server ready
+	ReadyAt      int64          `json:"ready_at_unix,omitempty"`     // server báo ready (callback/probe) → ACTIVED
 	Winner       string         `json:"winner,omitempty"`
 	Scores       map[string]int `json:"scores,omitempty"`
+	// Result kết quả trận có kiểu (POST /rooms/:room_id/result hoặc kèm shutdown); Winner/Scores dẫn xuất từ đây
+	Result *MatchResult `json:"result,omitempty"`
+
+	// Assignment ghi lúc match, server lấy qua GET /rooms/:room_id/assignment
+	Assignment *RoomAssignment `json:"assignment,omitempty"`
+
+	// Heartbeat từ server (svrsdk): lần cuối nhận và telemetry mới nhất
+	LastHeartbeatAt int64          `json:"last_heartbeat_unix,omitempty"`
+	Telemetry       *RoomTelemetry `json:"telemetry,omitempty"`
+
+	// Lượt reconnect qua /reconnect/lookup (giữ maxReconnectAttempts lượt gần nhất)
+	ReconnectCount    int                `json:"reconnect_count,omitempty"`
+	ReconnectAttempts []ReconnectAttempt `json:"reconnect_attempts,omitempty"`
+
+	// Event server báo giữa trận (giữ maxRoomEventLog event gần nhất)
+	Events []RoomEvent `json:"events,omitempty"`
+
+	// BackfillID backfill đang mở của room (rỗng = không bổ sung player)
+	BackfillID string `json:"backfill_id,omitempty"`
 }
 
 type PendingCreate struct {
@@ -34,11 +64,19 @@ type PendingCreate struct {
 }
 
 type Ticket struct {
-	TicketID  string `json:"ticket_id"`
-	PlayerID  string `json:"player_id"`
-	Status    string `json:"status"` // OPENED|MATCHED|EXPIRED|REJECTED
-	RoomID    string `json:"room_id,omitempty"`
-	EnqueueAt int64  `json:"enqueue_at_unix"`
+	TicketID  string         `json:"ticket_id"`
+	PlayerID  string         `json:"player_id"`
+	Queue     string         `json:"queue,omitempty"`
+	Regions   []string       `json:"regions,omitempty"`      // rỗng → mọi region
+	Latencies map[string]int `json:"latencies_ms,omitempty"` // region → ping đo từ client (ms)
+	// Attributes dữ liệu tùy ý của player (nhân vật, skin...) chuyển cho server qua assignment
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Status     string            `json:"status"` // OPENED|PROPOSED|MATCHED|DECLINED|EXPIRED|REJECTED
+	RoomID     string            `json:"room_id,omitempty"`
+	EnqueueAt  int64             `json:"enqueue_at_unix"`
+	// ready check: proposal đang chờ player accept trước AcceptDeadline
+	ProposalID     string `json:"proposal_id,omitempty"`
+	AcceptDeadline int64  `json:"accept_deadline_unix,omitempty"`
 }
 
 type Manager struct {
@@ -59,8 +97,20 @@ const (
 	openedTicketsKey = "mm:tickets:opened"  // LIST of ticket_id
 	ticketKeyPrefix  = "mm:ticket:"         // mm:ticket:<ticket_id>
 	playersPending   = "mm:players:pending" // SET of player_id with OPENED tickets
+	queuesIndexKey   = "mm:queues"          // SET of non-default queue names có ticket
 )
 
+// DefaultQueue là queue dùng khi ticket không chỉ định queue (giữ key legacy mm:tickets:opened)
+const DefaultQueue = "default"
+
+// openedTicketsKeyFor trả LIST ticket OPENED của queue
+func openedTicketsKeyFor(queue string) string {
+	if queue == "" || queue == DefaultQueue {
+		return openedTicketsKey
+	}
+	return openedTicketsKey + ":" + queue
+}
+
 // ticketTTL will be set from config, default 120s
 var ticketTTL = 120 * time.Second
 
@@ -81,8 +131,13 @@ func SetAllocationTimeout(ttl time.Duration) { allocationTimeout = ttl }
 // SetTerminalTTL sets how long terminal room states are kept
 func SetTerminalTTL(ttl time.Duration) { terminalTTL = ttl }
 
-// CreateTicket (join): returns ticket
-func (m *Manager) CreateTicket(ctx context.Context, playerID string) (*Ticket, error) {
+// CreateTicket (join): tạo ticket OPENED từ req (PlayerID, Queue, Regions, Latencies); queue rỗng → DefaultQueue
+func (m *Manager) CreateTicket(ctx context.Context, req Ticket) (*Ticket, error) {
+	playerID := req.PlayerID
+	queue := req.Queue
+	if queue == "" {
+		queue = DefaultQueue
+	}
 	// prevent duplicate player
 	added, err := m.redis.SAdd(ctx, playersPending, playerID).Result()
 	if err != nil {
@@ -92,10 +147,13 @@ func (m *Manager) CreateTicket(ctx context.Context, playerID string) (*Ticket, e
 		return nil, fmt.Errorf("duplicate ticket for player %s", playerID)
 	}
 	tid := uuid.New().String()
-	t := &Ticket{TicketID: tid, PlayerID: playerID, Status: "OPENED", EnqueueAt: time.Now().Unix()}
+	t := &Ticket{TicketID: tid, PlayerID: playerID, Queue: queue, Regions: req.Regions, Latencies: req.Latencies, Attributes: req.Attributes, Status: "OPENED", EnqueueAt: time.Now().Unix()}
 	b, _ := json.Marshal(t)
 	pipe := m.redis.TxPipeline()
-	pipe.RPush(ctx, openedTicketsKey, tid)
+	pipe.RPush(ctx, openedTicketsKeyFor(queue), tid)
+	if queue != DefaultQueue {
+		pipe.SAdd(ctx, queuesIndexKey, queue)
+	}
 	pipe.Set(ctx, ticketKeyPrefix+tid, string(b), ticketTTL)
 	_, err = pipe.Exec(ctx)
 	if err != nil {
@@ -130,23 +188,24 @@ func (m *Manager) CancelTicket(ctx context.Context, ticketID string) error {
 		return fmt.Errorf("cannot cancel: status=%s", t.Status)
 	}
 	pipe := m.redis.TxPipeline()
-	pipe.LRem(ctx, openedTicketsKey, 0, ticketID)
+	pipe.LRem(ctx, openedTicketsKeyFor(t.Queue), 0, ticketID)
 	pipe.Del(ctx, ticketKeyPrefix+ticketID)
 	pipe.SRem(ctx, playersPending, t.PlayerID)
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// TryMatchPair: naive (non-atomic) pop 2 tickets; caller must handle errors
-func (m *Manager) TryMatchPair(ctx context.Context) (*Ticket, *Ticket, error) {
-	tid1, err1 := m.redis.LPop(ctx, openedTicketsKey).Result()
+// TryMatchPair: naive (non-atomic) pop 2 tickets của queue; caller must handle errors
+func (m *Manager) TryMatchPair(ctx context.Context, queue string) (*Ticket, *Ticket, error) {
+	key := openedTicketsKeyFor(queue)
+	tid1, err1 := m.redis.LPop(ctx, key).Result()
 	if err1 != nil {
 		return nil, nil, err1
 	}
-	tid2, err2 := m.redis.LPop(ctx, openedTicketsKey).Result()
+	tid2, err2 := m.redis.LPop(ctx, key).Result()
 	if err2 != nil {
 		// push back tid1 to head to avoid loss
-		_ = m.redis.LPush(ctx, openedTicketsKey, tid1).Err()
+		_ = m.redis.LPush(ctx, key, tid1).Err()
 		return nil, nil, err2
 	}
 	t1, e1 := m.GetTicket(ctx, tid1)
@@ -157,6 +216,60 @@ func (m *Manager) TryMatchPair(ctx context.Context) (*Ticket, *Ticket, error) {
 	return t1, t2, nil
 }
 
+// takeTicketsScript gỡ atomically các ticket khỏi queue (thiếu một ticket → trả lại các ticket đã gỡ, 0);
+// có KEYS[2] (bộ đếm token của lease) → token khác ARGV[1] thì không gỡ gì, trả -1
+var takeTicketsScript = redis.NewScript(`
+if #KEYS == 2 and redis.call('GET', KEYS[2]) ~= ARGV[1] then
+  return -1
+end
+local taken = {}
+for i = 2, #ARGV do
+  if redis.call('LREM', KEYS[1], 1, ARGV[i]) == 0 then
+    for j = #taken, 1, -1 do
+      redis.call('LPUSH', KEYS[1], taken[j])
+    end
+    return 0
+  end
+  taken[#taken + 1] = ARGV[i]
+end
+return 1
+`)
+
+// TakeTickets gỡ các ticket đã chọn khỏi queue OPENED; nếu ticket nào đã bị lấy trước
+// thì trả lại các ticket vừa gỡ về đầu queue và báo lỗi. ctx mang fence → kiểm tra token trong cùng script.
+func (m *Manager) TakeTickets(ctx context.Context, queue string, ticketIDs ...string) error {
+	keys := []string{openedTicketsKeyFor(queue)}
+	args := []any{"0"}
+	if f, ok := ctx.Value(fenceCtxKey{}).(fence); ok {
+		keys = append(keys, leaseTokenKey(f.name))
+		args[0] = strconv.FormatInt(f.token, 10)
+	}
+	for _, tid := range ticketIDs {
+		args = append(args, tid)
+	}
+	n, err := takeTicketsScript.Run(ctx, m.redis, keys, args...).Int64()
+	switch {
+	case err != nil:
+		return err
+	case n < 0:
+		return ErrFenced
+	case n == 0:
+		return fmt.Errorf("tickets %v no longer opened", ticketIDs)
+	}
+	return nil
+}
+
+// RequeueTickets trả các ticket đã TakeTickets về đầu queue, giữ thứ tự FIFO ban đầu
+func (m *Manager) RequeueTickets(ctx context.Context, queue string, ticketIDs ...string) error {
+	key := openedTicketsKeyFor(queue)
+	for i := len(ticketIDs) - 1; i >= 0; i-- {
+		if err := m.redis.LPush(ctx, key, ticketIDs[i]).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // MarkMatched updates ticket with room_id and status
 func (m *Manager) MarkMatched(ctx context.Context, ticketID, roomID string) error {
 	t, err := m.GetTicket(ctx, ticketID)
@@ -177,31 +290,87 @@ func (m *Manager) MarkMatched(ctx context.Context, ticketID, roomID string) erro
 func roomKey(roomID string) string { return "mm:room:" + roomID }
 func roomsIndexKey() string        { return "mm:rooms" }
 
-func (m *Manager) SaveRoomState(ctx context.Context, st RoomState) error {
-	b, _ := json.Marshal(st)
-	pipe := m.redis.TxPipeline()
-	// TTL theo trạng thái
-	var exp time.Duration
-	switch st.Status {
+// roomTTL TTL theo trạng thái room
+func roomTTL(status string) time.Duration {
+	switch status {
 	case "OPENED":
-		exp = allocationTimeout
+		return allocationTimeout
 	case "DEAD", "FULFILLED":
-		exp = terminalTTL
+		return terminalTTL
 	default: // ACTIVED hoặc không xác định
-		exp = 0
+		return 0
 	}
-	pipe.Set(ctx, roomKey(st.RoomID), string(b), exp)
-	pipe.SAdd(ctx, roomsIndexKey(), st.RoomID)
-	_, err := pipe.Exec(ctx)
-	return err
 }
 
+// SaveRoomState ghi đè room; ctx mang fence (WithFence) → chỉ ghi khi token còn hiện hành
+func (m *Manager) SaveRoomState(ctx context.Context, st RoomState) error {
+	b, _ := json.Marshal(st)
+	return m.watchFenced(ctx, func(tx *redis.Tx) error {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, roomKey(st.RoomID), string(b), roomTTL(st.Status))
+			pipe.SAdd(ctx, roomsIndexKey(), st.RoomID)
+			publishEvent(ctx, pipe, lifecycleEvent(&st)) // SaveRoomState luôn đặt status (OPENED lúc tạo, DEAD)
+			recordBuildOutcome(ctx, pipe, &st)
+			syncLobbyTTL(ctx, pipe, &st)
+			return nil
+		})
+		return err
+	})
+}
+
+// ErrRoomStatusChanged trả về khi room không còn ở trạng thái mong đợi lúc chuyển trạng thái
+var ErrRoomStatusChanged = errors.New("room status changed")
+
+// TransitionRoom đọc room, chỉ khi status == from mới áp mutate và ghi lại (TTL theo status mới).
+// Dùng WATCH nên không ghi đè chuyển trạng thái đồng thời (callback ready, cron DEAD, shutdown).
+// Status khác from → trả state hiện tại kèm ErrRoomStatusChanged; ctx mang fence → kiểm tra token trong cùng WATCH.
+func (m *Manager) TransitionRoom(ctx context.Context, roomID, from string, mutate func(*RoomState)) (*RoomState, error) {
+	key := roomKey(roomID)
+	var out RoomState
+	err := m.watchFenced(ctx, func(tx *redis.Tx) error {
+		v, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		out = RoomState{}
+		if err := json.Unmarshal([]byte(v), &out); err != nil {
+			return err
+		}
+		if out.Status != from {
+			return ErrRoomStatusChanged
+		}
+		mutate(&out)
+		b, _ := json.Marshal(out)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, string(b), roomTTL(out.Status))
+			syncLobbyTTL(ctx, pipe, &out)
+			if out.Status != from {
+				publishEvent(ctx, pipe, lifecycleEvent(&out))
+				recordBuildOutcome(ctx, pipe, &out)
+			}
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, ErrRoomStatusChanged) {
+		return &out, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteRoomState xoá room khỏi key và index; ctx mang fence → chỉ xoá khi token còn hiện hành
 func (m *Manager) DeleteRoomState(ctx context.Context, roomID string) error {
-	pipe := m.redis.TxPipeline()
-	pipe.Del(ctx, roomKey(roomID))
-	pipe.SRem(ctx, roomsIndexKey(), roomID)
-	_, err := pipe.Exec(ctx)
-	return err
+	return m.watchFenced(ctx, func(tx *redis.Tx) error {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, roomKey(roomID))
+			pipe.SRem(ctx, roomsIndexKey(), roomID)
+			return nil
+		})
+		return err
+	})
 }
 
 func (m *Manager) GetRoomState(ctx context.Context, roomID string) (*RoomState, error) {
@@ -214,6 +383,9 @@ func (m *Manager) GetRoomState(ctx context.Context, roomID string) (*RoomState,
 	return &st, nil
 }
 
+// IsNotFound cho biết lỗi là do key không tồn tại (redis.Nil)
+func IsNotFound(err error) bool { return errors.Is(err, redis.Nil) }
+
 func (m *Manager) ListRooms(ctx context.Context) ([]string, error) {
 	return m.redis.SMembers(ctx, roomsIndexKey()).Result()
 }
@@ -225,9 +397,35 @@ func (m *Manager) Ping(ctx context.Context) error {
 	return m.redis.Ping(ctx).Err()
 }
 
-// ListOpenedTicketIDs: trả về danh sách ticket_id đang nằm trong queue OPENED
+// CountOpenedTickets: số ticket đang chờ trong queue
+func (m *Manager) CountOpenedTickets(ctx context.Context, queue string) (int64, error) {
+	return m.redis.LLen(ctx, openedTicketsKeyFor(queue)).Result()
+}
+
+// ListQueues: trả về các queue đã từng có ticket (luôn gồm DefaultQueue)
+func (m *Manager) ListQueues(ctx context.Context) ([]string, error) {
+	names, err := m.redis.SMembers(ctx, queuesIndexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{DefaultQueue}, names...), nil
+}
+
+// ListOpenedTicketIDs: trả về danh sách ticket_id đang nằm trong các queue OPENED
 func (m *Manager) ListOpenedTicketIDs(ctx context.Context) ([]string, error) {
-	return m.redis.LRange(ctx, openedTicketsKey, 0, -1).Result()
+	queues, err := m.ListQueues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, q := range queues {
+		ids, err := m.redis.LRange(ctx, openedTicketsKeyFor(q), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ids...)
+	}
+	return out, nil
 }
 
 // ListOpenedTickets: lấy chi tiết ticket theo danh sách OPENED
@@ -236,6 +434,19 @@ func (m *Manager) ListOpenedTickets(ctx context.Context) ([]Ticket, error) {
 	if err != nil {
 		return nil, err
 	}
+	return m.loadOpenedTickets(ctx, ids), nil
+}
+
+// ListOpenedTicketsInQueue: ticket OPENED của một queue theo thứ tự FIFO
+func (m *Manager) ListOpenedTicketsInQueue(ctx context.Context, queue string) ([]Ticket, error) {
+	ids, err := m.redis.LRange(ctx, openedTicketsKeyFor(queue), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return m.loadOpenedTickets(ctx, ids), nil
+}
+
+func (m *Manager) loadOpenedTickets(ctx context.Context, ids []string) []Ticket {
 	out := make([]Ticket, 0, len(ids))
 	for _, id := range ids {
 		v, e := m.redis.Get(ctx, ticketKeyPrefix+id).Result()
@@ -247,5 +458,5 @@ func (m *Manager) ListOpenedTickets(ctx context.Context) ([]Ticket, error) {
 			out = append(out, t)
 		}
 	}
-	return out, nil
+	return out
 }
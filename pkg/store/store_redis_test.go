@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// testStore kết nối Redis thật từ HIVE_TEST_REDIS_ADDR (vd. localhost:6379); không có → skip.
+// Key dùng id ngẫu nhiên và được xoá sau test, không flush DB.
+func testStore(t *testing.T) *Manager {
+	t.Helper()
+	addr := os.Getenv("HIVE_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("HIVE_TEST_REDIS_ADDR not set")
+	}
+	m := New(addr)
+	if err := m.Ping(context.Background()); err != nil {
+		t.Skipf("redis %s not available: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = m.redis.Close() })
+	return m
+}
+
+// cleanup xoá các key sau test
+func cleanup(t *testing.T, m *Manager, keys ...string) {
+	t.Cleanup(func() { m.redis.Del(context.Background(), keys...) })
+}
+
+func TestTakeTickets(t *testing.T) {
+	m := testStore(t)
+	ctx := context.Background()
+	lease := "test-" + uuid.NewString()
+	cleanup(t, m, leaseKey(lease), leaseTokenKey(lease))
+	token, err := m.TryLease(ctx, lease, "agent-a", time.Minute)
+	if err != nil || token <= 0 {
+		t.Fatalf("TryLease = %d, %v", token, err)
+	}
+
+	tests := []struct {
+		name      string
+		queued    []string
+		take      []string
+		ctx       context.Context
+		wantErr   error // nil = thành công; errAny = lỗi bất kỳ khác ErrFenced
+		wantQueue []string
+	}{
+		{name: "takes tickets without fence", queued: []string{"t1", "t2", "t3"}, take: []string{"t1", "t3"}, ctx: ctx, wantQueue: []string{"t2"}},
+		{name: "takes tickets with current fence", queued: []string{"t1", "t2"}, take: []string{"t2", "t1"}, ctx: WithFence(ctx, lease, token), wantQueue: []string{}},
+		{name: "stale fence takes nothing", queued: []string{"t1", "t2"}, take: []string{"t1", "t2"}, ctx: WithFence(ctx, lease, token-1), wantErr: ErrFenced, wantQueue: []string{"t1", "t2"}},
+		{name: "fence of unknown lease takes nothing", queued: []string{"t1"}, take: []string{"t1"}, ctx: WithFence(ctx, "missing-"+lease, 1), wantErr: ErrFenced, wantQueue: []string{"t1"}},
+		{name: "missing ticket returns the others", queued: []string{"t1", "t2"}, take: []string{"t1", "gone"}, ctx: ctx, wantErr: errAny, wantQueue: []string{"t1", "t2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := "test-" + uuid.NewString()
+			key := openedTicketsKeyFor(queue)
+			cleanup(t, m, key)
+			for _, id := range tt.queued {
+				m.redis.RPush(ctx, key, id)
+			}
+			err := m.TakeTickets(tt.ctx, queue, tt.take...)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("TakeTickets err = %v", err)
+			case tt.wantErr == errAny && (err == nil || errors.Is(err, ErrFenced)):
+				t.Fatalf("TakeTickets err = %v, want a missing-ticket error", err)
+			case tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+				t.Fatalf("TakeTickets err = %v, want %v", err, tt.wantErr)
+			}
+			got, _ := m.redis.LRange(ctx, key, 0, -1).Result()
+			if len(got) != len(tt.wantQueue) {
+				t.Fatalf("queue = %v, want %v", got, tt.wantQueue)
+			}
+			for i := range got {
+				if got[i] != tt.wantQueue[i] {
+					t.Fatalf("queue = %v, want %v", got, tt.wantQueue)
+				}
+			}
+		})
+	}
+}
+
+// errAny đánh dấu case mong đợi lỗi (không phải ErrFenced)
+var errAny = errors.New("any error")
+
+func TestTransitionRoom(t *testing.T) {
+	m := testStore(t)
+	ctx := context.Background()
+	lease := "test-" + uuid.NewString()
+	cleanup(t, m, leaseKey(lease), leaseTokenKey(lease))
+	token, err := m.TryLease(ctx, lease, "agent-a", time.Minute)
+	if err != nil || token <= 0 {
+		t.Fatalf("TryLease = %d, %v", token, err)
+	}
+
+	tests := []struct {
+		name       string
+		status     string // "" = room không tồn tại
+		from       string
+		ctx        context.Context
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "matching status", status: "OPENED", from: "OPENED", ctx: ctx, wantStatus: "DEAD"},
+		{name: "matching status with current fence", status: "ACTIVED", from: "ACTIVED", ctx: WithFence(ctx, lease, token), wantStatus: "DEAD"},
+		{name: "status changed", status: "FULFILLED", from: "ACTIVED", ctx: ctx, wantErr: ErrRoomStatusChanged, wantStatus: "FULFILLED"},
+		{name: "stale fence", status: "ACTIVED", from: "ACTIVED", ctx: WithFence(ctx, lease, token+1), wantErr: ErrFenced, wantStatus: "ACTIVED"},
+		{name: "missing room", from: "OPENED", ctx: ctx, wantErr: redis.Nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rid := "test-" + uuid.NewString()
+			cleanup(t, m, roomKey(rid))
+			t.Cleanup(func() { m.redis.SRem(context.Background(), roomsIndexKey(), rid) })
+			if tt.status != "" {
+				seed := RoomState{RoomID: rid, Status: tt.status, Players: []string{"p1"}, Assignment: &RoomAssignment{Teams: map[string][]string{"team_1": {"p1"}}}}
+				if err := m.SaveRoomState(ctx, seed); err != nil {
+					t.Fatalf("seed: %v", err)
+				}
+			}
+			st, err := m.TransitionRoom(tt.ctx, rid, tt.from, func(s *RoomState) {
+				s.Status, s.FailReason = "DEAD", "server_crash"
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionRoom err = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRoomStatusChanged) && st.Status != tt.status {
+				t.Fatalf("current state = %s, want %s", st.Status, tt.status)
+			}
+			if tt.status == "" {
+				return
+			}
+			cur, err := m.GetRoomState(ctx, rid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cur.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", cur.Status, tt.wantStatus)
+			}
+			// transition chỉ đổi field của mutate, giữ phần còn lại của room
+			if cur.Assignment == nil || len(cur.Players) != 1 {
+				t.Fatalf("room lost fields: %+v", cur)
+			}
+		})
+	}
+}
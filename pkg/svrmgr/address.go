@@ -0,0 +1,153 @@
+package svrmgr
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// DefaultAddressMetaKeys node meta mặc định chứa địa chỉ public (đặt trong client { meta { ... } } của Nomad)
+var DefaultAddressMetaKeys = []string{"public_ip", "public_hostname"}
+
+// IPMapping override tĩnh private → public (tương thích NOMAD_IP_MAPPINGS)
+type IPMapping struct {
+	PrivateIP string `json:"private_ip"`
+	PublicIP  string `json:"public_ip"`
+}
+
+// AddressOptions cấu hình cách Manager xác định địa chỉ public của node chạy game server.
+// Thứ tự ưu tiên: override file → Mappings → node meta → node attributes → IP private.
+type AddressOptions struct {
+	MetaKeys      []string    // rỗng = DefaultAddressMetaKeys
+	Attributes    []string    // ví dụ "unique.platform.aws.public-ipv4"
+	OverridesFile string      // JSON {"<node id|node name|private ip>": "<ip|hostname>"}, đọc lại khi file đổi
+	Mappings      []IPMapping // override theo private IP
+}
+
+// Nguồn của địa chỉ public (RoomInfo.AddressSource)
+const (
+	AddressSourceOverride  = "override"
+	AddressSourceMapping   = "mapping"
+	AddressSourceMeta      = "meta"
+	AddressSourceAttribute = "attribute"
+	AddressSourcePrivate   = "private"
+)
+
+// addressResolver giữ cấu hình và cache override file của một Manager
+type addressResolver struct {
+	mu        sync.Mutex
+	opts      AddressOptions
+	overrides map[string]string
+	modTime   time.Time
+}
+
+// SetAddressOptions đặt cấu hình phân giải địa chỉ public cho Manager này
+func (m *Manager) SetAddressOptions(opts AddressOptions) {
+	m.addr.mu.Lock()
+	defer m.addr.mu.Unlock()
+	m.addr.opts = opts
+	m.addr.overrides = nil
+	m.addr.modTime = time.Time{}
+}
+
+// SetIPMappings sets private->public IP overrides for this Manager
+func (m *Manager) SetIPMappings(mappings []IPMapping) {
+	m.addr.mu.Lock()
+	defer m.addr.mu.Unlock()
+	m.addr.opts.Mappings = mappings
+}
+
+// resolve trả địa chỉ public (IP hoặc hostname) của node và nguồn của nó
+func (r *addressResolver) resolve(node *api.Node) (string, string) {
+	private := privateAddress(node)
+	r.mu.Lock()
+	opts := r.opts
+	overrides := r.loadOverrides()
+	r.mu.Unlock()
+
+	for _, key := range []string{node.ID, node.Name, private} {
+		if v := overrides[key]; key != "" && v != "" {
+			return v, AddressSourceOverride
+		}
+	}
+	for _, mp := range opts.Mappings {
+		if mp.PrivateIP == private && mp.PublicIP != "" {
+			return mp.PublicIP, AddressSourceMapping
+		}
+	}
+	metaKeys := opts.MetaKeys
+	if len(metaKeys) == 0 {
+		metaKeys = DefaultAddressMetaKeys
+	}
+	for _, k := range metaKeys {
+		if v := strings.TrimSpace(node.Meta[k]); v != "" {
+			return v, AddressSourceMeta
+		}
+	}
+	for _, k := range opts.Attributes {
+		if v := strings.TrimSpace(node.Attributes[k]); v != "" {
+			return v, AddressSourceAttribute
+		}
+	}
+	return private, AddressSourcePrivate
+}
+
+// loadOverrides đọc lại override file khi mtime đổi; lỗi đọc giữ bản cũ (gọi khi đã giữ mu)
+func (r *addressResolver) loadOverrides() map[string]string {
+	path := r.opts.OverridesFile
+	if path == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil || fi.ModTime().Equal(r.modTime) {
+		return r.overrides
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return r.overrides
+	}
+	parsed := map[string]string{}
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return r.overrides
+	}
+	r.overrides = parsed
+	r.modTime = fi.ModTime()
+	return r.overrides
+}
+
+// privateAddress IP nội bộ mà Nomad báo cho node
+func privateAddress(node *api.Node) string {
+	if ip := node.Attributes["unique.network.ip-address"]; ip != "" {
+		return ip
+	}
+	addr := node.HTTPAddr
+	if addr == "" {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Split(addr, ":")[0]
+}
+
+// lookupHost phân giải hostname sang IP (ưu tiên IPv4); lỗi → trả rỗng
+func lookupHost(hostname string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, hostname)
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	for _, a := range addrs {
+		if ip := net.ParseIP(a); ip != nil && ip.To4() != nil {
+			return a
+		}
+	}
+	return addrs[0]
+}
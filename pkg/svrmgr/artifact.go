@@ -0,0 +1,111 @@
+package svrmgr
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// ErrInvalidArtifact trả về khi artifact thiếu source hoặc checksum sai định dạng
+var ErrInvalidArtifact = errors.New("invalid artifact")
+
+// Artifact ánh xạ tới stanza artifact của Nomad: client tải archive về task dir trước khi chạy task.
+// Command của template khi đó là đường dẫn tương đối trong task dir, ví dụ "local/server/server.x86_64".
+type Artifact struct {
+	Source      string `json:"source"`                // URL archive (http/https/s3/...), go-getter tự giải nén .zip/.tar.gz
+	Checksum    string `json:"checksum"`              // "<type>:<hex>", type: md5|sha1|sha256|sha512
+	Destination string `json:"destination,omitempty"` // tương đối task dir, mặc định "local/"
+	Mode        string `json:"mode,omitempty"`        // any|file|dir, mặc định any
+}
+
+// checksumHexLen độ dài hex theo loại checksum go-getter hỗ trợ
+var checksumHexLen = map[string]int{
+	"md5":    32,
+	"sha1":   40,
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// Validate kiểm tra source là URL hợp lệ và checksum đúng định dạng "<type>:<hex>".
+// Checksum là bắt buộc với mọi artifact (queue và build): Nomad client xác thực nội dung tải về qua getter option,
+// sai checksum thì allocation fail thay vì chạy build lạ.
+func (a Artifact) Validate() error {
+	if a.Source == "" {
+		return fmt.Errorf("%w: source required", ErrInvalidArtifact)
+	}
+	if u, err := url.Parse(a.Source); err != nil || u.Scheme == "" {
+		return fmt.Errorf("%w: source must be an absolute URL: %s", ErrInvalidArtifact, a.Source)
+	}
+	typ, sum, err := splitChecksum(a.Checksum)
+	if err != nil {
+		return err
+	}
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != checksumHexLen[typ] {
+		return fmt.Errorf("%w: %s checksum must be %d hex chars", ErrInvalidArtifact, typ, checksumHexLen[typ])
+	}
+	switch a.Mode {
+	case "", "any", "file", "dir":
+	default:
+		return fmt.Errorf("%w: mode must be any|file|dir", ErrInvalidArtifact)
+	}
+	return nil
+}
+
+// CheckSource kiểm tra source nằm dưới một trong các URL prefix (cùng scheme, host; path trùng hoặc nằm trong thư mục của prefix,
+// so theo segment: prefix /builds nhận /builds/x nhưng không nhận /builds-evil/x).
+// Danh sách rỗng → không source nào được phép.
+func (a Artifact) CheckSource(prefixes []string) error {
+	u, err := url.Parse(a.Source)
+	if err == nil && u.User == nil {
+		for _, p := range prefixes {
+			pu, err := url.Parse(p)
+			if err != nil || pu.Scheme == "" || pu.Host == "" {
+				continue
+			}
+			if strings.EqualFold(u.Scheme, pu.Scheme) && strings.EqualFold(u.Host, pu.Host) && underPath(u.Path, pu.Path) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: source not in allowed artifact sources: %s", ErrInvalidArtifact, a.Source)
+}
+
+// underPath: p trùng prefix hoặc bắt đầu bằng prefix + "/" (sau khi Clean, nên ../ không thoát ra được)
+func underPath(p, prefix string) bool {
+	p, prefix = path.Clean("/"+p), path.Clean("/"+prefix)
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func splitChecksum(checksum string) (string, string, error) {
+	typ, sum, ok := strings.Cut(checksum, ":")
+	if !ok || sum == "" {
+		return "", "", fmt.Errorf("%w: checksum must be <type>:<hex>", ErrInvalidArtifact)
+	}
+	typ = strings.ToLower(typ)
+	if _, ok := checksumHexLen[typ]; !ok {
+		return "", "", fmt.Errorf("%w: unsupported checksum type %q", ErrInvalidArtifact, typ)
+	}
+	return typ, strings.ToLower(sum), nil
+}
+
+// toNomad chuyển sang api.TaskArtifact; checksum đi qua getter option để Nomad client tự xác thực
+func (a Artifact) toNomad() *api.TaskArtifact {
+	ta := &api.TaskArtifact{
+		GetterSource:  &a.Source,
+		GetterOptions: map[string]string{"checksum": a.Checksum},
+	}
+	if a.Destination != "" {
+		dest := a.Destination
+		ta.RelativeDest = &dest
+	}
+	if a.Mode != "" {
+		mode := a.Mode
+		ta.GetterMode = &mode
+	}
+	return ta
+}
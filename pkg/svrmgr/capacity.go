@@ -0,0 +1,231 @@
+package svrmgr
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// defaultDynamicPorts: dải port động mặc định của Nomad (20000-32000) khi node không báo
+const defaultDynamicPorts = 32000 - 20000 + 1
+
+// NodeCapacity tài nguyên tổng/còn trống của một node (CPU MHz, memory MB, dynamic ports)
+type NodeCapacity struct {
+	NodeID        string `json:"node_id"`
+	Name          string `json:"name"`
+	Datacenter    string `json:"datacenter"`
+	NodePool      string `json:"node_pool,omitempty"`
+	NodeClass     string `json:"node_class,omitempty"`
+	Eligible      bool   `json:"eligible"` // ready, không drain, scheduling eligible
+	Allocations   int    `json:"allocations"`
+	CPUTotal      int    `json:"cpu_total_mhz"`
+	CPUFree       int    `json:"cpu_free_mhz"`
+	MemoryTotalMB int    `json:"memory_total_mb"`
+	MemoryFreeMB  int    `json:"memory_free_mb"`
+	PortsTotal    int    `json:"ports_total"`
+	PortsFree     int    `json:"ports_free"`
+
+	// targets giá trị của các biến constraint trên node (${attr.*}, ${meta.*}, ${node.*})
+	targets map[string]string
+}
+
+// DatacenterCapacity tổng hợp capacity các node eligible trong một datacenter
+type DatacenterCapacity struct {
+	Datacenter    string `json:"datacenter"`
+	Nodes         int    `json:"nodes"`
+	CPUTotal      int    `json:"cpu_total_mhz"`
+	CPUFree       int    `json:"cpu_free_mhz"`
+	MemoryTotalMB int    `json:"memory_total_mb"`
+	MemoryFreeMB  int    `json:"memory_free_mb"`
+	PortsFree     int    `json:"ports_free"`
+}
+
+// FleetCapacity snapshot capacity của toàn bộ node thuộc các datacenter của Manager
+type FleetCapacity struct {
+	Nodes       []NodeCapacity       `json:"nodes"`
+	Datacenters []DatacenterCapacity `json:"datacenters"`
+	CollectedAt int64                `json:"collected_at_unix"`
+}
+
+// fits kiểm tra node thoả placement của job và còn chỗ cho một game server (cpu, memory, 1 port)
+func (n NodeCapacity) fits(cpu, memoryMB int, p Placement) bool {
+	if !n.Eligible || !p.admits(n) {
+		return false
+	}
+	return n.CPUFree >= cpu && n.MemoryFreeMB >= memoryMB && n.PortsFree >= 1
+}
+
+// Slots trả số game server với profile (cpu, memoryMB) còn đặt được trên các node thoả placement
+// (node pool + constraints; datacenter đã lọc sẵn trong snapshot)
+func (f *FleetCapacity) Slots(cpu, memoryMB int, p Placement) int {
+	total := 0
+	for _, n := range f.Nodes {
+		if !n.fits(cpu, memoryMB, p) {
+			continue
+		}
+		slots := n.PortsFree
+		if cpu > 0 && n.CPUFree/cpu < slots {
+			slots = n.CPUFree / cpu
+		}
+		if memoryMB > 0 && n.MemoryFreeMB/memoryMB < slots {
+			slots = n.MemoryFreeMB / memoryMB
+		}
+		total += slots
+	}
+	return total
+}
+
+// Reserve trừ tạm tài nguyên của một game server trên node thoả placement còn trống nhiều nhất (theo memory);
+// trả false nếu không node nào đủ. Dùng để admission giữa hai lần refresh snapshot.
+func (f *FleetCapacity) Reserve(cpu, memoryMB int, p Placement) bool {
+	best := -1
+	for i, n := range f.Nodes {
+		if !n.fits(cpu, memoryMB, p) {
+			continue
+		}
+		if best < 0 || n.MemoryFreeMB > f.Nodes[best].MemoryFreeMB {
+			best = i
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	f.Nodes[best].CPUFree -= cpu
+	f.Nodes[best].MemoryFreeMB -= memoryMB
+	f.Nodes[best].PortsFree--
+	return true
+}
+
+// Capacity tính CPU/memory/ports còn trống theo node và theo datacenter từ dữ liệu node + allocation của Nomad
+func (m *Manager) Capacity() (*FleetCapacity, error) {
+	stubs, _, err := m.client.Nodes().List(&api.QueryOptions{Params: map[string]string{"resources": "true"}})
+	if err != nil {
+		return nil, err
+	}
+	allowedDC := map[string]bool{}
+	for _, dc := range m.datacenters {
+		allowedDC[dc] = true
+	}
+	fleet := &FleetCapacity{Nodes: []NodeCapacity{}, Datacenters: []DatacenterCapacity{}, CollectedAt: time.Now().Unix()}
+	byDC := map[string]*DatacenterCapacity{}
+	for _, stub := range stubs {
+		if stub == nil {
+			continue
+		}
+		if len(allowedDC) > 0 && !allowedDC[stub.Datacenter] {
+			continue
+		}
+		nc := NodeCapacity{
+			NodeID:     stub.ID,
+			Name:       stub.Name,
+			Datacenter: stub.Datacenter,
+			NodePool:   stub.NodePool,
+			NodeClass:  stub.NodeClass,
+			Eligible:   stub.Status == "ready" && !stub.Drain && stub.SchedulingEligibility == "eligible",
+			targets:    nodeTargets(stub.ID, stub.Name, stub.Datacenter, stub.NodeClass, stub.NodePool),
+		}
+		if res := stub.NodeResources; res != nil {
+			nc.CPUTotal = int(res.Cpu.CpuShares)
+			nc.MemoryTotalMB = int(res.Memory.MemoryMB)
+			nc.PortsTotal = defaultDynamicPorts
+			if res.MaxDynamicPort > 0 && res.MinDynamicPort > 0 {
+				nc.PortsTotal = res.MaxDynamicPort - res.MinDynamicPort + 1
+			}
+		}
+		if rsv := stub.ReservedResources; rsv != nil {
+			nc.CPUTotal -= int(rsv.Cpu.CpuShares)
+			nc.MemoryTotalMB -= int(rsv.Memory.MemoryMB)
+		}
+		usedCPU, usedMem, usedPorts := 0, 0, 0
+		if nc.Eligible {
+			// list stub không có đủ attributes/meta → đọc node để lọc theo constraint như scheduler
+			node, _, nerr := m.client.Nodes().Info(stub.ID, nil)
+			if nerr != nil {
+				return nil, nerr
+			}
+			for k, v := range node.Attributes {
+				nc.targets["${attr."+k+"}"] = v
+			}
+			for k, v := range node.Meta {
+				nc.targets["${meta."+k+"}"] = v
+			}
+			allocs, _, aerr := m.client.Nodes().Allocations(stub.ID, nil)
+			if aerr != nil {
+				return nil, aerr
+			}
+			for _, a := range allocs {
+				if a == nil || a.ClientTerminalStatus() || a.ServerTerminalStatus() {
+					continue
+				}
+				nc.Allocations++
+				cpu, mem, ports := allocatedUsage(a.AllocatedResources)
+				usedCPU += cpu
+				usedMem += mem
+				usedPorts += ports
+			}
+		}
+		nc.CPUFree = max(nc.CPUTotal-usedCPU, 0)
+		nc.MemoryFreeMB = max(nc.MemoryTotalMB-usedMem, 0)
+		nc.PortsFree = max(nc.PortsTotal-usedPorts, 0)
+		fleet.Nodes = append(fleet.Nodes, nc)
+
+		if !nc.Eligible {
+			continue
+		}
+		dc := byDC[nc.Datacenter]
+		if dc == nil {
+			dc = &DatacenterCapacity{Datacenter: nc.Datacenter}
+			byDC[nc.Datacenter] = dc
+		}
+		dc.Nodes++
+		dc.CPUTotal += nc.CPUTotal
+		dc.CPUFree += nc.CPUFree
+		dc.MemoryTotalMB += nc.MemoryTotalMB
+		dc.MemoryFreeMB += nc.MemoryFreeMB
+		dc.PortsFree += nc.PortsFree
+	}
+	for _, dc := range byDC {
+		fleet.Datacenters = append(fleet.Datacenters, *dc)
+	}
+	sort.Slice(fleet.Datacenters, func(i, j int) bool { return fleet.Datacenters[i].Datacenter < fleet.Datacenters[j].Datacenter })
+	sort.Slice(fleet.Nodes, func(i, j int) bool { return fleet.Nodes[i].Name < fleet.Nodes[j].Name })
+	return fleet, nil
+}
+
+// nodeTargets các biến ${node.*} của node
+func nodeTargets(id, name, datacenter, class, pool string) map[string]string {
+	return map[string]string{
+		"${node.unique.id}":   id,
+		"${node.unique.name}": name,
+		"${node.datacenter}":  datacenter,
+		"${node.class}":       class,
+		"${node.pool}":        pool,
+	}
+}
+
+// allocatedUsage cộng CPU/memory của các task và số port đã cấp cho allocation
+func allocatedUsage(ar *api.AllocatedResources) (cpu, memoryMB, ports int) {
+	if ar == nil {
+		return 0, 0, 0
+	}
+	for _, tr := range ar.Tasks {
+		if tr == nil {
+			continue
+		}
+		cpu += int(tr.Cpu.CpuShares)
+		memoryMB += int(tr.Memory.MemoryMB)
+		for _, netr := range tr.Networks {
+			ports += len(netr.DynamicPorts)
+		}
+	}
+	// Shared.Ports phản chiếu lại port của group network nên chỉ đếm một trong hai
+	if len(ar.Shared.Ports) > 0 {
+		ports += len(ar.Shared.Ports)
+	} else {
+		for _, netr := range ar.Shared.Networks {
+			ports += len(netr.DynamicPorts)
+		}
+	}
+	return cpu, memoryMB, ports
+}
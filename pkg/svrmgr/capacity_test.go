@@ -0,0 +1,75 @@
+package svrmgr
+
+import "testing"
+
+// node tạo node eligible đủ chỗ cho 4 server 100MHz/128MB, kèm biến constraint
+func node(name, pool string, targets map[string]string) NodeCapacity {
+	t := nodeTargets(name, name, "dc1", "", pool)
+	for k, v := range targets {
+		t[k] = v
+	}
+	return NodeCapacity{
+		NodeID: name, Name: name, Datacenter: "dc1", NodePool: pool, Eligible: true,
+		CPUFree: 400, MemoryFreeMB: 512, PortsFree: 10, targets: t,
+	}
+}
+
+func TestFleetSlotsPlacement(t *testing.T) {
+	fleet := &FleetCapacity{Nodes: []NodeCapacity{
+		node("a", "default", map[string]string{"${attr.kernel.name}": "linux", "${meta.gpu}": "true"}),
+		node("b", "default", map[string]string{"${attr.kernel.name}": "linux"}),
+		node("c", "batch", map[string]string{"${attr.kernel.name}": "windows", "${meta.tags}": "x,y"}),
+	}}
+	fleet.Nodes[0].targets["${attr.cpu.numcores}"] = "16"
+	fleet.Nodes[1].targets["${attr.cpu.numcores}"] = "4"
+	fleet.Nodes[2].targets["${attr.cpu.numcores}"] = "8"
+	tests := []struct {
+		name string
+		p    Placement
+		want int
+	}{
+		{name: "no placement uses every node", want: 12},
+		{name: "node pool", p: Placement{NodePool: "batch"}, want: 4},
+		{name: "equality on attribute", p: Placement{Constraints: []Constraint{{Attribute: "${attr.kernel.name}", Value: "linux"}}}, want: 8},
+		{name: "meta missing fails equality", p: Placement{Constraints: []Constraint{{Attribute: "${meta.gpu}", Value: "true"}}}, want: 4},
+		{name: "not equal keeps nodes without the meta", p: Placement{Constraints: []Constraint{{Attribute: "${meta.gpu}", Operator: "!=", Value: "true"}}}, want: 8},
+		{name: "is_set", p: Placement{Constraints: []Constraint{{Attribute: "${meta.gpu}", Operator: "is_set"}}}, want: 4},
+		{name: "regexp on node name", p: Placement{Constraints: []Constraint{{Attribute: "${node.unique.name}", Operator: "regexp", Value: "^[ab]$"}}}, want: 8},
+		{name: "set_contains", p: Placement{Constraints: []Constraint{{Attribute: "${meta.tags}", Operator: "set_contains", Value: "y,x"}}}, want: 4},
+		{name: "set_contains_any", p: Placement{Constraints: []Constraint{{Attribute: "${meta.tags}", Operator: "set_contains_any", Value: "z,x"}}}, want: 4},
+		{name: "numeric greater than", p: Placement{Constraints: []Constraint{{Attribute: "${attr.cpu.numcores}", Operator: ">", Value: "9"}}}, want: 4},
+		{name: "numeric greater or equal", p: Placement{Constraints: []Constraint{{Attribute: "${attr.cpu.numcores}", Operator: ">=", Value: "8"}}}, want: 8},
+		{name: "numeric less than", p: Placement{Constraints: []Constraint{{Attribute: "${attr.cpu.numcores}", Operator: "<", Value: "10"}}}, want: 8},
+		{name: "numeric less or equal with decimals", p: Placement{Constraints: []Constraint{{Attribute: "${attr.cpu.numcores}", Operator: "<=", Value: "4.0"}}}, want: 4},
+		{name: "non-numeric compares lexically", p: Placement{Constraints: []Constraint{{Attribute: "${attr.kernel.name}", Operator: ">", Value: "m"}}}, want: 4},
+		{name: "constraints and pool combined", p: Placement{NodePool: "batch", Constraints: []Constraint{{Attribute: "${attr.kernel.name}", Value: "linux"}}}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fleet.Slots(100, 128, tt.p); got != tt.want {
+				t.Fatalf("slots = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFleetReservePlacement(t *testing.T) {
+	fleet := &FleetCapacity{Nodes: []NodeCapacity{
+		node("a", "default", map[string]string{"${meta.gpu}": "true"}),
+		node("b", "default", nil),
+	}}
+	// node b còn trống nhiều hơn nhưng không thoả constraint → chỉ được giữ chỗ trên a
+	fleet.Nodes[1].MemoryFreeMB = 4096
+	gpu := Placement{Constraints: []Constraint{{Attribute: "${meta.gpu}", Value: "true"}}}
+	for i := 0; i < 4; i++ {
+		if !fleet.Reserve(100, 128, gpu) {
+			t.Fatalf("reserve %d failed", i)
+		}
+	}
+	if fleet.Reserve(100, 128, gpu) {
+		t.Fatal("reserve succeeded beyond the capacity of matching nodes")
+	}
+	if fleet.Nodes[1].MemoryFreeMB != 4096 {
+		t.Fatalf("non-matching node was reserved: %+v", fleet.Nodes[1])
+	}
+}
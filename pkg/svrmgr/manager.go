@@ -13,7 +13,9 @@ import (
 type Manager struct {
 	client      *api.Client
 	datacenters []string
-	bearerToken string
+	addr        addressResolver
+	owner       string // Meta owner của job (nhóm agent dùng chung Redis)
+	agentID     string // Meta agent_id: agent đã tạo job
 }
 
 // SetDatacenters sets the datacenters for Nomad jobs
@@ -21,36 +23,22 @@ func (m *Manager) SetDatacenters(datacenters []string) {
 	m.datacenters = datacenters
 }
 
-// SetBearerToken sets bearer token to inject to server args
-func (m *Manager) SetBearerToken(token string) { m.bearerToken = token }
-
-// IP mapping config - should be loaded from config
-type IPMapping struct {
-	PrivateIP string `json:"private_ip"`
-	PublicIP  string `json:"public_ip"`
-}
-
-// IPMappingConfig holds IP mapping configuration
-type IPMappingConfig struct {
-	Mappings []IPMapping `json:"mappings"`
+// SetJobOwner gắn owner/agent_id vào Meta của job để reconciler nhận đúng job của mình
+func (m *Manager) SetJobOwner(owner, agentID string) {
+	m.owner = owner
+	m.agentID = agentID
 }
 
-// Default empty mapping - should be populated from config
-var ipMappingConfig = &IPMappingConfig{
-	Mappings: []IPMapping{},
-}
-
-// SetIPMappingConfig sets the IP mapping configuration. If none provided,
-// use a sensible default mapping for production.
-func SetIPMappingConfig(config *IPMappingConfig) {
-	if config != nil && len(config.Mappings) > 0 {
-		ipMappingConfig = config
-		return
+// jobMeta Meta chuẩn của job game server: room_id, owner, agent_id, created_at
+func (m *Manager) jobMeta(roomID string) map[string]string {
+	meta := map[string]string{"room_id": roomID, "created_at": time.Now().UTC().Format(time.RFC3339)}
+	if m.owner != "" {
+		meta["owner"] = m.owner
 	}
-	// Fallback default when no ENV/IP mappings provided
-	ipMappingConfig = &IPMappingConfig{
-		Mappings: []IPMapping{{PrivateIP: "172.26.15.163", PublicIP: "52.221.213.97"}},
+	if m.agentID != "" {
+		meta["agent_id"] = m.agentID
 	}
+	return meta
 }
 
 // RoomInfo mô tả thông tin phân bổ của một room/job
@@ -59,6 +47,8 @@ type RoomInfo struct {
 	AllocationID string         `json:"allocation_id"`
 	NodeID       string         `json:"node_id"`
 	HostIP       string         `json:"host_ip"`
+	Hostname     string         `json:"hostname,omitempty"` // khi địa chỉ public là DNS name
+	AddressFrom  string         `json:"address_source,omitempty"`
 	Ports        map[string]int `json:"ports"`
 }
 
@@ -118,7 +108,7 @@ func (m *Manager) PlanJob(job *api.Job) (bool, string, error) {
 		return false, "plan_no_response", nil
 	}
 	if len(resp.FailedTGAllocs) > 0 {
-		return false, "insufficient_resources", nil
+		return false, describePlanFailure(resp.FailedTGAllocs), nil
 	}
 	return true, "", nil
 }
@@ -129,8 +119,8 @@ func (m *Manager) DeregisterJob(roomID string, purge bool) error {
 	return err
 }
 
-// RunGameServer tạo và đăng ký một batch job cho game server với dynamic port
-func (m *Manager) RunGameServer(roomID string) error {
+// RunGameServer tạo và đăng ký một batch job cho game server với dynamic port; token là token callback riêng của room
+func (m *Manager) RunGameServer(roomID, token string) error {
 	jobName := fmt.Sprintf("game-server-%s", roomID)
 	jobType := "batch"
 	count := 1
@@ -142,12 +132,8 @@ func (m *Manager) RunGameServer(roomID string) error {
 	tg := api.NewTaskGroup(gName, count)
 	task := api.NewTask(taskName, driver)
 	task.SetConfig("command", "/usr/local/bin/boardserver/server.x86_64")
-	// args: 1) dynamic port 2) roomID 3) bearer token
-	bearer := m.bearerToken
-	if bearer == "" {
-		bearer = "1234abcd"
-	}
-	task.SetConfig("args", []string{"-port", "${NOMAD_PORT_http}", "-serverId", roomID, "-token", bearer, "-nographics", "-batchmode"})
+	// args: 1) dynamic port 2) roomID 3) token của room
+	task.SetConfig("args", []string{"-port", "${NOMAD_PORT_http}", "-serverId", roomID, "-token", token, "-nographics", "-batchmode"})
 
 	// Log rotation config
 	maxFiles := 5
@@ -192,6 +178,7 @@ func (m *Manager) RunGameServer(roomID string) error {
 		Type:        &jobType,
 		Datacenters: m.datacenters, // Set from config
 		TaskGroups:  []*api.TaskGroup{tg},
+		Meta:        m.jobMeta(roomID),
 	}
 
 	// Plan trước khi register
@@ -207,8 +194,49 @@ func (m *Manager) RunGameServer(roomID string) error {
 	return err
 }
 
+// JobTemplate mô tả job game server: resources, command, arguments, placement và meta
+type JobTemplate struct {
+	Command   string
+	Args      []string
+	CPU       int
+	MemoryMB  int
+	DiskMB    int // ephemeral disk của group (chứa artifact đã giải nén), 0 = mặc định Nomad
+	Placement Placement
+	Meta      map[string]string // ghép vào job Meta (ví dụ build_version, queue)
+	Artifacts []Artifact        // tải về task dir trước khi chạy; Command khi đó là đường dẫn tương đối
+	Env       map[string]string // biến môi trường của task (ví dụ HIVE_JOIN_KEY)
+	Token     string            // token callback riêng của room, dùng cho args mặc định (-token) khi Args rỗng
+}
+
 // RunGameServerV2 tạo và đăng ký một batch job cho game server với tùy chỉnh resources, command và arguments
 func (m *Manager) RunGameServerV2(roomID string, cpu int, memoryMB int, command string, args []string) error {
+	return m.RunGameServerTemplate(roomID, JobTemplate{Command: command, Args: args, CPU: cpu, MemoryMB: memoryMB})
+}
+
+// RunGameServerTemplate tạo và đăng ký batch job theo template (bao gồm constraints/affinities/spreads/node pool)
+func (m *Manager) RunGameServerTemplate(roomID string, tpl JobTemplate) error {
+	for _, a := range tpl.Artifacts {
+		if err := a.Validate(); err != nil {
+			return err
+		}
+	}
+	job := m.buildJob(roomID, tpl)
+
+	// Plan trước khi register
+	ok, reason, err := m.PlanJob(job)
+	if err != nil {
+		return fmt.Errorf("nomad plan error: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("nomad plan rejected: %s", reason)
+	}
+
+	_, _, err = m.client.Jobs().Register(job, nil)
+	return err
+}
+
+// buildJob dựng api.Job từ template
+func (m *Manager) buildJob(roomID string, tpl JobTemplate) *api.Job {
 	jobName := fmt.Sprintf("game-server-%s", roomID)
 	jobType := "batch"
 	count := 1
@@ -219,17 +247,17 @@ func (m *Manager) RunGameServerV2(roomID string, cpu int, memoryMB int, command
 	// Task group & task
 	tg := api.NewTaskGroup(tgName, count)
 	task := api.NewTask(taskName, driver)
-	task.SetConfig("command", command)
+	task.SetConfig("command", tpl.Command)
 
 	// Use custom args if provided, otherwise default to port and roomID
-	if len(args) > 0 {
-		task.SetConfig("args", args)
+	if len(tpl.Args) > 0 {
+		task.SetConfig("args", tpl.Args)
 	} else {
-		bearer := m.bearerToken
-		if bearer == "" {
-			bearer = "1234abcd"
+		args := []string{"-port", "${NOMAD_PORT_http}", "-session=", roomID}
+		if tpl.Token != "" {
+			args = append(args, "-token", tpl.Token)
 		}
-		task.SetConfig("args", []string{"-port", "${NOMAD_PORT_http}", "-session=", roomID, "-token", bearer, "-nographics", "-batchmode"})
+		task.SetConfig("args", append(args, "-nographics", "-batchmode"))
 	}
 
 	// Log rotation config
@@ -251,6 +279,8 @@ func (m *Manager) RunGameServerV2(roomID string, cpu int, memoryMB int, command
 	}
 
 	// Resources with custom CPU, Memory and Disk
+	cpu := tpl.CPU
+	memoryMB := tpl.MemoryMB
 	diskMB := 10
 	resources := &api.Resources{
 		CPU:      &cpu,
@@ -266,7 +296,24 @@ func (m *Manager) RunGameServerV2(roomID string, cpu int, memoryMB int, command
 	}
 	task.Require(resources)
 
+	// Env của task (HIVE_ROOM_ID, HIVE_TOKEN, HIVE_JOIN_KEY...): server đọc cấu hình svrsdk từ đây
+	if len(tpl.Env) > 0 {
+		task.Env = make(map[string]string, len(tpl.Env))
+		for k, v := range tpl.Env {
+			task.Env[k] = v
+		}
+	}
+
+	// Artifact: Nomad client tải + xác thực checksum cho mỗi allocation
+	for _, a := range tpl.Artifacts {
+		task.Artifacts = append(task.Artifacts, a.toNomad())
+	}
+
 	tg.Tasks = []*api.Task{task}
+	if tpl.DiskMB > 0 {
+		disk := tpl.DiskMB
+		tg.EphemeralDisk = &api.EphemeralDisk{SizeMB: &disk}
+	}
 
 	job := &api.Job{
 		ID:          &roomID,
@@ -274,20 +321,13 @@ func (m *Manager) RunGameServerV2(roomID string, cpu int, memoryMB int, command
 		Type:        &jobType,
 		Datacenters: m.datacenters,
 		TaskGroups:  []*api.TaskGroup{tg},
-		Meta:        map[string]string{"created_at": time.Now().UTC().Format(time.RFC3339)},
-	}
-
-	// Plan trước khi register
-	ok, reason, err := m.PlanJob(job)
-	if err != nil {
-		return fmt.Errorf("nomad plan error: %w", err)
+		Meta:        m.jobMeta(roomID),
 	}
-	if !ok {
-		return fmt.Errorf("nomad plan rejected: %s", reason)
+	for k, v := range tpl.Meta {
+		job.Meta[k] = v
 	}
-
-	_, _, err = m.client.Jobs().Register(job, nil)
-	return err
+	tpl.Placement.applyTo(job)
+	return job
 }
 
 // GetRoomInfo trả về IP host và cổng được Nomad cấp phát dựa trên JobID (roomID)
@@ -357,40 +397,28 @@ func (m *Manager) GetRoomInfo(roomID string) (*RoomInfo, error) {
 		}
 	}
 
-	nodeIP := ""
+	nodeIP, hostname, source := "", "", ""
 	if alloc != nil && alloc.NodeID != "" {
 		n, _, nerr := m.client.Nodes().Info(alloc.NodeID, nil)
 		if nerr == nil && n != nil {
-			// Ưu tiên attribute phổ biến
-			if ip, ok := n.Attributes["unique.network.ip-address"]; ok && ip != "" {
-				nodeIP = ip
-			} else if addr := n.HTTPAddr; addr != "" {
-				host, _, _ := net.SplitHostPort(addr)
-				if host == "" {
-					// Fallback nếu không có port
-					parts := strings.Split(addr, ":")
-					if len(parts) > 0 {
-						host = parts[0]
-					}
+			nodeIP, source = m.addr.resolve(n)
+			// Địa chỉ là hostname → giữ hostname cho client, HostIP là IP phân giải được (hoặc chính hostname)
+			if nodeIP != "" && net.ParseIP(nodeIP) == nil {
+				hostname = nodeIP
+				if ip := lookupHost(hostname); ip != "" {
+					nodeIP = ip
 				}
-				nodeIP = host
 			}
 		}
 	}
 
-	// Áp dụng map private->public nếu có
-	for _, mapping := range ipMappingConfig.Mappings {
-		if mapping.PrivateIP == nodeIP && mapping.PublicIP != "" {
-			nodeIP = mapping.PublicIP
-			break
-		}
-	}
-
 	info := &RoomInfo{
 		RoomID:       roomID,
 		AllocationID: chosen.ID,
 		NodeID:       alloc.NodeID,
 		HostIP:       nodeIP,
+		Hostname:     hostname,
+		AddressFrom:  source,
 		Ports:        ports,
 	}
 	return info, nil
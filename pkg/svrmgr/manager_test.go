@@ -0,0 +1,43 @@
+package svrmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildJobTaskEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[string]string
+	}{
+		{name: "no env", env: nil, want: nil},
+		{
+			name: "env reaches the task",
+			env:  map[string]string{"HIVE_ROOM_ID": "r1", "HIVE_TOKEN": "tok", "HIVE_JOIN_KEY": "key"},
+			want: map[string]string{"HIVE_ROOM_ID": "r1", "HIVE_TOKEN": "tok", "HIVE_JOIN_KEY": "key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{datacenters: []string{"dc1"}}
+			job := m.buildJob("r1", JobTemplate{Command: "server", CPU: 100, MemoryMB: 128, Env: tt.env})
+			if len(job.TaskGroups) != 1 || len(job.TaskGroups[0].Tasks) != 1 {
+				t.Fatalf("job has %d task groups, want 1 group with 1 task", len(job.TaskGroups))
+			}
+			got := job.TaskGroups[0].Tasks[0].Env
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("task env = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildJobEnvIsCopied(t *testing.T) {
+	env := map[string]string{"HIVE_ROOM_ID": "r1"}
+	job := (&Manager{}).buildJob("r1", JobTemplate{Command: "server", Env: env})
+	env["HIVE_ROOM_ID"] = "changed"
+	if got := job.TaskGroups[0].Tasks[0].Env["HIVE_ROOM_ID"]; got != "r1" {
+		t.Fatalf("task env aliases the template map: HIVE_ROOM_ID = %q", got)
+	}
+}
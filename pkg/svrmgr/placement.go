@@ -0,0 +1,240 @@
+package svrmgr
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hive/pkg/config"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Constraint ánh xạ tới stanza constraint của Nomad (ví dụ ${node.class} = highcpu)
+type Constraint struct {
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator,omitempty"` // mặc định "="
+	Value     string `json:"value"`
+}
+
+// Affinity ánh xạ tới stanza affinity (ưu tiên mềm, weight -100..100)
+type Affinity struct {
+	Attribute string `json:"attribute"`
+	Operator  string `json:"operator,omitempty"`
+	Value     string `json:"value"`
+	Weight    int8   `json:"weight"`
+}
+
+// SpreadTarget phần trăm mong muốn cho một giá trị của attribute
+type SpreadTarget struct {
+	Value   string `json:"value"`
+	Percent uint8  `json:"percent"`
+}
+
+// Spread ánh xạ tới stanza spread (phân tán alloc theo attribute)
+type Spread struct {
+	Attribute string         `json:"attribute"`
+	Weight    int8           `json:"weight"`
+	Targets   []SpreadTarget `json:"targets,omitempty"`
+}
+
+// Placement gom các ràng buộc đặt job: node pool, constraints, affinities, spreads
+type Placement struct {
+	NodePool    string       `json:"node_pool,omitempty"`
+	Constraints []Constraint `json:"constraints,omitempty"`
+	Affinities  []Affinity   `json:"affinities,omitempty"`
+	Spreads     []Spread     `json:"spreads,omitempty"`
+}
+
+// PlacementFromConfig chuyển placement của queue trong config sang svrmgr
+func PlacementFromConfig(p config.PlacementConfig) Placement {
+	out := Placement{NodePool: p.NodePool}
+	for _, c := range p.Constraints {
+		out.Constraints = append(out.Constraints, Constraint(c))
+	}
+	for _, a := range p.Affinities {
+		out.Affinities = append(out.Affinities, Affinity(a))
+	}
+	for _, sp := range p.Spreads {
+		spread := Spread{Attribute: sp.Attribute, Weight: sp.Weight}
+		for _, t := range sp.Targets {
+			spread.Targets = append(spread.Targets, SpreadTarget(t))
+		}
+		out.Spreads = append(out.Spreads, spread)
+	}
+	return out
+}
+
+// IsZero cho biết placement không có ràng buộc nào
+func (p Placement) IsZero() bool {
+	return p.NodePool == "" && len(p.Constraints) == 0 && len(p.Affinities) == 0 && len(p.Spreads) == 0
+}
+
+// applyTo gắn placement vào job ở cấp job
+func (p Placement) applyTo(job *api.Job) {
+	if p.NodePool != "" {
+		pool := p.NodePool
+		job.NodePool = &pool
+	}
+	for _, c := range p.Constraints {
+		job.Constrain(api.NewConstraint(c.Attribute, operatorOrDefault(c.Operator), c.Value))
+	}
+	for _, a := range p.Affinities {
+		job.AddAffinity(api.NewAffinity(a.Attribute, operatorOrDefault(a.Operator), a.Value, a.Weight))
+	}
+	for _, s := range p.Spreads {
+		targets := make([]*api.SpreadTarget, 0, len(s.Targets))
+		for _, t := range s.Targets {
+			targets = append(targets, api.NewSpreadTarget(t.Value, t.Percent))
+		}
+		job.AddSpread(api.NewSpread(s.Attribute, s.Weight, targets))
+	}
+}
+
+// admits kiểm tra node thoả node pool và mọi constraint của placement, như bước lọc của scheduler.
+// Operator không đánh giá được ở đây (version, semver, distinct_*) coi như thoả; Plan vẫn là chốt chặn cuối.
+func (p Placement) admits(n NodeCapacity) bool {
+	if p.NodePool != "" && n.NodePool != p.NodePool {
+		return false
+	}
+	for _, c := range p.Constraints {
+		if !c.satisfiedBy(n.targets) {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfiedBy đánh giá constraint trên các biến của node; thiếu biến → không thoả (trừ !=, is_not_set)
+func (c Constraint) satisfiedBy(targets map[string]string) bool {
+	lVal, lOK := resolveTarget(c.Attribute, targets)
+	rVal, rOK := resolveTarget(c.Value, targets)
+	switch operatorOrDefault(c.Operator) {
+	case "=", "==", "is":
+		return lOK && rOK && lVal == rVal
+	case "!=", "not":
+		return !lOK || !rOK || lVal != rVal
+	case "<":
+		return lOK && rOK && compareValues(lVal, rVal) < 0
+	case "<=":
+		return lOK && rOK && compareValues(lVal, rVal) <= 0
+	case ">":
+		return lOK && rOK && compareValues(lVal, rVal) > 0
+	case ">=":
+		return lOK && rOK && compareValues(lVal, rVal) >= 0
+	case "is_set":
+		return lOK
+	case "is_not_set":
+		return !lOK
+	case "regexp":
+		if !lOK || !rOK {
+			return false
+		}
+		re, err := regexp.Compile(rVal)
+		return err == nil && re.MatchString(lVal)
+	case "set_contains", "set_contains_all":
+		return lOK && rOK && setContains(lVal, rVal, true)
+	case "set_contains_any":
+		return lOK && rOK && setContains(lVal, rVal, false)
+	}
+	return true
+}
+
+// compareValues so sánh theo số khi cả hai vế parse được (vd. "10" > "9"), ngược lại so chuỗi
+func compareValues(lVal, rVal string) int {
+	l, lErr := strconv.ParseFloat(lVal, 64)
+	r, rErr := strconv.ParseFloat(rVal, 64)
+	if lErr == nil && rErr == nil {
+		return cmp.Compare(l, r)
+	}
+	return strings.Compare(lVal, rVal)
+}
+
+// resolveTarget trả giá trị của ${...} trên node, hoặc chính chuỗi nếu là literal
+func resolveTarget(s string, targets map[string]string) (string, bool) {
+	if !strings.HasPrefix(s, "${") {
+		return s, true
+	}
+	v, ok := targets[s]
+	return v, ok
+}
+
+// setContains: lVal/rVal là danh sách ngăn cách bởi dấu phẩy; all=true → lVal chứa mọi phần tử của rVal
+func setContains(lVal, rVal string, all bool) bool {
+	have := map[string]bool{}
+	for _, v := range strings.Split(lVal, ",") {
+		have[strings.TrimSpace(v)] = true
+	}
+	for _, v := range strings.Split(rVal, ",") {
+		if have[strings.TrimSpace(v)] != all {
+			return !all
+		}
+	}
+	return all
+}
+
+func operatorOrDefault(op string) string {
+	if op == "" {
+		return "="
+	}
+	return op
+}
+
+// Lý do plan bị từ chối (tiền tố của reason trả về từ PlanJob)
+const (
+	PlanReasonInsufficientResources = "insufficient_resources"
+	PlanReasonConstraintFiltered    = "constraint_filtered"
+	PlanReasonNodePoolEmpty         = "node_pool_empty"
+)
+
+// describePlanFailure tóm tắt FailedTGAllocs thành reason dễ đọc,
+// ví dụ "constraint_filtered: ${node.class} = highcpu (3 nodes)". Thứ tự ưu tiên:
+// node pool rỗng > chỉ bị constraint lọc > có node thiếu tài nguyên > insufficient_resources chung.
+func describePlanFailure(failed map[string]*api.AllocationMetric) string {
+	constraints := map[string]int{}
+	dimensions := map[string]int{}
+	evaluated := 0
+	emptyPool := ""
+	for _, metric := range failed {
+		if metric == nil {
+			continue
+		}
+		evaluated += metric.NodesEvaluated
+		if metric.NodesInPool == 0 && metric.NodePool != "" {
+			emptyPool = metric.NodePool
+		}
+		for k, v := range metric.ConstraintFiltered {
+			constraints[k] += v
+		}
+		for k, v := range metric.DimensionExhausted {
+			dimensions[k] += v
+		}
+	}
+	if emptyPool != "" && evaluated == 0 {
+		return fmt.Sprintf("%s: %s", PlanReasonNodePoolEmpty, emptyPool)
+	}
+	// Mọi node bị constraint lọc → lỗi cấu hình; có node hợp lệ nhưng hết tài nguyên thì báo thiếu tài nguyên
+	if len(constraints) > 0 && len(dimensions) == 0 {
+		return fmt.Sprintf("%s: %s", PlanReasonConstraintFiltered, joinCounts(constraints))
+	}
+	if len(dimensions) > 0 {
+		return fmt.Sprintf("%s: %s", PlanReasonInsufficientResources, joinCounts(dimensions))
+	}
+	return PlanReasonInsufficientResources
+}
+
+func joinCounts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s (%d nodes)", k, m[k]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,51 @@
+package svrsdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// PlayerAssignment một player được ghép vào room
+type PlayerAssignment struct {
+	PlayerID   string            `json:"player_id"`
+	TicketID   string            `json:"ticket_id,omitempty"` // agent không còn gửi (ticket_id là bí mật của player)
+	Team       string            `json:"team"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Assignment thông tin trận agent giao cho server: player, team, queue, properties
+type Assignment struct {
+	RoomID       string              `json:"room_id"`
+	Status       string              `json:"status"`
+	Queue        string              `json:"queue,omitempty"`
+	Region       string              `json:"region,omitempty"`
+	BuildVersion string              `json:"build_version,omitempty"`
+	Players      []PlayerAssignment  `json:"players"`
+	Teams        map[string][]string `json:"teams"`
+	Properties   map[string]string   `json:"properties,omitempty"`
+	// ReconnectWindowSeconds player rớt mạng được quay lại trong bao lâu (0 = không cho reconnect)
+	ReconnectWindowSeconds int `json:"reconnect_window_seconds,omitempty"`
+}
+
+// FetchAssignment lấy assignment của room (GET /rooms/:room_id/assignment); gọi lúc khởi động, trước Ready()
+func (c *Client) FetchAssignment(ctx context.Context) (*Assignment, error) {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return nil, fmt.Errorf("missing required config for assignment")
+	}
+	var a Assignment
+	if err := c.call(ctx, http.MethodGet, "assignment", nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Player trả assignment của player; false = player không thuộc room (server nên từ chối)
+func (a *Assignment) Player(playerID string) (PlayerAssignment, bool) {
+	for _, p := range a.Players {
+		if p.PlayerID == playerID {
+			return p, true
+		}
+	}
+	return PlayerAssignment{}, false
+}
@@ -0,0 +1,70 @@
+package svrsdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Backfill yêu cầu bổ sung player của room; player được ghép nhận địa chỉ room này và có trong assignment
+type Backfill struct {
+	BackfillID string   `json:"backfill_id"`
+	Slots      int      `json:"slots"` // chỗ còn trống
+	Team       string   `json:"team,omitempty"`
+	Filled     []string `json:"filled,omitempty"` // player đã được ghép vào
+	Status     string   `json:"status"`           // OPENED|FILLED|CANCELED
+}
+
+type backfillRequest struct {
+	Slots int    `json:"slots"`
+	Team  string `json:"team,omitempty"`
+}
+
+type backfillResponse struct {
+	Backfill *Backfill `json:"backfill"`
+}
+
+// RequestBackfill xin thêm slots player cho room đang chạy (POST /rooms/:room_id/backfill); team rỗng = team ít người nhất.
+// Gọi lại thay số slot và gia hạn backfill đang mở. Player mới xuất hiện trong FetchAssignment khi được ghép.
+func (c *Client) RequestBackfill(ctx context.Context, slots int, team string) (*Backfill, error) {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return nil, errors.New("missing required config for backfill")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var out backfillResponse
+	if err := c.call(ctx, http.MethodPost, "backfill", backfillRequest{Slots: slots, Team: team}, &out); err != nil {
+		return nil, err
+	}
+	return out.Backfill, nil
+}
+
+// BackfillStatus trả backfill đang mở của room; không có → *StatusError 404 NO_BACKFILL (xem IsNoBackfill)
+func (c *Client) BackfillStatus(ctx context.Context) (*Backfill, error) {
+	return c.backfill(ctx, http.MethodGet)
+}
+
+// CancelBackfill huỷ backfill đang mở (ví dụ trận sắp kết thúc)
+func (c *Client) CancelBackfill(ctx context.Context) (*Backfill, error) {
+	return c.backfill(ctx, http.MethodDelete)
+}
+
+func (c *Client) backfill(ctx context.Context, method string) (*Backfill, error) {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return nil, errors.New("missing required config for backfill")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var out backfillResponse
+	if err := c.call(ctx, method, "backfill", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Backfill, nil
+}
+
+// IsNoBackfill room không còn backfill mở (đã đủ, đã huỷ hoặc hết hạn)
+func IsNoBackfill(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound && se.ErrorCode == "NO_BACKFILL"
+}
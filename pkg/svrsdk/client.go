@@ -1,7 +1,15 @@
 package svrsdk
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
 )
 
 type Option func(*Client)
@@ -12,16 +20,28 @@ type Client struct {
 	mws      []Middleware
 	final    ShutdownHandler
 	notifier ShutdownNotifier
+
+	// shutdown chỉ một lần: dispatch tuần tự, done đóng khi event đã tới final handler
+	dispatchMu sync.Mutex
+	mu         sync.Mutex
+	done       chan struct{}
+	shutdown   *ShutdownEvent
 }
 
+// ErrAlreadyShutdown trả về khi đã có shutdown đi hết pipeline trước đó
+var ErrAlreadyShutdown = errors.New("shutdown already sent")
+
+// ErrShutdownCancelled trả về khi middleware chọn DecisionCancel
+var ErrShutdownCancelled = errors.New("shutdown cancelled by middleware")
+
 func Init(cfg Config, opts ...Option) *Client {
-	c := &Client{cfg: cfg}
+	c := &Client{cfg: cfg, done: make(chan struct{})}
 	for _, o := range opts {
 		o(c)
 	}
 	// default notifier & final handler
 	if c.notifier == nil {
-		c.notifier = &AgentNotifier{}
+		c.notifier = &AgentNotifier{SpoolDir: cfg.SpoolDir}
 	}
 	if c.final == nil {
 		c.final = func(sc *ShutdownContext) ShutdownResult {
@@ -37,23 +57,70 @@ func (c *Client) Use(mw Middleware)                 { c.mws = append(c.mws, mw)
 func (c *Client) SetFinalHandler(h ShutdownHandler) { c.final = h }
 func (c *Client) SetNotifier(n ShutdownNotifier)    { c.notifier = n }
 
-// build pipeline từ middleware -> final
-func (c *Client) buildPipeline() ShutdownHandler {
-	h := c.final
+// Done đóng khi shutdown đã đi tới final handler (đã báo agent)
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// ShutdownEvent trả event đã gửi (nil khi chưa shutdown)
+func (c *Client) ShutdownEvent() *ShutdownEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.shutdown
+}
+
+// build pipeline từ middleware -> final.
+// Middleware trả DecisionModify kèm Event (không tự gọi next) → client tiếp tục pipeline với event mới;
+// DecisionCancel → dừng, không shutdown; DecisionContinue → kết quả của next.
+func (c *Client) buildPipeline(reached *bool) ShutdownHandler {
+	h := func(sc *ShutdownContext) ShutdownResult {
+		*reached = true
+		return c.final(sc)
+	}
 	for i := len(c.mws) - 1; i >= 0; i-- {
-		h = c.mws[i](h)
+		h = applyModify(c.mws[i], h)
 	}
 	return h
 }
 
+func applyModify(mw Middleware, next ShutdownHandler) ShutdownHandler {
+	inner := mw(next)
+	return func(sc *ShutdownContext) ShutdownResult {
+		res := inner(sc)
+		if res.Decision == DecisionModify && res.Event != nil {
+			sc.Event = res.Event
+			return next(sc)
+		}
+		return res
+	}
+}
+
+// dispatch chạy một event qua pipeline; đảm bảo chỉ một shutdown tới được final handler
+func (c *Client) dispatch(ev ShutdownEvent) error {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+	if c.ShutdownEvent() != nil {
+		return ErrAlreadyShutdown
+	}
+	sc := &ShutdownContext{Ctx: context.Background(), Config: c.cfg, Event: &ev}
+	reached := false
+	res := c.buildPipeline(&reached)(sc)
+	if !reached || res.Decision == DecisionCancel {
+		if res.Err != nil {
+			return res.Err
+		}
+		return ErrShutdownCancelled
+	}
+	c.mu.Lock()
+	c.shutdown = sc.Event
+	c.mu.Unlock()
+	close(c.done)
+	return res.Err
+}
+
 // Run khởi động tất cả sources, trả hàm stop
 func (c *Client) Run() (stop func()) {
 	stops := make([]func(), 0, len(c.sources))
 	emit := func(ev ShutdownEvent) {
-		ctx := &ShutdownContext{Ctx: context.Background(), Config: c.cfg, Event: &ev}
-		handler := c.buildPipeline()
-		res := handler(ctx)
-		_ = res // có thể ghi log/res ở trên layer ứng dụng
+		_ = c.dispatch(ev) // lỗi/cancel có thể ghi log ở middleware
 	}
 	for _, s := range c.sources {
 		stops = append(stops, s.Start(emit))
@@ -69,7 +136,50 @@ func (c *Client) Run() (stop func()) {
 func (c *Client) SendShutdownWithDetails(reason ShutdownReason, details map[string]any) error {
 	ev := NewEvent(reason)
 	ev.Details = details
-	ctx := &ShutdownContext{Ctx: context.Background(), Config: c.cfg, Event: &ev}
-	res := c.buildPipeline()(ctx)
-	return res.Err
+	return c.dispatch(ev)
+}
+
+// Ready báo agent server đã load xong và nhận client được (POST /rooms/:room_id/ready).
+// Agent chỉ chuyển room OPENED → ACTIVED sau callback này; quá ready timeout → DEAD(ready_timeout).
+func (c *Client) Ready(ctx context.Context) error {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return fmt.Errorf("missing required config for ready")
+	}
+	return c.post(ctx, "ready", map[string]any{"at": time.Now().Unix()})
+}
+
+// post gửi JSON tới /rooms/:room_id/<action> của agent với bearer token
+func (c *Client) post(ctx context.Context, action string, payload any) error {
+	return c.call(ctx, http.MethodPost, action, payload, nil)
+}
+
+// call gọi /rooms/:room_id/<action> của agent; out != nil → decode body JSON vào out
+func (c *Client) call(ctx context.Context, method, action string, payload, out any) error {
+	var body io.Reader
+	if payload != nil {
+		b, _ := json.Marshal(payload)
+		body = bytes.NewReader(b)
+	}
+	url := fmt.Sprintf("%s/rooms/%s/%s", c.cfg.AgentBaseURL, c.cfg.RoomID, action)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	hc := &http.Client{Timeout: 5 * time.Second}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError(resp)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
 }
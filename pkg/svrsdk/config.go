@@ -9,9 +9,11 @@ func FromEnvOrArgs(args []string) Config {
 	cfg := Config{
 		Port:         os.Getenv("HIVE_PORT"),
 		RoomID:       os.Getenv("HIVE_ROOM_ID"),
-		Token:        os.Getenv("HIVE_TOKEN"),
+		Token:        os.Getenv("HIVE_TOKEN"), // token callback riêng của room do agent cấp qua job env
 		AgentBaseURL: os.Getenv("HIVE_AGENT_BASE_URL"),
 		ServerPort:   os.Getenv("HIVE_SERVER_PORT"),
+		JoinKey:      os.Getenv("HIVE_JOIN_KEY"),
+		SpoolDir:     os.Getenv("HIVE_SPOOL_DIR"),
 	}
 	// Backward-compatible fallback
 	if cfg.AgentBaseURL == "" {
@@ -51,8 +53,5 @@ func FromEnvOrArgs(args []string) Config {
 	if cfg.AgentBaseURL == "" {
 		cfg.AgentBaseURL = "http://127.0.0.1:8080"
 	}
-	if cfg.Token == "" {
-		cfg.Token = "1234abcd"
-	}
 	return cfg
 }
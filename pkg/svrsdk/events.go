@@ -0,0 +1,41 @@
+package svrsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Event giữa trận thường gặp; type tự đặt được (chữ thường, số, '_', '.'; không bắt đầu bằng room_)
+const (
+	EventPlayerKicked      = "player_kicked"
+	EventPlayerAbandoned   = "player_abandoned"
+	EventRoundFinished     = "round_finished"
+	EventCheatingSuspected = "cheating_suspected"
+)
+
+type roomEvent struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	At      int64           `json:"at"`
+}
+
+// ReportEvent báo event giữa trận (POST /rooms/:room_id/events); payload là giá trị JSON bất kỳ (nil = không có).
+// Agent ghi vào event log của room và lifecycle stream; room không ACTIVED → *StatusError 409.
+func (c *Client) ReportEvent(ctx context.Context, eventType string, payload any) error {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return errors.New("missing required config for event")
+	}
+	ev := roomEvent{Type: eventType, At: time.Now().Unix()}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		ev.Payload = b
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return c.post(ctx, "events", ev)
+}
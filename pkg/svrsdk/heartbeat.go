@@ -0,0 +1,66 @@
+package svrsdk
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Heartbeat telemetry server gửi định kỳ về agent (POST /rooms/:room_id/heartbeat)
+type Heartbeat struct {
+	PlayerCount int      `json:"player_count"`
+	Players     []string `json:"players,omitempty"` // player đang kết nối
+	// player đang mất kết nối, còn trong reconnect window
+	Disconnected []string `json:"disconnected,omitempty"`
+	Phase        string   `json:"phase,omitempty"` // ví dụ lobby, playing, ending
+	TickRate     float64  `json:"tick_rate,omitempty"`
+	MemoryMB     float64  `json:"memory_mb,omitempty"` // 0 = SDK tự điền từ runtime
+	At           int64    `json:"at"`
+}
+
+// SendHeartbeat gửi một heartbeat; agent trả 409 nếu room chưa/không còn ACTIVED
+func (c *Client) SendHeartbeat(ctx context.Context, hb Heartbeat) error {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return fmt.Errorf("missing required config for heartbeat")
+	}
+	if hb.At == 0 {
+		hb.At = time.Now().Unix()
+	}
+	if hb.MemoryMB == 0 {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		hb.MemoryMB = float64(ms.Sys) / (1 << 20)
+	}
+	return c.post(ctx, "heartbeat", hb)
+}
+
+// StartHeartbeat gửi heartbeat mỗi interval với số liệu lấy từ collect; trả hàm stop.
+// Lỗi gửi bị bỏ qua (lần sau gửi lại); agent đánh DEAD(heartbeat_lost) nếu mất quá timeout.
+func (c *Client) StartHeartbeat(interval time.Duration, collect func() Heartbeat) (stop func()) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	send := func() {
+		var hb Heartbeat
+		if collect != nil {
+			hb = collect()
+		}
+		_ = c.SendHeartbeat(ctx, hb)
+	}
+	go func() {
+		send()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				send()
+			}
+		}
+	}()
+	return cancel
+}
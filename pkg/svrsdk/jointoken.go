@@ -0,0 +1,38 @@
+package svrsdk
+
+import (
+	"errors"
+	"time"
+
+	"hive/pkg/jointoken"
+)
+
+// ErrWrongRoom token hợp lệ nhưng cấp cho room khác
+var ErrWrongRoom = errors.New("join token issued for another room")
+
+// JoinVerifier xác thực offline join token player gửi khi kết nối (key dùng chung với agent: JOIN_TOKEN_KEY)
+type JoinVerifier struct {
+	key    []byte
+	roomID string
+	now    func() time.Time
+}
+
+// NewJoinVerifier tạo verifier cho room của server với Config.JoinKey (env HIVE_JOIN_KEY do agent truyền qua job)
+func (c *Client) NewJoinVerifier() *JoinVerifier {
+	return &JoinVerifier{key: []byte(c.cfg.JoinKey), roomID: c.cfg.RoomID, now: time.Now}
+}
+
+// Enabled cho biết server có key để xác thực (agent chưa cấu hình JOIN_TOKEN_KEY → false)
+func (v *JoinVerifier) Enabled() bool { return len(v.key) > 0 }
+
+// Verify trả player_id nếu token đúng chữ ký, còn hạn và cấp cho room này
+func (v *JoinVerifier) Verify(token string) (string, error) {
+	claims, err := jointoken.Verify(v.key, token, v.now())
+	if err != nil {
+		return "", err
+	}
+	if v.roomID != "" && claims.RoomID != v.roomID {
+		return "", ErrWrongRoom
+	}
+	return claims.PlayerID, nil
+}
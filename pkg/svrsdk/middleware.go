@@ -0,0 +1,90 @@
+package svrsdk
+
+import (
+	"sync"
+	"time"
+)
+
+// LoggingMiddleware log event và kết quả của pipeline
+func LoggingMiddleware(logf func(format string, args ...any)) Middleware {
+	return func(next ShutdownHandler) ShutdownHandler {
+		return func(sc *ShutdownContext) ShutdownResult {
+			logf("shutdown: reason=%s at=%d key=%s", sc.Event.Reason, sc.Event.At, sc.Event.IdempotencyKey)
+			res := next(sc)
+			switch {
+			case res.Decision == DecisionCancel:
+				logf("shutdown: %s cancelled", sc.Event.Reason)
+			case res.Err != nil:
+				logf("shutdown: %s failed: %v", sc.Event.Reason, res.Err)
+			default:
+				logf("shutdown: %s sent", sc.Event.Reason)
+			}
+			return res
+		}
+	}
+}
+
+// DebounceMiddleware hoãn event của reason thêm delay rồi hỏi lại stillValid;
+// điều kiện đã hết (ví dụ player vào lại trong grace trước no_clients) → DecisionCancel
+func DebounceMiddleware(reason ShutdownReason, delay time.Duration, stillValid func() bool) Middleware {
+	return func(next ShutdownHandler) ShutdownHandler {
+		return func(sc *ShutdownContext) ShutdownResult {
+			if sc.Event.Reason != reason || delay <= 0 {
+				return next(sc)
+			}
+			t := time.NewTimer(delay)
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-sc.Ctx.Done():
+				return ShutdownResult{Decision: DecisionCancel, Err: sc.Ctx.Err()}
+			}
+			if stillValid != nil && !stillValid() {
+				return ShutdownResult{Decision: DecisionCancel}
+			}
+			return next(sc)
+		}
+	}
+}
+
+// EnrichDetailsMiddleware gộp thêm details (player stats, thời lượng trận...) vào event; key đã có không bị ghi đè
+func EnrichDetailsMiddleware(fn func(ev ShutdownEvent) map[string]any) Middleware {
+	return func(next ShutdownHandler) ShutdownHandler {
+		return func(sc *ShutdownContext) ShutdownResult {
+			extra := fn(*sc.Event)
+			if len(extra) == 0 {
+				return next(sc)
+			}
+			ev := *sc.Event
+			ev.Details = make(map[string]any, len(sc.Event.Details)+len(extra))
+			for k, v := range extra {
+				ev.Details[k] = v
+			}
+			for k, v := range sc.Event.Details {
+				ev.Details[k] = v
+			}
+			return ShutdownResult{Decision: DecisionModify, Event: &ev}
+		}
+	}
+}
+
+// RateLimitMiddleware bỏ (DecisionCancel) event cùng reason lặp lại trong window,
+// tránh source emit liên tục khi event trước bị cancel
+func RateLimitMiddleware(window time.Duration) Middleware {
+	var mu sync.Mutex
+	last := map[ShutdownReason]time.Time{}
+	return func(next ShutdownHandler) ShutdownHandler {
+		return func(sc *ShutdownContext) ShutdownResult {
+			now := time.Now()
+			mu.Lock()
+			prev, seen := last[sc.Event.Reason]
+			if seen && now.Sub(prev) < window {
+				mu.Unlock()
+				return ShutdownResult{Decision: DecisionCancel}
+			}
+			last[sc.Event.Reason] = now
+			mu.Unlock()
+			return next(sc)
+		}
+	}
+}
@@ -3,15 +3,61 @@ package svrsdk
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	mrand "math/rand"
 	"net/http"
 	"time"
 )
 
-// AgentNotifier gửi shutdown event tới Agent REST API
+// AgentNotifier gửi shutdown event tới Agent REST API.
+// Lỗi mạng/5xx/429 được retry với exponential backoff + jitter; hết lượt mà có SpoolDir thì ghi event ra đĩa để replay sau.
 type AgentNotifier struct {
-	HTTP *http.Client
+	HTTP        *http.Client
+	MaxAttempts int           // mặc định 5
+	BaseDelay   time.Duration // mặc định 500ms, nhân đôi mỗi lần
+	MaxDelay    time.Duration // mặc định 8s
+	SpoolDir    string        // rỗng = không spool
+}
+
+// StatusError agent trả status không phải 2xx (kèm error_code/error của agent nếu đọc được)
+type StatusError struct {
+	Code      int
+	ErrorCode string
+	Message   string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("agent returned status %d: %s %s", e.Code, e.ErrorCode, e.Message)
+	}
+	return fmt.Sprintf("agent returned status %d", e.Code)
+}
+
+// statusError đọc body lỗi dạng {error_code, error} của agent
+func statusError(resp *http.Response) *StatusError {
+	se := &StatusError{Code: resp.StatusCode}
+	var body struct {
+		ErrorCode string `json:"error_code"`
+		Error     string `json:"error"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body) == nil {
+		se.ErrorCode, se.Message = body.ErrorCode, body.Error
+	}
+	return se
+}
+
+// Retryable: lỗi mạng, 5xx, 429 là tạm thời; 4xx còn lại (token sai, room không còn) thì gửi lại vô ích
+func Retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500 || se.Code == http.StatusTooManyRequests
+	}
+	return err != nil
 }
 
 func (n *AgentNotifier) client() *http.Client {
@@ -25,6 +71,60 @@ func (n *AgentNotifier) Notify(ctx context.Context, cfg Config, ev ShutdownEvent
 	if cfg.RoomID == "" || cfg.Token == "" || cfg.AgentBaseURL == "" {
 		return fmt.Errorf("missing required config for notifier")
 	}
+	if ev.IdempotencyKey == "" {
+		ev.IdempotencyKey = newIdempotencyKey()
+	}
+	err := n.sendWithRetry(ctx, cfg, ev)
+	if err != nil && Retryable(err) && n.SpoolDir != "" {
+		path, serr := spool(n.SpoolDir, cfg, ev)
+		if serr != nil {
+			return fmt.Errorf("%w (spool failed: %v)", err, serr)
+		}
+		return fmt.Errorf("%w (spooled to %s)", err, path)
+	}
+	return err
+}
+
+func (n *AgentNotifier) sendWithRetry(ctx context.Context, cfg Config, ev ShutdownEvent) error {
+	attempts := n.MaxAttempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = n.send(ctx, cfg, ev); err == nil || !Retryable(err) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(n.backoff(i)):
+		}
+	}
+	return err
+}
+
+// backoff full jitter trong [d/2, d], d = BaseDelay * 2^attempt (tối đa MaxDelay)
+func (n *AgentNotifier) backoff(attempt int) time.Duration {
+	base, maxDelay := n.BaseDelay, n.MaxDelay
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 8 * time.Second
+	}
+	d := base << attempt
+	if d > maxDelay || d <= 0 {
+		d = maxDelay
+	}
+	return d/2 + time.Duration(mrand.Int63n(int64(d/2)+1))
+}
+
+// send một lần POST /rooms/:room_id/shutdown; agent dedupe theo Idempotency-Key
+func (n *AgentNotifier) send(ctx context.Context, cfg Config, ev ShutdownEvent) error {
 	body, _ := json.Marshal(ev)
 	url := fmt.Sprintf("%s/rooms/%s/shutdown", cfg.AgentBaseURL, cfg.RoomID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
@@ -33,13 +133,20 @@ func (n *AgentNotifier) Notify(ctx context.Context, cfg Config, ev ShutdownEvent
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	req.Header.Set("Idempotency-Key", ev.IdempotencyKey)
 	resp, err := n.client().Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("agent returned status %d", resp.StatusCode)
+		return statusError(resp)
 	}
 	return nil
 }
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
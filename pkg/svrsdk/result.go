@@ -0,0 +1,57 @@
+package svrsdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// PlayerResult kết quả một player (placement 1 = nhất, cùng hạng = hoà)
+type PlayerResult struct {
+	PlayerID  string             `json:"player_id"`
+	Team      string             `json:"team,omitempty"`
+	Placement int                `json:"placement"`
+	Score     int                `json:"score"`
+	Stats     map[string]float64 `json:"stats,omitempty"`
+}
+
+// TeamResult kết quả một team
+type TeamResult struct {
+	Team      string `json:"team"`
+	Placement int    `json:"placement"`
+	Score     int    `json:"score"`
+}
+
+// MatchResult kết quả trận gửi agent; player/team phải khớp assignment của room
+type MatchResult struct {
+	Players         []PlayerResult `json:"players"`
+	Teams           []TeamResult   `json:"teams,omitempty"`
+	Winner          string         `json:"winner,omitempty"` // player_id hoặc team
+	DurationSeconds int64          `json:"duration_seconds"`
+	Abandoned       []string       `json:"abandoned,omitempty"`
+}
+
+// ReportResult gửi kết quả trận (POST /rooms/:room_id/result) trước khi shutdown; gọi lại được để cập nhật.
+// Kết quả sai roster → *StatusError 400 INVALID_RESULT (xem IsInvalidResult).
+func (c *Client) ReportResult(ctx context.Context, res MatchResult) error {
+	if c.cfg.RoomID == "" || c.cfg.AgentBaseURL == "" {
+		return errors.New("missing required config for result")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return c.post(ctx, "result", res)
+}
+
+// IsInvalidResult agent từ chối kết quả vì không khớp roster/assignment (gửi lại vô ích)
+func IsInvalidResult(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusBadRequest && se.ErrorCode == "INVALID_RESULT"
+}
+
+// SendShutdownWithResult shutdown kèm kết quả trận có kiểu (thường với ReasonGameCycleCompleted)
+func (c *Client) SendShutdownWithResult(reason ShutdownReason, res MatchResult) error {
+	ev := NewEvent(reason)
+	ev.Result = &res
+	return c.dispatch(ev)
+}
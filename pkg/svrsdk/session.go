@@ -0,0 +1,330 @@
+package svrsdk
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionState trạng thái kết nối của một player trên game server
+type SessionState string
+
+const (
+	SessionConnected    SessionState = "connected"    // heartbeat trong HeartbeatTTL
+	SessionDisconnected SessionState = "disconnected" // mất kết nối, còn trong ReconnectGrace
+	SessionLeft         SessionState = "left"         // hết grace hoặc rời hẳn (Leave)
+)
+
+// SessionEventType loại event gửi tới OnEvent
+type SessionEventType string
+
+const (
+	SessionEventConnected    SessionEventType = "connected"
+	SessionEventDisconnected SessionEventType = "disconnected"
+	SessionEventReconnected  SessionEventType = "reconnected"
+	SessionEventLeft         SessionEventType = "left"
+)
+
+// Session ảnh chụp trạng thái một player (thời gian dạng unix)
+type Session struct {
+	PlayerID       string       `json:"player_id"`
+	State          SessionState `json:"state"`
+	Expected       bool         `json:"expected"` // có trong roster (assignment)
+	ConnectedAt    int64        `json:"connected_at_unix"`
+	LastSeen       int64        `json:"last_seen_unix"`
+	DisconnectedAt int64        `json:"disconnected_at_unix,omitempty"`
+	Reconnects     int          `json:"reconnects"`
+}
+
+// SessionEvent event chuyển trạng thái session
+type SessionEvent struct {
+	Type    SessionEventType
+	Session Session
+}
+
+type session struct {
+	state          SessionState
+	connectedAt    time.Time
+	lastSeen       time.Time
+	disconnectedAt time.Time
+	reconnects     int
+}
+
+// SessionTracker theo dõi player qua heartbeat/kết nối: connected → disconnected (quá HeartbeatTTL hoặc Disconnect)
+// → left (quá ReconnectGrace hoặc Leave). Heartbeat trong grace → reconnected.
+// Timeout được áp dụng khi gọi Sweep (các hàm đọc tự gọi Sweep).
+type SessionTracker struct {
+	HeartbeatTTL   time.Duration
+	ReconnectGrace time.Duration
+	// OnEvent gọi ngoài lock, theo thứ tự xảy ra
+	OnEvent func(SessionEvent)
+	// Now thay được bằng fake clock khi test (mặc định time.Now)
+	Now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	expected map[string]bool
+}
+
+// NewSessionTracker tạo tracker với TTL heartbeat (mặc định 10s) và grace reconnect (0 = left ngay khi mất kết nối)
+func NewSessionTracker(heartbeatTTL, reconnectGrace time.Duration) *SessionTracker {
+	if heartbeatTTL <= 0 {
+		heartbeatTTL = 10 * time.Second
+	}
+	return &SessionTracker{
+		HeartbeatTTL:   heartbeatTTL,
+		ReconnectGrace: reconnectGrace,
+		sessions:       make(map[string]*session),
+		expected:       make(map[string]bool),
+	}
+}
+
+func (t *SessionTracker) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+// SetReconnectGrace đổi reconnect window (ví dụ theo Assignment.ReconnectWindowSeconds)
+func (t *SessionTracker) SetReconnectGrace(d time.Duration) {
+	t.mu.Lock()
+	t.ReconnectGrace = d
+	t.mu.Unlock()
+}
+
+// SetExpected đặt roster dự kiến (thường từ Assignment) để so với player thực tế
+func (t *SessionTracker) SetExpected(ids []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expected = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		t.expected[id] = true
+	}
+}
+
+// SetExpectedFromAssignment lấy roster từ Assignment của agent
+func (t *SessionTracker) SetExpectedFromAssignment(a *Assignment) {
+	if a == nil {
+		return
+	}
+	ids := make([]string, 0, len(a.Players))
+	for _, p := range a.Players {
+		ids = append(ids, p.PlayerID)
+	}
+	t.SetExpected(ids)
+}
+
+// Heartbeat ghi nhận player còn kết nối: player mới → connected, đang disconnected/left → reconnected
+func (t *SessionTracker) Heartbeat(pid string) {
+	now := t.now()
+	var evs []SessionEvent
+	t.mu.Lock()
+	evs = t.sweepLocked(now, evs)
+	s, ok := t.sessions[pid]
+	switch {
+	case !ok:
+		s = &session{state: SessionConnected, connectedAt: now, lastSeen: now}
+		t.sessions[pid] = s
+		evs = append(evs, SessionEvent{Type: SessionEventConnected, Session: t.viewLocked(pid, s)})
+	case s.state != SessionConnected:
+		s.state = SessionConnected
+		s.lastSeen = now
+		s.disconnectedAt = time.Time{}
+		s.reconnects++
+		evs = append(evs, SessionEvent{Type: SessionEventReconnected, Session: t.viewLocked(pid, s)})
+	default:
+		s.lastSeen = now
+	}
+	t.mu.Unlock()
+	t.fire(evs)
+}
+
+// Disconnect đánh dấu mất kết nối ngay (ví dụ socket đóng), bắt đầu tính grace
+func (t *SessionTracker) Disconnect(pid string) {
+	now := t.now()
+	var evs []SessionEvent
+	t.mu.Lock()
+	evs = t.sweepLocked(now, evs)
+	if s, ok := t.sessions[pid]; ok && s.state == SessionConnected {
+		evs = t.disconnectLocked(pid, s, now, evs)
+		evs = t.sweepLocked(now, evs) // grace 0 → left ngay
+	}
+	t.mu.Unlock()
+	t.fire(evs)
+}
+
+// Leave player rời hẳn (không chờ reconnect)
+func (t *SessionTracker) Leave(pid string) {
+	now := t.now()
+	var evs []SessionEvent
+	t.mu.Lock()
+	evs = t.sweepLocked(now, evs)
+	if s, ok := t.sessions[pid]; ok && s.state != SessionLeft {
+		if s.state == SessionConnected {
+			s.disconnectedAt = now
+		}
+		s.state = SessionLeft
+		evs = append(evs, SessionEvent{Type: SessionEventLeft, Session: t.viewLocked(pid, s)})
+	}
+	t.mu.Unlock()
+	t.fire(evs)
+}
+
+// Sweep áp dụng timeout (HeartbeatTTL, ReconnectGrace) theo đồng hồ hiện tại
+func (t *SessionTracker) Sweep() {
+	now := t.now()
+	t.mu.Lock()
+	evs := t.sweepLocked(now, nil)
+	t.mu.Unlock()
+	t.fire(evs)
+}
+
+func (t *SessionTracker) sweepLocked(now time.Time, evs []SessionEvent) []SessionEvent {
+	for _, pid := range t.sortedIDsLocked() {
+		s := t.sessions[pid]
+		if s.state == SessionConnected && now.Sub(s.lastSeen) > t.HeartbeatTTL {
+			// mốc mất kết nối = lần heartbeat cuối + TTL
+			evs = t.disconnectLocked(pid, s, s.lastSeen.Add(t.HeartbeatTTL), evs)
+		}
+		if s.state == SessionDisconnected && now.Sub(s.disconnectedAt) >= t.ReconnectGrace {
+			s.state = SessionLeft
+			evs = append(evs, SessionEvent{Type: SessionEventLeft, Session: t.viewLocked(pid, s)})
+		}
+	}
+	return evs
+}
+
+func (t *SessionTracker) disconnectLocked(pid string, s *session, at time.Time, evs []SessionEvent) []SessionEvent {
+	s.state = SessionDisconnected
+	s.disconnectedAt = at
+	return append(evs, SessionEvent{Type: SessionEventDisconnected, Session: t.viewLocked(pid, s)})
+}
+
+func (t *SessionTracker) fire(evs []SessionEvent) {
+	if t.OnEvent == nil {
+		return
+	}
+	for _, ev := range evs {
+		t.OnEvent(ev)
+	}
+}
+
+func (t *SessionTracker) viewLocked(pid string, s *session) Session {
+	v := Session{
+		PlayerID:    pid,
+		State:       s.state,
+		Expected:    t.expected[pid],
+		ConnectedAt: s.connectedAt.Unix(),
+		LastSeen:    s.lastSeen.Unix(),
+		Reconnects:  s.reconnects,
+	}
+	if !s.disconnectedAt.IsZero() {
+		v.DisconnectedAt = s.disconnectedAt.Unix()
+	}
+	return v
+}
+
+func (t *SessionTracker) sortedIDsLocked() []string {
+	ids := make([]string, 0, len(t.sessions))
+	for id := range t.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Get trả session của player
+func (t *SessionTracker) Get(pid string) (Session, bool) {
+	t.Sweep()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sessions[pid]
+	if !ok {
+		return Session{}, false
+	}
+	return t.viewLocked(pid, s), true
+}
+
+// Snapshot trả mọi session (sắp theo player_id)
+func (t *SessionTracker) Snapshot() []Session {
+	t.Sweep()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Session, 0, len(t.sessions))
+	for _, pid := range t.sortedIDsLocked() {
+		out = append(out, t.viewLocked(pid, t.sessions[pid]))
+	}
+	return out
+}
+
+func (t *SessionTracker) idsIn(states ...SessionState) []string {
+	t.Sweep()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []string{}
+	for _, pid := range t.sortedIDsLocked() {
+		for _, st := range states {
+			if t.sessions[pid].state == st {
+				out = append(out, pid)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Connected trả player đang kết nối
+func (t *SessionTracker) Connected() []string { return t.idsIn(SessionConnected) }
+
+// Disconnected trả player mất kết nối còn trong grace
+func (t *SessionTracker) Disconnected() []string { return t.idsIn(SessionDisconnected) }
+
+// Paused true khi đã có player nhưng tất cả đang mất kết nối trong grace: game nên tạm dừng, chưa kết thúc
+func (t *SessionTracker) Paused() bool {
+	return len(t.idsIn(SessionConnected)) == 0 && len(t.idsIn(SessionDisconnected)) > 0
+}
+
+// Present trả số player chưa rời (connected + disconnected trong grace)
+func (t *SessionTracker) Present() int { return len(t.idsIn(SessionConnected, SessionDisconnected)) }
+
+// Missing trả player có trong roster nhưng chưa từng kết nối
+func (t *SessionTracker) Missing() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []string{}
+	for id := range t.expected {
+		if _, ok := t.sessions[id]; !ok {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Unexpected trả player đã kết nối nhưng không có trong roster (roster rỗng → không có)
+func (t *SessionTracker) Unexpected() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := []string{}
+	if len(t.expected) == 0 {
+		return out
+	}
+	for _, pid := range t.sortedIDsLocked() {
+		if !t.expected[pid] {
+			out = append(out, pid)
+		}
+	}
+	return out
+}
+
+// StatsFunc adapter cho HeartbeatSource.GetStats: size = Present() (player đang trong grace vẫn tính → Paused, không shutdown).
+// Báo disconnected (client_disconnected) khi mọi player đã left sau grace;
+// shutdownOnLeave=true → chỉ cần một player left.
+func (t *SessionTracker) StatsFunc(shutdownOnLeave bool) func() (int, bool) {
+	return func() (int, bool) {
+		size := t.Present()
+		left := len(t.idsIn(SessionLeft))
+		return size, left > 0 && (shutdownOnLeave || size == 0)
+	}
+}
@@ -0,0 +1,252 @@
+package svrsdk
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock đồng hồ giả cho SessionTracker.Now / AfkSource.Now
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock { return &fakeClock{now: time.Unix(1_700_000_000, 0)} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestTracker tracker TTL 10s, grace 30s chạy trên fake clock, ghi lại event theo thứ tự
+func newTestTracker(grace time.Duration) (*SessionTracker, *fakeClock, *[]SessionEvent) {
+	clock := newFakeClock()
+	evs := &[]SessionEvent{}
+	t := NewSessionTracker(10*time.Second, grace)
+	t.Now = clock.Now
+	t.OnEvent = func(ev SessionEvent) { *evs = append(*evs, ev) }
+	return t, clock, evs
+}
+
+func eventTypes(evs []SessionEvent) []SessionEventType {
+	out := []SessionEventType{}
+	for _, ev := range evs {
+		out = append(out, ev.Type)
+	}
+	return out
+}
+
+func TestSessionTrackerLifecycle(t *testing.T) {
+	tr, clock, evs := newTestTracker(30 * time.Second)
+	start := clock.Now()
+
+	tr.Heartbeat("p1")
+	clock.Advance(5 * time.Second)
+	tr.Heartbeat("p1") // trong TTL: không có event mới
+	if got := tr.Connected(); !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Fatalf("connected = %v", got)
+	}
+
+	// quá TTL kể từ heartbeat cuối → disconnected, mốc = heartbeat cuối + TTL
+	clock.Advance(11 * time.Second)
+	s, _ := tr.Get("p1")
+	if s.State != SessionDisconnected {
+		t.Fatalf("state = %s, want disconnected", s.State)
+	}
+	if want := start.Add(15 * time.Second).Unix(); s.DisconnectedAt != want {
+		t.Fatalf("disconnected_at = %d, want %d", s.DisconnectedAt, want)
+	}
+	if !tr.Paused() || tr.Present() != 1 {
+		t.Fatalf("paused = %v present = %d, want paused with 1 present", tr.Paused(), tr.Present())
+	}
+
+	// quay lại trong grace → reconnected
+	clock.Advance(10 * time.Second)
+	tr.Heartbeat("p1")
+	s, _ = tr.Get("p1")
+	if s.State != SessionConnected || s.Reconnects != 1 || s.DisconnectedAt != 0 {
+		t.Fatalf("session after reconnect = %+v", s)
+	}
+
+	// mất kết nối lần nữa và hết grace → left
+	tr.Disconnect("p1")
+	clock.Advance(30 * time.Second)
+	if s, _ = tr.Get("p1"); s.State != SessionLeft {
+		t.Fatalf("state = %s, want left", s.State)
+	}
+	if tr.Present() != 0 || tr.Paused() {
+		t.Fatalf("present = %d paused = %v after left", tr.Present(), tr.Paused())
+	}
+
+	want := []SessionEventType{SessionEventConnected, SessionEventDisconnected, SessionEventReconnected, SessionEventDisconnected, SessionEventLeft}
+	if got := eventTypes(*evs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestSessionTrackerNoGrace(t *testing.T) {
+	tr, _, evs := newTestTracker(0)
+	tr.Heartbeat("p1")
+	tr.Disconnect("p1")
+	want := []SessionEventType{SessionEventConnected, SessionEventDisconnected, SessionEventLeft}
+	if got := eventTypes(*evs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestSessionTrackerLeave(t *testing.T) {
+	tr, clock, evs := newTestTracker(30 * time.Second)
+	tr.Heartbeat("p1")
+	clock.Advance(time.Second)
+	tr.Leave("p1")
+	tr.Leave("p1") // lần hai không phát event
+	s, _ := tr.Get("p1")
+	if s.State != SessionLeft || s.DisconnectedAt != clock.Now().Unix() {
+		t.Fatalf("session = %+v", s)
+	}
+	if got := eventTypes(*evs); !reflect.DeepEqual(got, []SessionEventType{SessionEventConnected, SessionEventLeft}) {
+		t.Fatalf("events = %v", got)
+	}
+}
+
+func TestSessionTrackerRoster(t *testing.T) {
+	tr, _, _ := newTestTracker(30 * time.Second)
+	tr.SetExpectedFromAssignment(&Assignment{Players: []PlayerAssignment{{PlayerID: "p1"}, {PlayerID: "p2"}}})
+	tr.Heartbeat("p1")
+	tr.Heartbeat("x")
+	if got := tr.Missing(); !reflect.DeepEqual(got, []string{"p2"}) {
+		t.Fatalf("missing = %v", got)
+	}
+	if got := tr.Unexpected(); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Fatalf("unexpected = %v", got)
+	}
+	if s, _ := tr.Get("p1"); !s.Expected {
+		t.Fatal("p1 should be expected")
+	}
+}
+
+func TestSessionTrackerStatsFunc(t *testing.T) {
+	tests := []struct {
+		name            string
+		shutdownOnLeave bool
+		steps           func(tr *SessionTracker, clock *fakeClock)
+		wantSize        int
+		wantDisc        bool
+	}{
+		{
+			name:     "no players yet",
+			steps:    func(*SessionTracker, *fakeClock) {},
+			wantSize: 0,
+		},
+		{
+			name: "player in grace keeps the room paused",
+			steps: func(tr *SessionTracker, clock *fakeClock) {
+				tr.Heartbeat("p1")
+				clock.Advance(20 * time.Second)
+			},
+			wantSize: 1,
+		},
+		{
+			name: "one of two left, room continues",
+			steps: func(tr *SessionTracker, clock *fakeClock) {
+				tr.Heartbeat("p1")
+				tr.Heartbeat("p2")
+				tr.Leave("p2")
+			},
+			wantSize: 1,
+		},
+		{
+			name:            "one of two left with shutdown on leave",
+			shutdownOnLeave: true,
+			steps: func(tr *SessionTracker, clock *fakeClock) {
+				tr.Heartbeat("p1")
+				tr.Heartbeat("p2")
+				tr.Leave("p2")
+			},
+			wantSize: 1,
+			wantDisc: true,
+		},
+		{
+			name: "everyone left after grace",
+			steps: func(tr *SessionTracker, clock *fakeClock) {
+				tr.Heartbeat("p1")
+				tr.Heartbeat("p2")
+				clock.Advance(10*time.Second + 30*time.Second + time.Second)
+			},
+			wantSize: 0,
+			wantDisc: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, clock, _ := newTestTracker(30 * time.Second)
+			tt.steps(tr, clock)
+			size, disc := tr.StatsFunc(tt.shutdownOnLeave)()
+			if size != tt.wantSize || disc != tt.wantDisc {
+				t.Fatalf("stats = (%d, %v), want (%d, %v)", size, disc, tt.wantSize, tt.wantDisc)
+			}
+		})
+	}
+}
+
+func TestHeartbeatSourceWithSessionStats(t *testing.T) {
+	tr, clock, _ := newTestTracker(30 * time.Second)
+	tr.Heartbeat("p1")
+	clock.Advance(time.Minute) // hết TTL + grace → left
+
+	got := make(chan ShutdownEvent, 1)
+	src := &HeartbeatSource{PollInterval: time.Millisecond, GetStats: tr.StatsFunc(false)}
+	stop := src.Start(func(ev ShutdownEvent) {
+		select {
+		case got <- ev:
+		default:
+		}
+	})
+	defer stop()
+	select {
+	case ev := <-got:
+		if ev.Reason != ReasonClientDisconnected {
+			t.Fatalf("reason = %s, want %s", ev.Reason, ReasonClientDisconnected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat source did not emit")
+	}
+}
+
+func TestAfkSourceFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	tests := []struct {
+		name       string
+		allPlayers bool
+		wantOK     bool
+	}{
+		{name: "any player afk", wantOK: true},
+		{name: "all players required", allPlayers: true, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AfkSource{Timeout: 30 * time.Second, AllPlayers: tt.allPlayers, Now: clock.Now}
+			a.ReportInput("p1")
+			a.ReportInput("p2")
+			clock.Advance(20 * time.Second)
+			a.ReportInput("p2")
+			if afk, ok := a.afkPlayers(clock.Now()); ok || len(afk) != 0 {
+				t.Fatalf("afk before timeout = %v, %v", afk, ok)
+			}
+			clock.Advance(15 * time.Second)
+			afk, ok := a.afkPlayers(clock.Now())
+			if !reflect.DeepEqual(afk, []string{"p1"}) || ok != tt.wantOK {
+				t.Fatalf("afk = %v, %v; want [p1], %v", afk, ok, tt.wantOK)
+			}
+		})
+	}
+}
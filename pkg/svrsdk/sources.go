@@ -3,6 +3,7 @@ package svrsdk
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -26,7 +27,8 @@ func (s *SignalSource) Start(emit func(ShutdownEvent)) (stop func()) {
 	return func() { close(stopped); signal.Stop(ch) }
 }
 
-// HeartbeatSource kiểm tra theo dõi số players để quyết định shutdown
+// HeartbeatSource kiểm tra theo dõi số players để quyết định shutdown.
+// Sau grace, mỗi PollInterval còn điều kiện thì emit lại (client chỉ shutdown một lần; event bị middleware cancel sẽ được xét lại).
 type HeartbeatSource struct {
 	InitialGrace time.Duration
 	HeartbeatTTL time.Duration // TTL chỉ để tham khảo, logic cụ thể nằm ở GetStats
@@ -50,25 +52,189 @@ func (h *HeartbeatSource) Start(emit func(ShutdownEvent)) (stop func()) {
 				return
 			}
 		}
-		// Nếu không có người chơi nào
-		if h.GetStats != nil {
-			size, _ := h.GetStats()
-			if size == 0 {
-				emit(NewEvent(ReasonNoClients))
+		check := func() {
+			if h.GetStats == nil {
 				return
 			}
+			size, disconnected := h.GetStats()
+			switch {
+			case disconnected: // ưu tiên: player đã vào rồi mất kết nối (hết reconnect window)
+				emit(NewEvent(ReasonClientDisconnected))
+			case size == 0: // không có người chơi nào
+				emit(NewEvent(ReasonNoClients))
+			}
 		}
+		check()
 		ticker := time.NewTicker(h.PollInterval)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				if h.GetStats != nil {
-					_, any := h.GetStats()
-					if any {
-						emit(NewEvent(ReasonClientDisconnected))
-						return
-					}
+				check()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return func() { close(stopCh) }
+}
+
+// AfkSource phát afk_timeout khi player không có input quá Timeout.
+// Game gọi ReportInput mỗi khi nhận input thật (di chuyển, bắn...) — khác heartbeat kết nối.
+type AfkSource struct {
+	Timeout      time.Duration
+	PollInterval time.Duration
+	// AllPlayers: true → chỉ shutdown khi mọi player đều AFK; false → khi bất kỳ player nào AFK
+	AllPlayers bool
+	// Now thay được bằng fake clock khi test (mặc định time.Now)
+	Now func() time.Time
+
+	mu        sync.Mutex
+	lastInput map[string]time.Time
+}
+
+// ReportInput ghi nhận input của player (player mới được tính từ lần input đầu tiên)
+func (a *AfkSource) ReportInput(playerID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lastInput == nil {
+		a.lastInput = map[string]time.Time{}
+	}
+	a.lastInput[playerID] = a.now()
+}
+
+func (a *AfkSource) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+// RemovePlayer bỏ theo dõi player đã rời trận
+func (a *AfkSource) RemovePlayer(playerID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.lastInput, playerID)
+}
+
+// afkPlayers trả danh sách player AFK và có đủ điều kiện shutdown chưa
+func (a *AfkSource) afkPlayers(now time.Time) ([]string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	afk := []string{}
+	for id, ts := range a.lastInput {
+		if now.Sub(ts) > a.Timeout {
+			afk = append(afk, id)
+		}
+	}
+	if len(afk) == 0 {
+		return nil, false
+	}
+	if a.AllPlayers && len(afk) < len(a.lastInput) {
+		return afk, false
+	}
+	return afk, true
+}
+
+func (a *AfkSource) Start(emit func(ShutdownEvent)) (stop func()) {
+	if a.PollInterval <= 0 {
+		a.PollInterval = time.Second
+	}
+	stopCh := make(chan struct{})
+	go func() {
+		if a.Timeout <= 0 {
+			return
+		}
+		ticker := time.NewTicker(a.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if afk, ok := a.afkPlayers(a.now()); ok {
+					ev := NewEvent(ReasonAfkTimeout)
+					ev.Details = map[string]any{"afk_players": afk}
+					emit(ev)
+					return
+				}
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+	return func() { close(stopCh) }
+}
+
+// MaxDurationSource phát max_duration khi trận kéo dài quá Duration (tính từ Start)
+type MaxDurationSource struct {
+	Duration time.Duration
+}
+
+func (m *MaxDurationSource) Start(emit func(ShutdownEvent)) (stop func()) {
+	stopCh := make(chan struct{})
+	go func() {
+		if m.Duration <= 0 {
+			return
+		}
+		t := time.NewTimer(m.Duration)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			ev := NewEvent(ReasonMaxDuration)
+			ev.Details = map[string]any{"max_duration_seconds": int64(m.Duration / time.Second)}
+			emit(ev)
+		case <-stopCh:
+		}
+	}()
+	return func() { close(stopCh) }
+}
+
+// GameCycleSource phát game_cycle_completed khi game báo hết trận:
+// đẩy bằng Complete(details) hoặc để SDK poll callback Done mỗi PollInterval.
+type GameCycleSource struct {
+	Done         func() (done bool, details map[string]any) // tùy chọn
+	PollInterval time.Duration
+
+	once sync.Once
+	ch   chan map[string]any
+}
+
+func (g *GameCycleSource) init() { g.once.Do(func() { g.ch = make(chan map[string]any, 1) }) }
+
+// Complete báo trận đã kết thúc kèm details (winner, scores...); chỉ lần gọi đầu có hiệu lực
+func (g *GameCycleSource) Complete(details map[string]any) {
+	g.init()
+	select {
+	case g.ch <- details:
+	default:
+	}
+}
+
+func (g *GameCycleSource) Start(emit func(ShutdownEvent)) (stop func()) {
+	g.init()
+	if g.PollInterval <= 0 {
+		g.PollInterval = time.Second
+	}
+	stopCh := make(chan struct{})
+	fire := func(details map[string]any) {
+		ev := NewEvent(ReasonGameCycleCompleted)
+		ev.Details = details
+		emit(ev)
+	}
+	go func() {
+		ticker := time.NewTicker(g.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case details := <-g.ch:
+				fire(details)
+				return
+			case <-ticker.C:
+				if g.Done == nil {
+					continue
+				}
+				if done, details := g.Done(); done {
+					fire(details)
+					return
 				}
 			case <-stopCh:
 				return
@@ -0,0 +1,77 @@
+package svrsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SpooledShutdown shutdown event chưa gửi được, đủ thông tin để process khác (hoặc sidecar) gửi lại
+type SpooledShutdown struct {
+	AgentBaseURL string        `json:"agent_base_url"`
+	RoomID       string        `json:"room_id"`
+	Token        string        `json:"token"`
+	Event        ShutdownEvent `json:"event"`
+	SpooledAt    int64         `json:"spooled_at_unix"`
+}
+
+// spool ghi event ra <dir>/<room_id>-<idempotency_key>.json (ghi file tạm rồi rename để replay không đọc file dở)
+func spool(dir string, cfg Config, ev ShutdownEvent) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	b, _ := json.Marshal(SpooledShutdown{AgentBaseURL: cfg.AgentBaseURL, RoomID: cfg.RoomID, Token: cfg.Token, Event: ev, SpooledAt: time.Now().Unix()})
+	path := filepath.Join(dir, cfg.RoomID+"-"+ev.IdempotencyKey+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// ReplaySpool gửi lại các event trong dir (cùng idempotency key nên agent không xử lý 2 lần).
+// Gửi được → xoá file; 404/409 (room đã hết hạn key hoặc đã terminal, shutdown không còn tác dụng) → coi như đã gửi, xoá file;
+// agent từ chối hẳn (4xx khác: token sai, body sai) → đổi tên .failed để inspect; lỗi tạm thời → giữ lại cho lần sau.
+func ReplaySpool(ctx context.Context, dir string, n *AgentNotifier) (sent int, err error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	sender := *n
+	sender.SpoolDir = "" // không spool lại khi replay
+	for _, f := range files {
+		b, rerr := os.ReadFile(f)
+		if rerr != nil {
+			continue
+		}
+		var s SpooledShutdown
+		if json.Unmarshal(b, &s) != nil {
+			_ = os.Rename(f, strings.TrimSuffix(f, ".json")+".failed")
+			continue
+		}
+		cfg := Config{AgentBaseURL: s.AgentBaseURL, RoomID: s.RoomID, Token: s.Token}
+		switch nerr := sender.Notify(ctx, cfg, s.Event); {
+		case nerr == nil:
+			_ = os.Remove(f)
+			sent++
+		case roomGone(nerr):
+			_ = os.Remove(f)
+		case !Retryable(nerr):
+			_ = os.Rename(f, strings.TrimSuffix(f, ".json")+".failed")
+		default:
+			err = nerr
+		}
+	}
+	return sent, err
+}
+
+// roomGone: agent không còn room (404) hoặc room đã terminal (409) → replay không còn ý nghĩa
+func roomGone(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && (se.Code == http.StatusNotFound || se.Code == http.StatusConflict)
+}
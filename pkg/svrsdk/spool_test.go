@@ -0,0 +1,53 @@
+package svrsdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaySpool(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantSent   int
+		wantErr    bool
+		wantJSON   bool // file còn lại để lần sau gửi tiếp
+		wantFailed bool // file bị đổi tên .failed
+	}{
+		{name: "delivered", status: http.StatusOK, wantSent: 1},
+		{name: "room expired is treated as delivered", status: http.StatusNotFound},
+		{name: "room already terminal is treated as delivered", status: http.StatusConflict},
+		{name: "rejected token is kept for inspection", status: http.StatusUnauthorized, wantFailed: true},
+		{name: "transient error is kept for next replay", status: http.StatusServiceUnavailable, wantErr: true, wantJSON: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			dir := t.TempDir()
+			path, err := spool(dir, Config{AgentBaseURL: srv.URL, RoomID: "r1", Token: "tok"}, ShutdownEvent{Reason: "no_clients", IdempotencyKey: "k1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n := &AgentNotifier{MaxAttempts: 1, BaseDelay: 1, MaxDelay: 1}
+			sent, err := ReplaySpool(context.Background(), dir, n)
+			if sent != tt.wantSent || (err != nil) != tt.wantErr {
+				t.Fatalf("ReplaySpool = %d, %v", sent, err)
+			}
+			if _, err := os.Stat(path); (err == nil) != tt.wantJSON {
+				t.Fatalf("spool file exists = %v, want %v", err == nil, tt.wantJSON)
+			}
+			failed, _ := filepath.Glob(filepath.Join(dir, "*.failed"))
+			if (len(failed) == 1) != tt.wantFailed {
+				t.Fatalf(".failed files = %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
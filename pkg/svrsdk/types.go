@@ -14,6 +14,7 @@ const (
 	ReasonSignal             ShutdownReason = "signal_received"
 	ReasonAfkTimeout         ShutdownReason = "afk_timeout"
 	ReasonGameCycleCompleted ShutdownReason = "game_cycle_completed"
+	ReasonMaxDuration        ShutdownReason = "max_duration"
 )
 
 // Config cấu hình chung cho SDK (được load từ ENV/flags)
@@ -25,6 +26,8 @@ type Config struct {
 	NoGraphics   bool
 	BatchMode    bool
 	ServerPort   string // Port for HTTP heartbeat server (optional)
+	JoinKey      string // key xác thực join token của player (rỗng = không xác thực)
+	SpoolDir     string // thư mục spool shutdown event khi agent không nhận được (rỗng = tắt)
 }
 
 // ShutdownEvent mô tả sự kiện shutdown có thể kèm payload chi tiết
@@ -33,6 +36,10 @@ type ShutdownEvent struct {
 	Reason  ShutdownReason `json:"reason"`
 	At      int64          `json:"at"`
 	Details map[string]any `json:"details,omitempty"`
+	// Result kết quả trận có kiểu, agent validate theo roster (ưu tiên hơn details winner/scores)
+	Result *MatchResult `json:"result,omitempty"`
+	// IdempotencyKey giữ nguyên qua các lần retry/replay để agent chỉ xử lý một lần
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 // ShutdownContext truyền vào pipeline xử lý
@@ -75,5 +82,5 @@ type Middleware func(next ShutdownHandler) ShutdownHandler
 
 // helper tạo event
 func NewEvent(reason ShutdownReason) ShutdownEvent {
-	return ShutdownEvent{Reason: reason, At: time.Now().Unix()}
+	return ShutdownEvent{Reason: reason, At: time.Now().Unix(), IdempotencyKey: newIdempotencyKey()}
 }
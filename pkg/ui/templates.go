@@ -38,7 +38,7 @@ const AgentUIHTML = `<!doctype html>
       </div>
       <div class="card">
         <h3>Actived Rooms</h3>
-        <table id="tblActived"><thead><tr><th>Room</th><th>Players</th><th>Server</th><th>Alloc</th><th>Created At</th></tr></thead><tbody></tbody></table>
+        <table id="tblActived"><thead><tr><th>Room</th><th>Players</th><th>Server</th><th>Alloc</th><th>Created At</th><th>Live</th><th>Phase</th><th>Tick</th><th>Mem MB</th><th>Last HB</th></tr></thead><tbody></tbody></table>
       </div>
       <div class="card">
         <h3>Fulfilled Rooms</h3>
@@ -84,12 +84,18 @@ const AgentUIHTML = `<!doctype html>
     (items||[]).forEach(it=>{
       const players = (it.players||[]).join(', ');
       const server = (it.server_ip&&it.port)? (it.server_ip+':'+it.port) : '';
+      const t = it.telemetry||{};
       const tr=document.createElement('tr');
       tr.innerHTML = '<td class="mono">'+(it.room_id||'')+'</td>'+
                      '<td>'+players+'</td>'+
                      '<td>'+server+'</td>'+
                      '<td class="mono">'+(it.allocation_id||'')+'</td>'+
-                     '<td>'+ts2(it.created_at_unix||it.created_at||0)+'</td>';
+                     '<td>'+ts2(it.created_at_unix||it.created_at||0)+'</td>'+
+                     '<td>'+(it.telemetry? t.player_count : '')+'</td>'+
+                     '<td>'+(t.phase||'')+'</td>'+
+                     '<td>'+(t.tick_rate? t.tick_rate.toFixed(1) : '')+'</td>'+
+                     '<td>'+(t.memory_mb? t.memory_mb.toFixed(1) : '')+'</td>'+
+                     '<td>'+(it.last_heartbeat_unix? ts2(it.last_heartbeat_unix) : '')+'</td>';
       tb.appendChild(tr);
     });
   }
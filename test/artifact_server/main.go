@@ -0,0 +1,49 @@
+package main
+
+// Artifact server local: phục vụ thư mục build archive qua HTTP để Nomad (dev-mode) tải về
+// thay cho S3/CDN, in ra artifact (source + checksum) để dán vào QUEUES_FILE hoặc POST /admin/builds.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"hive/internal/testutil"
+)
+
+func main() {
+	dir := flag.String("dir", "./artifacts", "thư mục chứa archive (.tar.gz/.zip)")
+	addr := flag.String("addr", "0.0.0.0:8099", "địa chỉ listen")
+	host := flag.String("host", "127.0.0.1", "host mà Nomad client dùng để tải artifact")
+	flag.Parse()
+
+	srv, err := testutil.NewArtifactServer(*dir, *addr, *host)
+	if err != nil {
+		log.Fatalf("Không thể khởi động artifact server: %v", err)
+	}
+	defer srv.Close()
+
+	fmt.Printf("📦 Artifact server: %s (dir=%s)\n", srv.URL(), *dir)
+	entries, _ := os.ReadDir(*dir)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		a, err := srv.Artifact(e.Name())
+		if err != nil {
+			log.Printf("❌ %s: %v", e.Name(), err)
+			continue
+		}
+		raw, _ := json.Marshal(a)
+		fmt.Printf("%s\n  %s\n", filepath.Base(e.Name()), raw)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+}
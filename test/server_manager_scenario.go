@@ -19,11 +19,10 @@ func main() {
 	// Set datacenters
 	manager.SetDatacenters([]string{"dc1"})
 
-	// Set IP mapping config
-	ipConfig := &svrmgr.IPMappingConfig{
+	// Địa chỉ public lấy từ node meta public_ip; override riêng cho node chưa khai báo meta
+	manager.SetAddressOptions(svrmgr.AddressOptions{
 		Mappings: []svrmgr.IPMapping{{PrivateIP: "172.26.15.163", PublicIP: "52.221.213.97"}},
-	}
-	svrmgr.SetIPMappingConfig(ipConfig)
+	})
 
 	fmt.Println("🧪 Test Server Manager với Nomad")
 